@@ -0,0 +1,2152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/stackfilesync/stack-sync-cli/internal/config"
+	"github.com/stackfilesync/stack-sync-cli/internal/credentials"
+	"github.com/stackfilesync/stack-sync-cli/internal/git"
+	"github.com/stackfilesync/stack-sync-cli/internal/i18n"
+	"github.com/stackfilesync/stack-sync-cli/internal/sync"
+	"github.com/stackfilesync/stack-sync-cli/internal/ui"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// Version will be set during build via ldflags
+var Version = "1.2.0"
+
+// Global I18n instance
+var globalI18n *i18n.I18n
+
+// dryRun is set by the global --dry-run flag
+var dryRun bool
+
+// offline is set by the global --offline flag
+var offline bool
+
+// rootCtx is cancelled by the first Ctrl+C or SIGTERM
+var rootCtx = context.Background()
+
+// Exit codes reported by sync, with or without a terminal
+const (
+	exitNoChanges = 0   // everything was already up to date
+	exitFailed    = 1   // at least one repository failed to sync
+	exitChanged   = 2   // files were added, modified or deleted
+	exitDrift     = 3   // target no longer matches the lockfile or remote
+	exitCancelled = 130 // interrupted by Ctrl+C or SIGTERM
+)
+
+// stdinIsTerminal reports whether prompts can be answered
+func stdinIsTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// newManager creates a sync manager with the global flags applied
+func newManager(cfg *config.Config) *sync.Manager {
+	manager := sync.NewManager(cfg, globalI18n)
+	manager.SetDryRun(dryRun)
+	manager.SetOffline(offline)
+	return manager
+}
+
+// syncExitCode maps a sync outcome to an exit code
+func syncExitCode(result *sync.SyncResult, err error) int {
+	switch {
+	case errors.Is(err, sync.ErrCancelled):
+		return exitCancelled
+	case errors.Is(err, sync.ErrLockDrift):
+		return exitDrift
+	case err != nil, result.HasConflicts():
+		return exitFailed
+	case result.HasChanges():
+		return exitChanged
+	}
+	return exitNoChanges
+}
+
+func main() {
+	// Initialize I18n
+	globalI18n = i18n.New()
+
+	// Check if first argument is a Chinese command to determine language
+	if len(os.Args) > 1 {
+		// Remove Chinese command support - commands should always be in English
+		// Only set language based on config or environment
+	}
+
+	// Load config to get language setting (if not already set)
+	if globalI18n.GetLanguage() == i18n.English {
+		cfg, err := config.Load()
+		if err == nil {
+			// Set language from config
+			globalI18n.SetLanguage(i18n.ParseLanguage(cfg.Settings.Language))
+		}
+	}
+
+	// Set I18n for UI
+	ui.SetI18n(globalI18n)
+
+	// The first Ctrl+C or SIGTERM cancels the running sync, which cleans up its
+	// temp directories and records the cancellation; a second one exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	rootCtx = ctx
+
+	// Unlock the secrets file from the environment, or ask once on a terminal
+	credentials.PassphraseFunc = func() (string, error) {
+		if passphrase := os.Getenv(credentials.PassphraseEnv); passphrase != "" || !stdinIsTerminal() {
+			return passphrase, nil
+		}
+		return ui.PromptInput("Passphrase for "+credentials.SecretsPath(), "", true)
+	}
+
+	// Global flags may appear anywhere on the command line
+	args := os.Args[:1]
+	for _, arg := range os.Args[1:] {
+		if arg == "--dry-run" {
+			dryRun = true
+			continue
+		}
+		if arg == "--offline" {
+			offline = true
+			continue
+		}
+		args = append(args, arg)
+	}
+	os.Args = args
+
+	if len(os.Args) < 2 {
+		// Default behavior: show interactive selector
+		runInteractive()
+		return
+	}
+
+	command := os.Args[1]
+
+	// Commands should always be in English - no translation needed
+
+	switch command {
+	case "init":
+		initConfig()
+	case "sync":
+		syncCommand()
+	case "list", "ls":
+		listCommand()
+	case "add":
+		addCommand()
+	case "remove", "rm":
+		removeCommand()
+	case "status":
+		statusCommand()
+	case "watch":
+		watchCommand()
+	case "history":
+		historyCommand()
+	case "cache":
+		cacheCommand()
+	case "backup", "backups":
+		backupCommand()
+	case "outdated":
+		outdatedCommand()
+	case "check":
+		checkCommand()
+	case "undo":
+		undoCommand()
+	case "secrets":
+		secretsCommand()
+	case "doctor":
+		doctorCommand()
+	case "help", "-h", "--help":
+		printHelp()
+	case "version", "-v", "--version":
+		printVersion()
+	default:
+		ui.PrintError(globalI18n.T(i18n.MsgUnknownCommand, os.Args[1]))
+		printHelp()
+		os.Exit(1)
+	}
+}
+
+// runInteractive shows the interactive repository selector
+func runInteractive() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError(globalI18n.T(i18n.MsgFailedToLoadConfig, err))
+		os.Exit(1)
+	}
+
+	if len(cfg.Repositories) == 0 {
+		ui.PrintWarning(globalI18n.T(i18n.MsgNoRepositories))
+		ui.PrintInfo("Run 'stack-sync add' to add a repository")
+		os.Exit(0)
+	}
+
+	manager := newManager(cfg)
+
+	// Update repository statuses
+	ui.PrintInfo("Checking repository statuses...")
+	if err := manager.UpdateAllStatuses(rootCtx); err != nil {
+		ui.PrintWarning("Failed to update some repository statuses")
+	}
+
+	// Show interactive selector
+	repo, err := ui.SelectRepository(cfg.Repositories)
+	if err != nil {
+		ui.PrintError("Selection cancelled")
+		os.Exit(0)
+	}
+
+	// Sync the selected repository
+	ui.PrintInfo(globalI18n.T(i18n.MsgSyncing, repo.Name))
+	if _, err := manager.SyncRepository(rootCtx, repo); err != nil {
+		ui.PrintError(globalI18n.T(i18n.MsgSyncFailed, err))
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess(globalI18n.T(i18n.MsgSuccessfullySynced, repo.Name))
+}
+
+// initConfig initializes the configuration
+func initConfig() {
+	configPath := config.GetConfigPath()
+
+	// Check if config already exists
+	if _, err := os.Stat(configPath); err == nil {
+		if !ui.ConfirmAction("Config file already exists. Overwrite?") {
+			ui.PrintInfo("Cancelled")
+			return
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	if err := config.Save(cfg); err != nil {
+		ui.PrintError("Failed to save config: %v", err)
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess("Configuration initialized at: %s", configPath)
+	ui.PrintInfo("Edit the config file to add repositories")
+}
+
+// syncCommand syncs a specific repository or all
+func syncCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	manager := newManager(cfg)
+
+	// Parse command line arguments
+	var repoName, filterKeyword, numberSelection string
+	var onConflict, group string
+	var diffMode, lockedMode, nonInteractive, prune, force, allRepos bool
+	jobs := 1
+	args := os.Args[2:] // Skip "stack-sync" and "sync"
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-f" && i+1 < len(args) {
+			filterKeyword = args[i+1]
+			i++ // Skip the next argument as it's the filter value
+		} else if arg == "-n" && i+1 < len(args) {
+			numberSelection = args[i+1]
+			i++ // Skip the next argument as it's the number selection value
+		} else if arg == "-d" || arg == "--diff" {
+			diffMode = true
+		} else if arg == "--locked" {
+			lockedMode = true
+		} else if arg == "-y" || arg == "--yes" || arg == "--non-interactive" {
+			nonInteractive = true
+		} else if arg == "--prune" {
+			prune = true
+		} else if arg == "--force" {
+			force = true
+		} else if arg == "--on-conflict" && i+1 < len(args) {
+			onConflict = args[i+1]
+			i++
+		} else if strings.HasPrefix(arg, "--on-conflict=") {
+			onConflict = strings.TrimPrefix(arg, "--on-conflict=")
+		} else if (arg == "--group" || arg == "-g") && i+1 < len(args) {
+			group = args[i+1]
+			i++
+		} else if strings.HasPrefix(arg, "--group=") {
+			group = strings.TrimPrefix(arg, "--group=")
+		} else if arg == "--all" || arg == "-a" {
+			allRepos = true
+		} else if (arg == "--jobs" || arg == "-j") && i+1 < len(args) {
+			jobs = parseJobs(args[i+1])
+			i++
+		} else if strings.HasPrefix(arg, "--jobs=") {
+			jobs = parseJobs(strings.TrimPrefix(arg, "--jobs="))
+		} else if !strings.HasPrefix(arg, "-") {
+			// Repository name (not a flag)
+			repoName = arg
+		}
+	}
+
+	// Without a terminal nobody can answer prompts (CI, pipes, cron)
+	if !nonInteractive && !stdinIsTerminal() {
+		nonInteractive = true
+	}
+	manager.SetNonInteractive(nonInteractive)
+	manager.SetPrune(prune)
+	manager.SetForce(force)
+
+	switch onConflict {
+	case "", models.OnConflictAsk, models.OnConflictKeepLocal, models.OnConflictTakeRemote, models.OnConflictMerge:
+		manager.SetOnConflict(onConflict)
+	default:
+		ui.PrintError("Unknown --on-conflict value: %s (use ask, keep-local, take-remote or merge)", onConflict)
+		os.Exit(exitFailed)
+	}
+
+	// exit reports the outcome; 0 returns normally
+	exit := func(code int) {
+		if code != exitNoChanges {
+			os.Exit(code)
+		}
+	}
+
+	if allRepos && repoName != "" {
+		ui.PrintError("--all syncs every repository, drop %s or --all", repoName)
+		os.Exit(exitFailed)
+	}
+	if group != "" && (repoName != "" || allRepos) {
+		ui.PrintError("--group can't be combined with a repository name or --all")
+		os.Exit(exitFailed)
+	}
+
+	// If repository name provided, sync that one
+	if repoName != "" {
+		repo, err := cfg.GetRepository(repoName)
+		if err != nil {
+			ui.PrintError("Repository not found: %s", repoName)
+			os.Exit(exitFailed)
+		}
+
+		ui.PrintInfo(globalI18n.T(i18n.MsgSyncing, repo.Name))
+
+		var result *sync.SyncResult
+		switch {
+		case lockedMode:
+			result, err = manager.SyncRepositoryLocked(rootCtx, repo)
+		case diffMode:
+			result, err = manager.SyncRepositoryWithDiff(rootCtx, repo)
+		case numberSelection != "":
+			// Use number selection method
+			result, err = manager.SyncRepositoryWithNumberSelection(rootCtx, repo, filterKeyword, numberSelection)
+		default:
+			// Use filter method or regular sync
+			result, err = manager.SyncRepositoryWithFilter(rootCtx, repo, filterKeyword)
+		}
+
+		if err != nil {
+			ui.PrintError("Sync failed: %v", err)
+			exit(syncExitCode(result, err))
+		}
+
+		switch {
+		case dryRun:
+			ui.PrintInfo("Dry run complete, %s was not modified", repo.Name)
+		case result.HasConflicts():
+			ui.PrintWarning("Synced %s with conflicts, see above", repo.Name)
+		case lockedMode:
+			ui.PrintSuccess("Successfully synced %s from lockfile", repo.Name)
+		case diffMode:
+			ui.PrintSuccess("Successfully synced %s (diff preview mode)", repo.Name)
+		default:
+			ui.PrintSuccess("Successfully synced %s", repo.Name)
+		}
+		exit(syncExitCode(result, nil))
+		return
+	}
+
+	// Sync all repositories, or a group of them, dependencies first
+	target := "all repositories"
+	repos := make([]*models.Repository, len(cfg.Repositories))
+	for i := range cfg.Repositories {
+		repos[i] = &cfg.Repositories[i]
+	}
+	if group != "" {
+		target = "group " + group
+		repos = cfg.Group(group)
+		if len(repos) == 0 {
+			ui.PrintError("No repositories in group or with tag: %s", group)
+			os.Exit(exitFailed)
+		}
+	}
+	repos, err = cfg.SyncOrder(repos)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(exitFailed)
+	}
+
+	// Several at a time with --jobs
+	if jobs > 1 {
+		syncParallel(manager, repos, jobs, lockedMode, exit)
+		return
+	}
+
+	ui.PrintInfo(globalI18n.T(i18n.MsgSyncing, target))
+	failed, drifted, changed := 0, 0, 0
+	failedRepos := make(map[string]bool)
+	for _, repo := range repos {
+		if err := sync.CheckDependencies(repo, failedRepos); err != nil {
+			ui.PrintWarning("Skipped %s: %v", repo.Name, err)
+			failedRepos[repo.Name] = true
+			failed++
+			continue
+		}
+		ui.PrintInfo(globalI18n.T(i18n.MsgSyncing, repo.Name))
+
+		syncFn := manager.SyncRepository
+		if lockedMode {
+			syncFn = manager.SyncRepositoryLocked
+		}
+
+		result, err := syncFn(rootCtx, repo)
+		if err != nil || result.HasConflicts() {
+			// Dependents build on this repository's files, so conflicts skip them too
+			failedRepos[repo.Name] = true
+		}
+		switch syncExitCode(result, err) {
+		case exitCancelled:
+			ui.PrintWarning("Sync of %s cancelled, remaining repositories were skipped", repo.Name)
+			exit(exitCancelled)
+		case exitDrift:
+			ui.PrintError("Failed to sync %s: %v", repo.Name, err)
+			drifted++
+		case exitFailed:
+			if err != nil {
+				ui.PrintError("Failed to sync %s: %v", repo.Name, err)
+			} else {
+				ui.PrintWarning("Synced %s with conflicts", repo.Name)
+			}
+			failed++
+		case exitChanged:
+			ui.PrintSuccess("Synced %s", repo.Name)
+			changed++
+		default:
+			ui.PrintSuccess("Synced %s", repo.Name)
+		}
+	}
+
+	// Failures win over drift, drift over changes
+	if failed > 0 {
+		ui.PrintWarning("%d repositories failed to sync or have conflicts", failed)
+		exit(exitFailed)
+	}
+	if drifted > 0 {
+		ui.PrintWarning("%d repositories drifted from the lockfile", drifted)
+		exit(exitDrift)
+	}
+
+	if dryRun {
+		ui.PrintInfo("Dry run complete, %d repositories have pending changes", changed)
+	} else {
+		ui.PrintSuccess("All repositories synced successfully")
+	}
+	if changed > 0 {
+		exit(exitChanged)
+	}
+}
+
+// parseJobs parses the --jobs value
+func parseJobs(value string) int {
+	jobs, err := strconv.Atoi(value)
+	if err != nil || jobs < 1 {
+		ui.PrintError("Invalid --jobs value: %s (use a number of at least 1)", value)
+		os.Exit(exitFailed)
+	}
+	return jobs
+}
+
+// syncParallel syncs repositories in sync order with up to jobs at a time,
+// then prints a result table and exits like a sequential sync
+func syncParallel(manager *sync.Manager, repos []*models.Repository, jobs int, lockedMode bool, exit func(int)) {
+	syncFn := (*sync.Manager).SyncRepository
+	if lockedMode {
+		syncFn = (*sync.Manager).SyncRepositoryLocked
+	}
+
+	ui.PrintInfo("Syncing %d repositories, %d at a time (prompts disabled)", len(repos), jobs)
+	results := manager.SyncParallel(rootCtx, repos, jobs, syncFn)
+
+	fmt.Println()
+	fmt.Printf("  %-20s %-12s %-16s %-10s %8s\n", "Repository", "Status", "Changes", "Commit", "Time")
+	cancelled, failed, drifted, changed := 0, 0, 0, 0
+	for _, r := range results {
+		code := syncExitCode(r.Result, r.Err)
+		status := "up to date"
+		switch code {
+		case exitCancelled:
+			status = "cancelled"
+			cancelled++
+		case exitDrift:
+			status = "drift"
+			drifted++
+		case exitFailed:
+			status = "failed"
+			if r.Err == nil {
+				status = "conflicts"
+			} else if errors.Is(r.Err, sync.ErrDependencyFailed) {
+				status = "skipped"
+			}
+			failed++
+		case exitChanged:
+			status = "changed"
+			if dryRun {
+				status = "pending"
+			}
+			changed++
+		}
+
+		changes, commit := "-", "-"
+		if r.Result != nil {
+			added, modified, deleted := countChanges(r.Result.Changes)
+			changes = fmt.Sprintf("+%d ~%d -%d", added, modified, deleted)
+			if len(r.Result.Commit) >= 8 {
+				commit = r.Result.Commit[:8]
+			}
+		}
+		fmt.Printf("  %-20s %-12s %-16s %-10s %8s\n", r.Repository.Name, status, changes, commit, r.Duration.Round(100*time.Millisecond))
+	}
+	fmt.Println()
+
+	for _, r := range results {
+		if r.Err != nil {
+			ui.PrintError("%s: %v", r.Repository.Name, r.Err)
+		}
+	}
+
+	// Cancellation wins over failures, failures over drift, drift over changes
+	switch {
+	case cancelled > 0:
+		ui.PrintWarning("%d repositories were cancelled", cancelled)
+		exit(exitCancelled)
+	case failed > 0:
+		ui.PrintWarning("%d repositories failed to sync or have conflicts", failed)
+		exit(exitFailed)
+	case drifted > 0:
+		ui.PrintWarning("%d repositories drifted from the lockfile", drifted)
+		exit(exitDrift)
+	case dryRun:
+		ui.PrintInfo("Dry run complete, %d repositories have pending changes", changed)
+	default:
+		ui.PrintSuccess("All repositories synced successfully")
+	}
+	if changed > 0 {
+		exit(exitChanged)
+	}
+}
+
+// countChanges counts added, modified and deleted files
+func countChanges(changes []models.FileChange) (added, modified, deleted int) {
+	for _, change := range changes {
+		switch change.ChangeType {
+		case models.ChangeTypeAdded:
+			added++
+		case models.ChangeTypeModified:
+			modified++
+		case models.ChangeTypeDeleted:
+			deleted++
+		}
+	}
+	return added, modified, deleted
+}
+
+// listCommand lists all repositories
+func listCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	manager := newManager(cfg)
+	manager.UpdateAllStatuses(rootCtx)
+
+	ui.PrintRepositoryList(cfg.Repositories)
+}
+
+// addCommand adds a new repository
+func addCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	ui.PrintInfo("Add a new repository (following IntelliJ plugin model)")
+	fmt.Println()
+
+	// Prompt for repository details
+	name, err := ui.PromptInput("Repository name", "", false)
+	if err != nil {
+		ui.PrintError("Input cancelled")
+		os.Exit(0)
+	}
+
+	url, err := ui.PromptInput("Repository URL", "", false)
+	if err != nil {
+		ui.PrintError("Input cancelled")
+		os.Exit(0)
+	}
+
+	branch, err := ui.PromptInput("Branch", "main", false)
+	if err != nil {
+		ui.PrintError("Input cancelled")
+		os.Exit(0)
+	}
+
+	sourceDir, err := ui.PromptInput("Source directory (in remote repo, empty for root)", "", false)
+	if err != nil {
+		ui.PrintError("Input cancelled")
+		os.Exit(0)
+	}
+
+	targetDir, err := ui.PromptInput("Target directory (local project path)", "", false)
+	if err != nil {
+		ui.PrintError("Input cancelled")
+		os.Exit(0)
+	}
+
+	// Optional: File patterns
+	ui.PrintInfo("File patterns to sync (e.g., *.proto, *.go, src/**/*.js)")
+	ui.PrintInfo("Use * to sync all files, or comma-separated patterns")
+	patternsInput, err := ui.PromptInput("Patterns", "*", false)
+	if err != nil {
+		patternsInput = "*"
+	}
+	filePatterns := []string{patternsInput}
+	if patternsInput != "*" {
+		filePatterns = strings.Split(patternsInput, ",")
+		for i := range filePatterns {
+			filePatterns[i] = strings.TrimSpace(filePatterns[i])
+		}
+	}
+
+	// Optional: Exclude patterns
+	ui.PrintInfo("Files to exclude (e.g., *.log, node_modules/, .git/)")
+	excludeInput, err := ui.PromptInput("Exclude patterns (comma-separated, optional)", "", false)
+	if err != nil {
+		excludeInput = ""
+	}
+	var excludePatterns []string
+	if excludeInput != "" {
+		excludePatterns = strings.Split(excludeInput, ",")
+		for i := range excludePatterns {
+			excludePatterns[i] = strings.TrimSpace(excludePatterns[i])
+		}
+	}
+
+	// Authentication configuration
+	var repoType, username, password string
+	var secret *credentials.Credential
+
+	// Detect repo type from URL
+	if strings.HasPrefix(url, "git@") || strings.HasPrefix(url, "ssh://") {
+		repoType = "SSH"
+		ui.PrintInfo("SSH URL detected - using SSH key authentication")
+	} else if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
+		repoType = "HTTPS"
+		ui.PrintInfo("HTTPS URL detected")
+
+		// Ask for credentials; tokens never end up in config.yml in plain text
+		if ui.ConfirmAction("Does this repository require authentication?") {
+			ui.PrintInfo("For private repositories, enter your credentials")
+			ui.PrintInfo("You can use a Personal Access Token as password")
+			ui.PrintInfo("Without a token here, ~/.netrc and git credential helpers are used")
+
+			username, err = ui.PromptInput("Username (or 'git' for token auth)", "", false)
+			if err != nil {
+				username = ""
+			}
+
+			envName, _ := ui.PromptInput("Environment variable holding the token (empty to enter it now)", "", false)
+			if envName = strings.TrimSpace(strings.Trim(envName, "${}")); envName != "" {
+				password = "${" + envName + "}"
+			} else if token, err := ui.PromptInput("Password or Personal Access Token (stored encrypted)", "", true); err == nil && token != "" {
+				secret = &credentials.Credential{Username: username, Password: token}
+			}
+		}
+	} else {
+		repoType = "SSH" // Default to SSH for unknown formats
+	}
+
+	// Auto sync configuration
+	enableAutoSync := ui.ConfirmAction("Enable auto-sync?")
+	var autoSync *models.AutoSyncConfig
+	if enableAutoSync {
+		intervalStr, _ := ui.PromptInput("Auto-sync interval (seconds)", "300", false)
+		interval := 300
+		if i, err := strconv.Atoi(intervalStr); err == nil {
+			interval = i
+		}
+		autoSync = &models.AutoSyncConfig{
+			Enabled:  true,
+			Interval: interval,
+		}
+	}
+
+	// Watch mode configuration
+	enableWatchMode := ui.ConfirmAction("Enable watch mode (auto-sync on file changes)?")
+
+	// Post-sync commands
+	var postSyncCommands []models.PostSyncCommand
+	ui.PrintInfo("Post-sync commands run AFTER files are synced (e.g., build, compile)")
+	if ui.ConfirmAction("Add post-sync commands?") {
+		for {
+			cmdDir, err := ui.PromptInput("Command directory", targetDir, false)
+			if err != nil {
+				break
+			}
+			ui.PrintInfo("Example: protoc --dart_out=grpc:. -I. *.proto")
+			cmd, err := ui.PromptInput("Command to run", "", false)
+			if err != nil {
+				break
+			}
+			orderStr, _ := ui.PromptInput("Execution order", fmt.Sprintf("%d", len(postSyncCommands)), false)
+			order := len(postSyncCommands)
+			if o, err := strconv.Atoi(orderStr); err == nil {
+				order = o
+			}
+
+			postSyncCommands = append(postSyncCommands, models.PostSyncCommand{
+				Directory: cmdDir,
+				Command:   cmd,
+				Order:     order,
+			})
+
+			if !ui.ConfirmAction("Add another command?") {
+				break
+			}
+		}
+	}
+
+	// Create repository
+	repo := models.Repository{
+		Name:             name,
+		URL:              url,
+		Branch:           branch,
+		SourceDirectory:  sourceDir,
+		TargetDirectory:  targetDir,
+		LocalPath:        targetDir, // LocalPath is same as TargetDirectory
+		FilePatterns:     filePatterns,
+		ExcludePatterns:  excludePatterns,
+		SyncPatterns:     filePatterns,    // SyncPatterns is same as FilePatterns
+		Exclude:          excludePatterns, // Exclude is same as ExcludePatterns
+		WatchMode:        enableWatchMode,
+		AutoSync:         autoSync,
+		BackupConfig:     &models.BackupConfig{Enabled: true, MaxBackups: 10},
+		PostSyncCommands: postSyncCommands,
+		RepoType:         repoType,
+		Username:         username,
+		Password:         password,
+	}
+
+	if err := cfg.AddRepository(repo); err != nil {
+		ui.PrintError("Failed to add repository: %v", err)
+		os.Exit(1)
+	}
+
+	if secret != nil {
+		if err := storeSecret(name, *secret); err != nil {
+			ui.PrintError("Failed to store token: %v", err)
+			ui.PrintInfo("Store it later with: stack-sync secrets set %s", name)
+		} else {
+			ui.PrintSuccess("Token stored encrypted in %s", credentials.SecretsPath())
+		}
+	}
+
+	ui.PrintSuccess("Repository added: %s", name)
+	fmt.Println()
+	ui.PrintInfo(globalI18n.T(i18n.MsgConfiguration))
+	fmt.Printf("  %s: %s\n", globalI18n.T(i18n.MsgRepositoryName), repo.Name)
+	fmt.Printf("  %s: %s @ %s\n", globalI18n.T(i18n.MsgRepositoryURL), repo.URL, repo.Branch)
+	fmt.Printf("  %s: %s\n", globalI18n.T(i18n.MsgRepositorySource), repo.SourceDirectory)
+	fmt.Printf("  %s: %s\n", globalI18n.T(i18n.MsgRepositoryTarget), repo.TargetDirectory)
+	fmt.Printf("  %s: %v\n", globalI18n.T(i18n.MsgRepositoryPatterns), repo.FilePatterns)
+	if len(repo.ExcludePatterns) > 0 {
+		fmt.Printf("  %s: %v\n", globalI18n.T(i18n.MsgRepositoryExclude), repo.ExcludePatterns)
+	}
+	if repo.WatchMode {
+		fmt.Printf("  %s\n", globalI18n.T(i18n.MsgWatchModeEnabled))
+	}
+	if repo.AutoSync != nil && repo.AutoSync.Enabled {
+		fmt.Printf("  %s\n", globalI18n.T(i18n.MsgAutoSyncInterval, repo.AutoSync.Interval))
+	}
+	if len(repo.PostSyncCommands) > 0 {
+		fmt.Printf("  %s\n", globalI18n.T(i18n.MsgPostSyncCommands, len(repo.PostSyncCommands)))
+	}
+	fmt.Println()
+
+	// Ask if user wants to sync now
+	if ui.ConfirmAction(globalI18n.T(i18n.MsgSyncNow)) {
+		manager := newManager(cfg)
+		repoPtr, _ := cfg.GetRepository(name)
+
+		ui.PrintInfo("Syncing %s...", name)
+		if _, err := manager.SyncRepository(rootCtx, repoPtr); err != nil {
+			ui.PrintError("Sync failed: %v", err)
+			os.Exit(1)
+		}
+
+		ui.PrintSuccess("Repository synced successfully")
+	}
+}
+
+// removeCommand removes a repository
+func removeCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) < 3 {
+		ui.PrintError("Usage: stack-sync remove <repository-name>")
+		os.Exit(1)
+	}
+
+	repoName := os.Args[2]
+
+	if !ui.ConfirmAction(fmt.Sprintf("Remove repository '%s' from config?", repoName)) {
+		ui.PrintInfo("Cancelled")
+		return
+	}
+
+	if err := cfg.RemoveRepository(repoName); err != nil {
+		ui.PrintError("Failed to remove repository: %v", err)
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess("Repository removed: %s", repoName)
+	ui.PrintWarning("Note: Local files were not deleted. Remove manually if needed.")
+}
+
+// statusCommand shows detailed status of a repository
+func statusCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) < 3 {
+		// Show status of all repositories
+		listCommand()
+		return
+	}
+
+	repoName := os.Args[2]
+	repo, err := cfg.GetRepository(repoName)
+	if err != nil {
+		ui.PrintError("Repository not found: %s", repoName)
+		os.Exit(1)
+	}
+
+	manager := newManager(cfg)
+	if err := manager.UpdateRepositoryStatus(rootCtx, repo); err != nil {
+		ui.PrintWarning("Failed to check the remote: %v", err)
+	}
+
+	info, err := manager.GetRepositoryInfo(repo)
+	if err != nil {
+		ui.PrintError("Failed to get repository info: %v", err)
+		os.Exit(1)
+	}
+
+	// Print detailed info
+	fmt.Println()
+	fmt.Println(globalI18n.T(i18n.MsgStatusDisplay))
+	fmt.Println(globalI18n.T(i18n.MsgStatusSeparator))
+	for key, value := range info {
+		fmt.Printf("%-15s: %v\n", key, value)
+	}
+	if len(repo.ModifiedFiles) > 0 {
+		fmt.Println()
+		fmt.Println("Edited locally since the last sync:")
+		for _, path := range repo.ModifiedFiles {
+			fmt.Printf("    %s\n", path)
+		}
+	}
+	fmt.Println()
+}
+
+// watchCommand starts the file watcher
+func watchCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	// Check if any repository has watch mode enabled
+	hasWatchRepo := false
+	for _, repo := range cfg.Repositories {
+		if repo.WatchMode {
+			hasWatchRepo = true
+			break
+		}
+	}
+
+	if !hasWatchRepo {
+		ui.PrintWarning("No repositories have watch mode enabled")
+		ui.PrintInfo("Enable watch mode in the config file or add a repository with watch mode")
+		os.Exit(0)
+	}
+
+	manager := newManager(cfg)
+	// Auto-syncs run in the background, there is nobody to answer prompts
+	manager.SetNonInteractive(true)
+	watcher, err := sync.NewWatcher(manager)
+	if err != nil {
+		ui.PrintError("Failed to create watcher: %v", err)
+		os.Exit(1)
+	}
+
+	if err := watcher.Start(rootCtx); err != nil {
+		ui.PrintError("Failed to start watcher: %v", err)
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess("File watcher started. Press Ctrl+C to stop.")
+
+	// Wait for interrupt signal, then let running auto-syncs wind down
+	<-rootCtx.Done()
+	ui.PrintInfo("Stopping watcher...")
+	if err := watcher.Stop(); err != nil {
+		ui.PrintWarning("Failed to stop watcher cleanly: %v", err)
+	}
+}
+
+// historyCommand shows sync history
+func historyCommand() {
+	var repoName string
+	var limit int = 10
+
+	// Parse arguments
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-n" && i+1 < len(args) {
+			if l, err := strconv.Atoi(args[i+1]); err == nil {
+				limit = l
+			}
+			i++
+		} else if !strings.HasPrefix(arg, "-") {
+			repoName = arg
+		}
+	}
+
+	var histories []models.SyncHistory
+	var err error
+
+	if repoName != "" {
+		histories, err = sync.GetHistoryForRepository(repoName, limit)
+		if err != nil {
+			ui.PrintError("Failed to load history: %v", err)
+			os.Exit(1)
+		}
+	} else {
+		histories, err = sync.GetAllHistory(limit)
+		if err != nil {
+			ui.PrintError("Failed to load history: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(histories) == 0 {
+		if repoName != "" {
+			ui.PrintInfo("No sync history found for repository: %s", repoName)
+		} else {
+			ui.PrintInfo("No sync history found")
+		}
+		return
+	}
+
+	// Undos may fall outside the displayed range
+	undone := map[string]string{}
+	if all, err := sync.GetAllHistory(0); err == nil {
+		undone = sync.UndoneSyncs(all)
+	}
+
+	// Display history
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 80))
+	if repoName != "" {
+		fmt.Printf("📜 同步历史记录 - %s (Sync History - %s)\n", repoName, repoName)
+	} else {
+		fmt.Println("📜 同步历史记录 (Sync History)")
+	}
+	fmt.Println(strings.Repeat("=", 80))
+
+	for i, history := range histories {
+		fmt.Printf("\n[%d] %s\n", i+1, history.Timestamp.Format("2006-01-02 15:04:05"))
+		fmt.Printf("  仓库: %s @ %s\n", history.Repository, history.Branch)
+		fmt.Printf("  ID: %s\n", history.ID)
+		if history.UndoOf != "" {
+			fmt.Printf("  ↩️  撤销了 (Undo of): %s\n", history.UndoOf)
+		}
+		if by := undone[history.ID]; by != "" {
+			fmt.Printf("  ↩️  已被撤销 (Undone by): %s\n", by)
+		}
+		if history.CloneStrategy != "" {
+			fmt.Printf("  克隆策略: %s\n", history.CloneStrategy)
+		}
+
+		if history.Success {
+			fmt.Printf("  状态: ✅ 成功 (Success)\n")
+		} else if history.Cancelled {
+			fmt.Printf("  状态: ⏹  已取消 (Cancelled)\n")
+			if history.Error != "" {
+				fmt.Printf("  错误: %s\n", history.Error)
+			}
+		} else if history.RolledBack {
+			fmt.Printf("  状态: ↩️  已回滚 (Rolled back)\n")
+			if history.Error != "" {
+				fmt.Printf("  错误: %s\n", history.Error)
+			}
+		} else {
+			fmt.Printf("  状态: ❌ 失败 (Failed)\n")
+			if history.Error != "" {
+				fmt.Printf("  错误: %s\n", history.Error)
+			}
+		}
+
+		fmt.Printf("  总文件数: %d\n", history.TotalFiles)
+		if history.AddedCount > 0 {
+			fmt.Printf("  ✅ 新增: %d\n", history.AddedCount)
+		}
+		if history.ModifiedCount > 0 {
+			fmt.Printf("  🔄 修改: %d\n", history.ModifiedCount)
+		}
+		if history.DeletedCount > 0 {
+			fmt.Printf("  ❌ 删除: %d\n", history.DeletedCount)
+		}
+		if history.UnchangedCount > 0 {
+			fmt.Printf("  ⏸  未变更: %d\n", history.UnchangedCount)
+		}
+		fmt.Printf("  耗时: %d ms\n", history.Duration)
+
+		// Show file changes if there are any, unchanged files aren't changes
+		var changes []models.FileChange
+		for _, change := range history.FileChanges {
+			if change.ChangeType != models.ChangeTypeUnchanged {
+				changes = append(changes, change)
+			}
+		}
+		if len(changes) > 0 && len(changes) <= 20 {
+			fmt.Println("  变更文件:")
+			for _, change := range changes {
+				var icon string
+				switch change.ChangeType {
+				case models.ChangeTypeAdded:
+					icon = "✅"
+				case models.ChangeTypeModified:
+					icon = "🔄"
+				case models.ChangeTypeDeleted:
+					icon = "❌"
+				}
+				fmt.Printf("    %s %s\n", icon, change.Path)
+			}
+		} else if len(changes) > 20 {
+			fmt.Printf("  变更文件: (显示前20个，共%d个)\n", len(changes))
+			for i, change := range changes {
+				if i >= 20 {
+					break
+				}
+				var icon string
+				switch change.ChangeType {
+				case models.ChangeTypeAdded:
+					icon = "✅"
+				case models.ChangeTypeModified:
+					icon = "🔄"
+				case models.ChangeTypeDeleted:
+					icon = "❌"
+				}
+				fmt.Printf("    %s %s\n", icon, change.Path)
+			}
+		}
+
+		if i < len(histories)-1 {
+			fmt.Println(strings.Repeat("-", 80))
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 80))
+}
+
+// outdatedCommand lists pinned repositories that lag behind newer matching tags
+func outdatedCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	var repos []*models.Repository
+	for _, name := range os.Args[2:] {
+		repo, err := cfg.GetRepository(name)
+		if err != nil {
+			ui.PrintError("Repository not found: %s", name)
+			os.Exit(1)
+		}
+		repos = append(repos, repo)
+	}
+	if len(repos) == 0 {
+		for i := range cfg.Repositories {
+			if cfg.Repositories[i].Ref != "" {
+				repos = append(repos, &cfg.Repositories[i])
+			}
+		}
+	}
+
+	if len(repos) == 0 {
+		ui.PrintInfo("No repositories are pinned to a ref")
+		return
+	}
+
+	manager := newManager(cfg)
+
+	fmt.Println()
+	fmt.Printf("  %-20s %-12s %-12s %-12s %-12s\n", "Repository", "Ref", "Current", "Wanted", "Latest")
+	fmt.Println(strings.Repeat("─", 80))
+
+	outdated := 0
+	for _, repo := range repos {
+		info, err := manager.CheckOutdated(rootCtx, repo)
+		if err != nil {
+			ui.PrintError("%s: %v", repo.Name, err)
+			outdated++
+			continue
+		}
+
+		line := fmt.Sprintf("  %-20s %-12s %-12s %-12s %-12s", info.Repository, info.Ref, info.Current, info.Wanted, info.Latest)
+		if info.Outdated {
+			outdated++
+			ui.PrintWarning("%s", line[2:])
+		} else {
+			fmt.Println(line)
+		}
+	}
+	fmt.Println(strings.Repeat("─", 80))
+	fmt.Println()
+
+	if outdated > 0 {
+		ui.PrintWarning("%d repositories are outdated", outdated)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("All pinned repositories are up to date")
+}
+
+// undoCommand reverts a recorded sync
+func undoCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	var repoName, id string
+	yes, force := false, false
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--id" && i+1 < len(args):
+			id = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--id="):
+			id = strings.TrimPrefix(arg, "--id=")
+		case arg == "-y" || arg == "--yes":
+			yes = true
+		case arg == "--force":
+			force = true
+		case !strings.HasPrefix(arg, "-"):
+			repoName = arg
+		}
+	}
+
+	entry, err := sync.FindSyncToUndo(repoName, id)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	repo, err := cfg.GetRepository(entry.Repository)
+	if err != nil {
+		ui.PrintError("Repository not found: %s", entry.Repository)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Undoing sync %s of %s from %s\n", entry.ID, repo.Name, entry.Timestamp.Format("2006-01-02 15:04:05"))
+	if !dryRun && !yes && stdinIsTerminal() && !ui.ConfirmAction(fmt.Sprintf("Revert the changes this sync made to %s?", repo.TargetDirectory)) {
+		ui.PrintInfo("Cancelled")
+		return
+	}
+
+	manager := newManager(cfg)
+	manager.SetNonInteractive(true)
+	manager.SetForce(force)
+
+	result, err := manager.UndoSync(rootCtx, repo, entry)
+	if err != nil {
+		ui.PrintError("Failed to undo sync: %v", err)
+		os.Exit(1)
+	}
+
+	if dryRun {
+		for _, change := range result.Changes {
+			fmt.Printf("  %s %s\n", backupChangeMarker(change.ChangeType), change.Path)
+		}
+		ui.PrintInfo("Would revert %d files", len(result.Changes))
+		return
+	}
+	if len(result.Changes) > 0 {
+		ui.PrintSuccess("Undid sync %s of %s (%d files)", entry.ID, repo.Name, len(result.Changes))
+	}
+}
+
+// checkCommand reports drift between target directories and their remote source without writing
+func checkCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(exitFailed)
+	}
+
+	format := "text"
+	var repos []*models.Repository
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--format" && i+1 < len(args) {
+			format = args[i+1]
+			i++
+		} else if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+		} else if !strings.HasPrefix(arg, "-") {
+			repo, err := cfg.GetRepository(arg)
+			if err != nil {
+				ui.PrintError("Repository not found: %s", arg)
+				os.Exit(exitFailed)
+			}
+			repos = append(repos, repo)
+		}
+	}
+
+	if format != "text" && format != "json" {
+		ui.PrintError("Unknown format: %s (use text or json)", format)
+		os.Exit(exitFailed)
+	}
+
+	if len(repos) == 0 {
+		for i := range cfg.Repositories {
+			repos = append(repos, &cfg.Repositories[i])
+		}
+	}
+
+	manager := newManager(cfg)
+	manager.SetNonInteractive(true)
+
+	// Keep stdout clean for the JSON document, progress goes to stderr
+	if format == "json" {
+		manager.SetOutput(os.Stderr)
+	}
+
+	reports := []*sync.DriftReport{}
+	failed, drifted := 0, 0
+	for _, repo := range repos {
+		report, err := manager.CheckDrift(rootCtx, repo)
+		if err != nil {
+			failed++
+			report = sync.NewDriftReport(repo)
+			report.Error = err.Error()
+		} else if report.HasDrift() {
+			drifted++
+		}
+		reports = append(reports, report)
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to marshal report: %v\n", err)
+			os.Exit(exitFailed)
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Println()
+		for _, report := range reports {
+			printDriftReport(report)
+		}
+		fmt.Println()
+	}
+
+	if failed > 0 {
+		if format == "text" {
+			ui.PrintError("%d repositories could not be checked", failed)
+		}
+		os.Exit(exitFailed)
+	}
+	if drifted > 0 {
+		if format == "text" {
+			ui.PrintWarning("%d repositories have drifted from their remote", drifted)
+		}
+		os.Exit(exitDrift)
+	}
+	if format == "text" {
+		ui.PrintSuccess("All repositories match their remote")
+	}
+}
+
+// printDriftReport prints the files that differ for one repository
+func printDriftReport(report *sync.DriftReport) {
+	revision := report.Revision
+	if len(report.Commit) >= 8 {
+		revision = fmt.Sprintf("%s (%s)", report.Revision, report.Commit[:8])
+	}
+
+	switch {
+	case report.Error != "":
+		ui.PrintError("%s: %s", report.Repository, report.Error)
+	case !report.HasDrift():
+		ui.PrintSuccess("%s matches %s", report.Repository, revision)
+	default:
+		ui.PrintWarning("%s differs from %s: %d added, %d modified, %d deleted",
+			report.Repository, revision, len(report.Added), len(report.Modified), len(report.Deleted))
+		for _, path := range report.Added {
+			fmt.Printf("    [A] %s\n", path)
+		}
+		for _, path := range report.Modified {
+			fmt.Printf("    [M] %s\n", path)
+		}
+		for _, path := range report.Deleted {
+			fmt.Printf("    [D] %s\n", path)
+		}
+	}
+}
+
+// cacheCommand manages the local mirror cache
+func cacheCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	subcommand := "list"
+	var args []string
+	if len(os.Args) > 2 {
+		subcommand = os.Args[2]
+		args = os.Args[3:]
+	}
+
+	cacheDir := cfg.GetCacheDir()
+
+	switch subcommand {
+	case "list", "ls":
+		mirrors, err := git.ListMirrors(cacheDir)
+		if err != nil {
+			ui.PrintError("Failed to list cache: %v", err)
+			os.Exit(1)
+		}
+		if len(mirrors) == 0 {
+			ui.PrintInfo("Cache is empty: %s", cacheDir)
+			return
+		}
+
+		fmt.Println()
+		fmt.Printf("Cached mirrors (%s):\n", cacheDir)
+		fmt.Println(strings.Repeat("─", 80))
+		var total int64
+		for _, mirror := range mirrors {
+			total += mirror.Size
+			fmt.Printf("  %-20s %10s  %s  %s\n",
+				mirror.Name,
+				formatSize(mirror.Size),
+				mirror.LastFetched.Format("2006-01-02 15:04:05"),
+				mirror.URL,
+			)
+		}
+		fmt.Println(strings.Repeat("─", 80))
+		fmt.Printf("\nTotal: %d mirrors, %s\n\n", len(mirrors), formatSize(total))
+
+	case "prune":
+		// Without arguments only mirrors of repositories no longer configured are removed
+		pruneAll := false
+		var names []string
+		for _, arg := range args {
+			if arg == "--all" {
+				pruneAll = true
+			} else if !strings.HasPrefix(arg, "-") {
+				names = append(names, arg)
+			}
+		}
+
+		mirrors, err := git.ListMirrors(cacheDir)
+		if err != nil {
+			ui.PrintError("Failed to list cache: %v", err)
+			os.Exit(1)
+		}
+
+		configured := make(map[string]bool)
+		for _, repo := range cfg.Repositories {
+			configured[filepath.Base(git.MirrorPath(cacheDir, repo.Name))] = true
+		}
+		requested := make(map[string]bool)
+		for _, name := range names {
+			requested[filepath.Base(git.MirrorPath(cacheDir, name))] = true
+		}
+
+		removed := 0
+		for _, mirror := range mirrors {
+			remove := pruneAll
+			if len(names) > 0 {
+				remove = requested[mirror.Name]
+			} else if !pruneAll {
+				remove = !configured[mirror.Name]
+			}
+			if !remove {
+				continue
+			}
+
+			if err := os.RemoveAll(mirror.Path); err != nil {
+				ui.PrintError("Failed to remove %s: %v", mirror.Name, err)
+				continue
+			}
+			ui.PrintSuccess("Removed %s (%s)", mirror.Name, formatSize(mirror.Size))
+			removed++
+		}
+
+		if removed == 0 {
+			ui.PrintInfo("Nothing to prune")
+		}
+
+	case "verify":
+		mirrors, err := git.ListMirrors(cacheDir)
+		if err != nil {
+			ui.PrintError("Failed to list cache: %v", err)
+			os.Exit(1)
+		}
+
+		failed := 0
+		for _, mirror := range mirrors {
+			if err := git.VerifyMirror(mirror.Path); err != nil {
+				ui.PrintError("%s: %v", mirror.Name, err)
+				failed++
+			} else {
+				ui.PrintSuccess("%s: OK", mirror.Name)
+			}
+		}
+
+		if failed > 0 {
+			ui.PrintWarning("%d mirrors failed verification, run 'stack-sync cache prune <name>' to drop them", failed)
+			os.Exit(1)
+		}
+
+	default:
+		ui.PrintError("Usage: stack-sync cache [list|prune [repo...|--all]|verify]")
+		os.Exit(1)
+	}
+}
+
+// backupCommand lists, inspects, restores and prunes the backups of a repository
+func backupCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	subcommand := "list"
+	var args []string
+	if len(os.Args) > 2 {
+		subcommand = os.Args[2]
+		args = os.Args[3:]
+	}
+
+	// Parse flags, the repository, an optional backup name and files
+	yes, force, nameOnly := false, false, false
+	keep := -1
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-y" || arg == "--yes":
+			yes = true
+		case arg == "--force":
+			force = true
+		case arg == "--name-only":
+			nameOnly = true
+		case arg == "--keep" && i+1 < len(args):
+			keep, err = strconv.Atoi(args[i+1])
+			if err != nil || keep < 1 {
+				ui.PrintError("Invalid --keep value: %s", args[i+1])
+				os.Exit(1)
+			}
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			positional = append(positional, arg)
+		}
+	}
+
+	usage := "Usage: stack-sync backup [list|show|diff|restore|prune] <repo> [backup] [file...]"
+	if len(positional) == 0 {
+		ui.PrintError(usage)
+		os.Exit(1)
+	}
+	repo, err := cfg.GetRepository(positional[0])
+	if err != nil {
+		ui.PrintError("Repository not found: %s", positional[0])
+		os.Exit(1)
+	}
+	backupName, files := "", positional[1:]
+	if len(files) > 0 && sync.IsBackupName(files[0]) {
+		backupName, files = files[0], files[1:]
+	}
+
+	manager := newManager(cfg)
+	manager.SetForce(force)
+
+	switch subcommand {
+	case "list", "ls":
+		backups, err := manager.ListBackups(repo.Name)
+		if err != nil {
+			ui.PrintError("Failed to list backups: %v", err)
+			os.Exit(1)
+		}
+		if len(backups) == 0 {
+			ui.PrintInfo("No backups of %s in %s", repo.Name, manager.GetBackupRoot(repo.Name))
+			return
+		}
+
+		fmt.Println()
+		fmt.Printf("Backups of %s (%s):\n", repo.Name, manager.GetBackupRoot(repo.Name))
+		fmt.Println(strings.Repeat("─", 80))
+		var total int64
+		for _, backup := range backups {
+			total += backup.Size
+			fmt.Printf("  %-20s %s  %10s  %d files\n",
+				backup.Name,
+				backup.CreatedAt.Format("2006-01-02 15:04:05"),
+				formatSize(backup.Size),
+				backup.Files,
+			)
+		}
+		fmt.Println(strings.Repeat("─", 80))
+		fmt.Printf("\nTotal: %d backups, %s\n\n", len(backups), formatSize(total))
+
+	case "show":
+		backup := findBackup(manager, repo, backupName)
+		fmt.Println()
+		fmt.Printf("Backup %s of %s\n", backup.Name, repo.Name)
+		fmt.Printf("  Path:    %s\n", backup.Path)
+		fmt.Printf("  Created: %s\n", backup.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("  Size:    %s, %d files\n", formatSize(backup.Size), backup.Files)
+		if backup.Manifest.Compression != "" {
+			fmt.Printf("  Compression: %s\n", backup.Manifest.Compression)
+		}
+		fmt.Println(strings.Repeat("─", 80))
+		for _, file := range backup.Manifest.Files {
+			fmt.Printf("  %10s  %s\n", formatSize(file.Size), file.Path)
+		}
+		for _, path := range backup.Manifest.Created {
+			fmt.Printf("  %10s  %s (created by the sync, removed on restore)\n", "new", path)
+		}
+		fmt.Println()
+
+	case "diff":
+		backup := findBackup(manager, repo, backupName)
+		changes, err := manager.DiffBackup(repo, backup)
+		if err != nil {
+			ui.PrintError("Failed to diff backup: %v", err)
+			os.Exit(1)
+		}
+
+		// Directions are those of a restore: + only in the backup, - only in the target
+		shown := 0
+		for _, change := range changes {
+			if change.ChangeType == models.ChangeTypeUnchanged || !matchesAnyPath(change.Path, files) {
+				continue
+			}
+			shown++
+			if nameOnly {
+				fmt.Printf("%s %s\n", backupChangeMarker(change.ChangeType), change.Path)
+				continue
+			}
+			fmt.Printf("\n%s %s\n", backupChangeMarker(change.ChangeType), change.Path)
+			if err := manager.ShowBackupDiff(repo, backup, change); err != nil {
+				ui.PrintError("Failed to show diff of %s: %v", change.Path, err)
+			}
+		}
+		if shown == 0 {
+			ui.PrintInfo("%s matches backup %s", repo.TargetDirectory, backup.Name)
+		}
+
+	case "restore":
+		backup := findBackup(manager, repo, backupName)
+		what := "all files"
+		if len(files) > 0 {
+			what = strings.Join(files, ", ")
+		}
+		if !dryRun && !yes && !ui.ConfirmAction(fmt.Sprintf("Restore %s of %s from backup %s into %s?", what, repo.Name, backup.Name, repo.TargetDirectory)) {
+			ui.PrintInfo("Cancelled")
+			return
+		}
+
+		changes, err := manager.RestoreBackup(repo, backup, files)
+		if err != nil {
+			ui.PrintError("Failed to restore backup: %v", err)
+			os.Exit(1)
+		}
+		if len(changes) == 0 {
+			ui.PrintInfo("%s already matches backup %s", repo.TargetDirectory, backup.Name)
+			return
+		}
+		for _, change := range changes {
+			fmt.Printf("  %s %s\n", backupChangeMarker(change.ChangeType), change.Path)
+		}
+		if dryRun {
+			ui.PrintInfo("Would restore %d files from backup %s", len(changes), backup.Name)
+			return
+		}
+		ui.PrintSuccess("Restored %d files of %s from backup %s", len(changes), repo.Name, backup.Name)
+
+	case "prune":
+		if keep < 0 {
+			if repo.BackupConfig == nil || repo.BackupConfig.MaxBackups <= 0 {
+				ui.PrintError("No max_backups configured for %s, pass --keep N", repo.Name)
+				os.Exit(1)
+			}
+			keep = repo.BackupConfig.MaxBackups
+		}
+		removed, err := manager.PruneBackups(repo.Name, keep)
+		if err != nil {
+			ui.PrintError("Failed to prune backups: %v", err)
+			os.Exit(1)
+		}
+
+		for _, backup := range removed {
+			ui.PrintSuccess("Removed %s (%s)", backup.Name, formatSize(backup.Size))
+		}
+		if len(removed) == 0 {
+			ui.PrintInfo("Nothing to prune")
+		}
+
+	default:
+		ui.PrintError(usage)
+		os.Exit(1)
+	}
+}
+
+// findBackup resolves a backup name or exits
+func findBackup(manager *sync.Manager, repo *models.Repository, name string) *sync.BackupInfo {
+	backup, err := manager.FindBackup(repo.Name, name)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	return backup
+}
+
+// backupChangeMarker shows what restoring a file from a backup does to the target
+func backupChangeMarker(changeType models.FileChangeType) string {
+	switch changeType {
+	case models.ChangeTypeAdded:
+		return "+"
+	case models.ChangeTypeDeleted:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// matchesAnyPath reports whether file is one of paths or lies in one of them;
+// no paths match everything
+func matchesAnyPath(file string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, path := range paths {
+		clean := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(path)), "/")
+		if file == clean || strings.HasPrefix(file, clean+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSize formats a byte count for display
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// secretsCommand manages the encrypted secrets file
+func secretsCommand() {
+	subcommand := "list"
+	var args []string
+	if len(os.Args) > 2 {
+		subcommand = os.Args[2]
+		args = os.Args[3:]
+	}
+
+	switch subcommand {
+	case "list", "ls":
+		secrets, _, err := unlockSecrets(false)
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		if len(secrets) == 0 {
+			ui.PrintInfo("No secrets stored in %s", credentials.SecretsPath())
+			return
+		}
+
+		names := make([]string, 0, len(secrets))
+		for name := range secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Println()
+		fmt.Printf("Secrets (%s):\n", credentials.SecretsPath())
+		for _, name := range names {
+			username := secrets[name].Username
+			if username == "" {
+				username = "-"
+			}
+			fmt.Printf("  %-20s %s\n", name, username)
+		}
+		fmt.Println()
+
+	case "set":
+		if len(args) == 0 {
+			ui.PrintError("Usage: stack-sync secrets set <repo>")
+			os.Exit(1)
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			ui.PrintError("Failed to load config: %v", err)
+			os.Exit(1)
+		}
+		repo, err := cfg.GetRepository(args[0])
+		if err != nil {
+			ui.PrintError("Repository not found: %s", args[0])
+			os.Exit(1)
+		}
+
+		username, err := ui.PromptInput("Username (empty for the repository's username)", "", false)
+		if err != nil {
+			ui.PrintError("Input cancelled")
+			os.Exit(0)
+		}
+		token, err := ui.PromptInput("Password or Personal Access Token", "", true)
+		if err != nil || token == "" {
+			ui.PrintError("Input cancelled")
+			os.Exit(0)
+		}
+
+		if err := storeSecret(repo.Name, credentials.Credential{Username: username, Password: token}); err != nil {
+			ui.PrintError("Failed to store token: %v", err)
+			os.Exit(1)
+		}
+		ui.PrintSuccess("Stored credentials for %s in %s", repo.Name, credentials.SecretsPath())
+
+	case "remove", "rm":
+		if len(args) == 0 {
+			ui.PrintError("Usage: stack-sync secrets remove <repo>")
+			os.Exit(1)
+		}
+		secrets, passphrase, err := unlockSecrets(false)
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		if _, ok := secrets[args[0]]; !ok {
+			ui.PrintError("No secret stored for %s", args[0])
+			os.Exit(1)
+		}
+		delete(secrets, args[0])
+		if err := secrets.Save(credentials.SecretsPath(), passphrase); err != nil {
+			ui.PrintError("Failed to save secrets: %v", err)
+			os.Exit(1)
+		}
+		ui.PrintSuccess("Removed credentials for %s", args[0])
+
+	default:
+		ui.PrintError("Unknown secrets command: %s (use list, set or remove)", subcommand)
+		os.Exit(1)
+	}
+}
+
+// doctorTimeout bounds the ls-remote of repositories without network_timeout
+const doctorTimeout = 30 * time.Second
+
+// doctorCommand checks that each repository's proxy, TLS and credential
+// settings can reach its remote. --url points the settings at another server,
+// e.g. a local stand-in for the real one.
+func doctorCommand() {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	var overrideURL string
+	var repos []*models.Repository
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--url" && i+1 < len(args) {
+			overrideURL = args[i+1]
+			i++
+		} else if strings.HasPrefix(arg, "--url=") {
+			overrideURL = strings.TrimPrefix(arg, "--url=")
+		} else if !strings.HasPrefix(arg, "-") {
+			repo, err := cfg.GetRepository(arg)
+			if err != nil {
+				ui.PrintError("Repository not found: %s", arg)
+				os.Exit(1)
+			}
+			repos = append(repos, repo)
+		} else {
+			ui.PrintError("Unknown option: %s", arg)
+			os.Exit(1)
+		}
+	}
+
+	if len(repos) == 0 {
+		for i := range cfg.Repositories {
+			repos = append(repos, &cfg.Repositories[i])
+		}
+	}
+	if len(repos) == 0 {
+		ui.PrintWarning("No repositories configured")
+		return
+	}
+
+	failed := 0
+	fmt.Println()
+	for _, repo := range repos {
+		if overrideURL != "" {
+			// Work on a copy so the override never reaches the config file
+			copied := *repo
+			copied.URL = overrideURL
+			repo = &copied
+		}
+		if !doctorRepository(repo, cfg.Settings.NetworkConfig) {
+			failed++
+		}
+		fmt.Println()
+	}
+
+	if failed > 0 {
+		ui.PrintError("%d of %d repositories can't reach their remote", failed, len(repos))
+		os.Exit(1)
+	}
+	ui.PrintSuccess("All repositories reach their remote")
+}
+
+// doctorRepository prints the network settings of one repository and lists
+// its remote refs with them, reporting whether that worked
+func doctorRepository(repo *models.Repository, defaults models.NetworkConfig) bool {
+	fmt.Printf("%s (%s)\n", repo.Name, repo.URL)
+	network := defaults.Merge(repo.NetworkConfig)
+
+	proxy, source, err := git.ProxyFor(repo.URL, network.Proxy)
+	switch {
+	case err != nil:
+		ui.PrintError("Proxy: %v", err)
+		return false
+	case proxy == nil:
+		fmt.Println("  Proxy:       direct")
+	default:
+		fmt.Printf("  Proxy:       %s (%s)\n", proxy.Redacted(), source)
+	}
+
+	if network.CABundle != "" {
+		fmt.Printf("  CA bundle:   %s\n", network.CABundle)
+	} else {
+		fmt.Println("  CA bundle:   system")
+	}
+	if network.ClientCert != "" {
+		fmt.Printf("  Client cert: %s\n", network.ClientCert)
+	}
+	if network.InsecureSkipTLS {
+		ui.PrintWarning("TLS certificate verification is disabled (insecure_skip_tls)")
+	}
+
+	tr, err := git.NewTransport(repo, defaults)
+	if err != nil {
+		ui.PrintError("%v", err)
+		return false
+	}
+	if tr.Auth != nil {
+		fmt.Printf("  Auth:        %s\n", tr.Auth)
+	} else {
+		fmt.Println("  Auth:        none")
+	}
+
+	timeout := repo.NetworkTimeout
+	if timeout <= 0 {
+		timeout = doctorTimeout
+	}
+	ctx, cancel := context.WithTimeout(rootCtx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	refs, err := git.ListRemoteRefs(ctx, repo, tr)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			ui.PrintError("Remote: no answer within %s: %v", timeout, err)
+		} else {
+			ui.PrintError("Remote: %v", err)
+		}
+		return false
+	}
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Name().Short() == repo.Branch {
+			ui.PrintSuccess("Remote: %d refs in %s, %s at %s", len(refs), elapsed, repo.Branch, ref.Hash().String()[:8])
+			return true
+		}
+	}
+	ui.PrintWarning("Remote: %d refs in %s, but no branch %s", len(refs), elapsed, repo.Branch)
+	return true
+}
+
+// unlockSecrets decrypts the secrets file with the passphrase from the
+// environment or a prompt. A new file's passphrase is asked twice if create.
+func unlockSecrets(create bool) (credentials.Secrets, string, error) {
+	path := credentials.SecretsPath()
+	_, statErr := os.Stat(path)
+	if os.IsNotExist(statErr) && !create {
+		return credentials.Secrets{}, "", nil
+	}
+
+	passphrase := os.Getenv(credentials.PassphraseEnv)
+	if passphrase == "" {
+		if !stdinIsTerminal() {
+			return nil, "", fmt.Errorf("set %s to unlock %s", credentials.PassphraseEnv, path)
+		}
+
+		var err error
+		passphrase, err = ui.PromptInput("Passphrase for "+path, "", true)
+		if err != nil || passphrase == "" {
+			return nil, "", fmt.Errorf("no passphrase entered")
+		}
+		if os.IsNotExist(statErr) {
+			confirm, err := ui.PromptInput("Repeat the new passphrase", "", true)
+			if err != nil || confirm != passphrase {
+				return nil, "", fmt.Errorf("passphrases don't match")
+			}
+		}
+	}
+
+	secrets, err := credentials.LoadSecrets(path, passphrase)
+	if err != nil {
+		return nil, "", err
+	}
+	return secrets, passphrase, nil
+}
+
+// storeSecret adds or replaces a repository's credentials in the secrets file
+func storeSecret(name string, cred credentials.Credential) error {
+	secrets, passphrase, err := unlockSecrets(true)
+	if err != nil {
+		return err
+	}
+	secrets[name] = cred
+	return secrets.Save(credentials.SecretsPath(), passphrase)
+}
+
+// printHelp prints usage information
+func printHelp() {
+	if globalI18n.GetLanguage() == i18n.Chinese {
+		fmt.Print(`
+Stack Sync - 开发团队文件同步工具
+
+使用方法:
+    stack-sync [命令] [选项]
+
+命令:
+    (默认)           显示交互式仓库选择器
+    init             初始化配置文件
+    sync [仓库] [-f 关键词] [-n 数字] 同步仓库或所有仓库
+    list, ls         列出所有仓库
+    add              添加新仓库（交互式）
+    remove, rm <仓库> 从配置中删除仓库
+    status [仓库]    显示仓库状态
+    watch            启动文件监控器进行自动同步
+    history [仓库] [-n 数量] 显示同步历史记录
+    cache [list|prune|verify] 管理本地镜像缓存
+    backup [list|show|diff|restore|prune] <仓库> [备份] [文件...] 管理同步前的备份
+    undo [仓库] [--id <历史ID>] 撤销最近一次（或指定的）同步
+    secrets [list|set|remove] [仓库] 管理加密保存的 HTTPS 凭据
+    doctor [仓库...] [--url <地址>] 检查代理、TLS 和凭据设置能否连接远程
+    outdated [仓库...] 列出固定版本落后于新 tag 的仓库
+    check [仓库...] [--format json] 检查目标目录是否与远程一致（不写入）
+    help, -h         显示此帮助信息
+    version, -v      显示版本信息
+
+选项:
+    -f <关键词>      在选择前按关键词过滤文件
+    -n <数字>        直接使用数字选择文件（如：77,93 或 1-5）
+    -d, --diff       进入可视化 diff 预览模式，逐文件查看后再同步
+    --locked         按目标目录中的 .stack-sync.lock 精确还原提交和文件
+    -y, --yes, --non-interactive 不提示，同步所有匹配的文件（无终端时自动启用）
+    --prune          删除上游已删除、且曾由本工具同步的文件（同 prune: true）
+    --on-conflict <策略> 本地与远程都修改过的文件: ask, keep-local, take-remote, merge
+    --force          覆盖或删除不属于本工具管理的文件，并接管其所有权
+    --dry-run        只显示将要写入、删除、备份的文件和同步后命令，不修改任何内容
+    --offline        list、status 和交互选择器不访问远程，按本地镜像缓存判断状态
+    -a, --all        同步所有仓库（不指定仓库时的默认行为）
+    -g, --group <名称> 只同步该分组或带该标签的仓库，按 depends_on 顺序
+    -j, --jobs <数量> 同时同步多个仓库；大于 1 时不提示，输出按仓库名加前缀
+
+退出码:
+    0 无变更    1 失败或存在冲突    2 已应用变更（--dry-run 时为有待应用的变更）    3 检测到漂移    130 被 Ctrl+C/SIGTERM 中断
+
+示例:
+    stack-sync                    # 交互模式
+    stack-sync init              # 初始化配置
+    stack-sync add               # 添加仓库
+    stack-sync sync my-repo      # 同步指定仓库
+    stack-sync sync my-repo -f team # 同步仓库，按 'team' 过滤文件
+    stack-sync sync my-repo -n 77,93 # 同步仓库，选择第77和93个文件
+    stack-sync sync my-repo -f team -n 1-3 # 先过滤再选择前3个文件
+    stack-sync sync              # 同步所有仓库
+    stack-sync sync --yes        # CI 中同步所有仓库，不提示
+    stack-sync sync --all --jobs 4 # 同时同步 4 个仓库
+    stack-sync sync --group backend # 同步 backend 分组，依赖先同步
+    stack-sync sync my-repo --dry-run # 预览同步计划，不写入
+    stack-sync list              # 列出仓库
+    stack-sync list --offline    # 不联网，按缓存的镜像显示状态
+    stack-sync watch             # 启动自动同步监控器
+    stack-sync history           # 查看所有同步历史
+    stack-sync history my-repo   # 查看指定仓库的同步历史
+    stack-sync history my-repo -n 20 # 查看最近20条记录
+    stack-sync check --format json # 以 JSON 输出漂移检查结果
+    stack-sync cache list        # 列出缓存的镜像
+    stack-sync cache prune       # 删除未配置仓库的镜像
+    stack-sync backup list my-repo # 列出仓库的备份
+    stack-sync backup diff my-repo # 比较最新备份与当前目标目录
+    stack-sync backup restore my-repo 20240101-120000 a.proto # 从指定备份恢复单个文件
+    stack-sync undo my-repo      # 撤销 my-repo 最近一次同步
+    stack-sync doctor my-repo --url https://localhost:8443/repo.git # 用本地替身服务器测试设置
+
+更多信息，请访问: https://github.com/aa12gq/stackfilesync/stack-sync-cli
+`)
+	} else {
+		fmt.Print(`
+Stack Sync - File synchronization tool for development teams
+
+USAGE:
+    stack-sync [COMMAND] [OPTIONS]
+
+COMMANDS:
+    (default)           Show interactive repository selector
+    init               Initialize configuration file
+    sync [repo] [-f keyword] [-n numbers] Sync a repository or all repositories
+    list, ls           List all repositories
+    add                Add a new repository (interactive)
+    remove, rm <repo>  Remove a repository from config
+    status [repo]      Show repository status
+    watch              Start file watcher for auto-sync
+    history [repo] [-n limit] Show sync history
+    cache [list|prune|verify] Manage the local mirror cache
+    backup [list|show|diff|restore|prune] <repo> [backup] [file...] Manage pre-sync backups
+    undo [repo] [--id <history-id>] Revert the last (or the given) sync
+    secrets [list|set|remove] [repo] Manage HTTPS credentials in the encrypted secrets file
+    doctor [repo...] [--url <url>] Check that proxy, TLS and credential settings reach the remote
+    outdated [repo...] List pinned repositories behind newer matching tags
+    check [repo...] [--format json] Fail if target directories differ from the remote (read-only)
+    help, -h           Show this help message
+    version, -v        Show version information
+
+OPTIONS:
+    -f <keyword>       Filter files by keyword before selection
+    -n <numbers>       Directly select files by numbers (e.g., 77,93 or 1-5)
+    -d, --diff         Visual diff preview mode before syncing
+    --locked           Reproduce the exact commit and files recorded in .stack-sync.lock
+    -y, --yes, --non-interactive Sync every matching file without prompts (automatic without a terminal)
+    --prune            Delete synced files that were removed upstream (same as prune: true)
+    --on-conflict <mode> Files edited locally and upstream: ask, keep-local, take-remote, merge
+    --force            Overwrite or delete files the repository doesn't own yet and take ownership
+    --dry-run          Print planned writes, deletions, backups and post-sync commands without changing anything
+    --offline          list, status and the selector compare against the cached mirror instead of the remote
+    -a, --all          Sync every repository (the default without a repository name)
+    -g, --group <name> Sync only the repositories in a group or with a tag, in depends_on order
+    -j, --jobs <n>     Sync up to n repositories at once; above 1 there are no prompts and output is prefixed per repository
+
+EXIT CODES:
+    0 no changes    1 failed or conflicts    2 changes applied (pending with --dry-run)    3 drift detected    130 interrupted by Ctrl+C/SIGTERM
+
+EXAMPLES:
+    stack-sync                    # Interactive mode
+    stack-sync init              # Initialize config
+    stack-sync add               # Add a repository
+    stack-sync sync my-repo      # Sync specific repository
+    stack-sync sync my-repo -f team # Sync repository, filter files by 'team'
+    stack-sync sync my-repo -n 77,93 # Sync repository, select files 77 and 93
+    stack-sync sync my-repo -f team -n 1-3 # Filter by 'team', then select first 3 files
+    stack-sync sync              # Sync all repositories
+    stack-sync sync --yes        # Sync all repositories in CI, no prompts
+    stack-sync sync --all --jobs 4 # Sync 4 repositories at a time
+    stack-sync sync --group backend # Sync the backend group, dependencies first
+    stack-sync sync my-repo --dry-run # Preview the sync plan without writing
+    stack-sync list              # List repositories
+    stack-sync list --offline    # Show statuses from the cached mirrors, without the network
+    stack-sync watch             # Start auto-sync watcher
+    stack-sync history           # Show all sync history
+    stack-sync history my-repo   # Show sync history for a repository
+    stack-sync history my-repo -n 20 # Show last 20 records
+    stack-sync check --format json # Drift check with JSON output
+    stack-sync cache list        # List cached mirrors
+    stack-sync cache prune       # Remove mirrors of unconfigured repositories
+    stack-sync backup list my-repo # List backups of a repository
+    stack-sync backup diff my-repo # Compare the latest backup with the target
+    stack-sync backup restore my-repo 20240101-120000 a.proto # Restore one file from a backup
+    stack-sync undo my-repo      # Revert the last sync of my-repo
+    stack-sync doctor my-repo --url https://localhost:8443/repo.git # Test the settings against a local stand-in server
+
+For more information, visit: https://github.com/aa12gq/stackfilesync/stack-sync-cli
+`)
+	}
+}
+
+// printVersion prints version information
+func printVersion() {
+	fmt.Printf("Stack Sync CLI v%s\n", Version)
+}
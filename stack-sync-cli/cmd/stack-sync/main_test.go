@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stackfilesync/stack-sync-cli/internal/sync"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// TestMain runs the command instead of the tests when the test binary is
+// started by runCommand
+func TestMain(m *testing.M) {
+	if os.Getenv("STACK_SYNC_TEST_MAIN") == "1" {
+		main()
+		os.Exit(exitNoChanges)
+	}
+	os.Exit(m.Run())
+}
+
+// testEnv is a home directory with a config syncing the .proto files of a
+// local upstream repository into a target directory
+type testEnv struct {
+	t        *testing.T
+	home     string
+	upstream string
+	target   string
+	repo     *gogit.Repository
+}
+
+// newTestEnv creates an upstream with files and a config for it. Extra
+// repository settings are appended to the repository's config entry.
+func newTestEnv(t *testing.T, files map[string]string, extra string) *testEnv {
+	t.Helper()
+	root := t.TempDir()
+	env := &testEnv{
+		t:        t,
+		home:     filepath.Join(root, "home"),
+		upstream: filepath.Join(root, "upstream"),
+		target:   filepath.Join(root, "target"),
+	}
+
+	repo, err := gogit.PlainInitWithOptions(env.upstream, &gogit.PlainInitOptions{InitOptions: gogit.InitOptions{DefaultBranch: plumbing.Main}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.repo = repo
+	env.commit(files)
+
+	config := fmt.Sprintf(`settings:
+  backup_enabled: true
+  cache_enabled: false
+repositories:
+  - name: proto
+    url: %s
+    branch: main
+    source_directory: api
+    target_directory: %s
+    file_patterns: ["*.proto"]
+%s`, env.upstream, env.target, extra)
+	env.write(filepath.Join(env.home, ".stack-sync", "config.yml"), config)
+	return env
+}
+
+// write creates a file with content
+func (env *testEnv) write(path, content string) {
+	env.t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		env.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		env.t.Fatal(err)
+	}
+}
+
+// commit writes files to the upstream and commits them
+func (env *testEnv) commit(files map[string]string) {
+	env.t.Helper()
+	for path, content := range files {
+		env.write(filepath.Join(env.upstream, filepath.FromSlash(path)), content)
+	}
+	w, err := env.repo.Worktree()
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	if err := w.AddWithOptions(&gogit.AddOptions{All: true}); err != nil {
+		env.t.Fatal(err)
+	}
+	if _, err := w.Commit("change", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	}); err != nil {
+		env.t.Fatal(err)
+	}
+}
+
+// command prepares the command with args, stdin not being a terminal
+func (env *testEnv) command(args ...string) (*exec.Cmd, *bytes.Buffer, *bytes.Buffer) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "STACK_SYNC_TEST_MAIN=1", "HOME="+env.home, "USERPROFILE="+env.home)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	return cmd, &stdout, &stderr
+}
+
+// run runs the command with args and returns its stdout and exit code
+func (env *testEnv) run(args ...string) (string, int) {
+	env.t.Helper()
+	cmd, stdout, stderr := env.command(args...)
+	code := exitCode(env.t, cmd.Run(), stdout, stderr)
+	return stdout.String(), code
+}
+
+// exitCode returns the exit code of a finished command
+func exitCode(t *testing.T, err error, stdout, stderr *bytes.Buffer) int {
+	t.Helper()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("command failed to run: %v\n%s%s", err, stdout, stderr)
+	}
+	return 0
+}
+
+// readTarget returns the content of a target file, or "<missing>"
+func (env *testEnv) readTarget(path string) string {
+	env.t.Helper()
+	data, err := os.ReadFile(filepath.Join(env.target, filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSyncExitCode(t *testing.T) {
+	changed := &sync.SyncResult{Changes: []models.FileChange{{Path: "a.proto", ChangeType: models.ChangeTypeAdded}}}
+	unchanged := &sync.SyncResult{Changes: []models.FileChange{{Path: "a.proto", ChangeType: models.ChangeTypeUnchanged}}}
+	conflicted := &sync.SyncResult{Changes: changed.Changes, Conflicts: []string{"b.proto"}}
+
+	tests := []struct {
+		name   string
+		result *sync.SyncResult
+		err    error
+		want   int
+	}{
+		{name: "nothing to do", result: &sync.SyncResult{}, want: exitNoChanges},
+		{name: "unchanged files", result: unchanged, want: exitNoChanges},
+		{name: "changes", result: changed, want: exitChanged},
+		{name: "conflicts", result: conflicted, want: exitFailed},
+		{name: "error", err: errors.New("clone failed"), want: exitFailed},
+		{name: "lock drift", err: fmt.Errorf("sync failed: %w", sync.ErrLockDrift), want: exitDrift},
+		{name: "cancelled", err: fmt.Errorf("%w: context canceled", sync.ErrCancelled), want: exitCancelled},
+		{name: "cancelled after changes", result: changed, err: sync.ErrCancelled, want: exitCancelled},
+	}
+
+	for _, tt := range tests {
+		if got := syncExitCode(tt.result, tt.err); got != tt.want {
+			t.Errorf("%s: syncExitCode() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSyncCommandExitCodes(t *testing.T) {
+	env := newTestEnv(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"}, "")
+
+	// Without --yes and without a terminal nothing prompts
+	if _, code := env.run("sync", "proto"); code != exitChanged {
+		t.Errorf("first sync exited %d, want %d", code, exitChanged)
+	}
+	if got := env.readTarget("a.proto"); got != "a1" {
+		t.Errorf("a.proto = %q after the first sync, want a1", got)
+	}
+	if _, code := env.run("sync", "proto", "--yes"); code != exitNoChanges {
+		t.Errorf("sync without upstream changes exited %d, want %d", code, exitNoChanges)
+	}
+	if _, code := env.run("sync"); code != exitNoChanges {
+		t.Errorf("sync of all repositories without changes exited %d, want %d", code, exitNoChanges)
+	}
+
+	// --dry-run reports pending changes and writes nothing
+	env.commit(map[string]string{"api/a.proto": "a2"})
+	before, err := historyEntries(env.home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, code := env.run("--dry-run", "sync", "proto"); code != exitChanged {
+		t.Errorf("dry run with upstream changes exited %d, want %d", code, exitChanged)
+	}
+	if got := env.readTarget("a.proto"); got != "a1" {
+		t.Errorf("dry run wrote a.proto = %q", got)
+	}
+	if after, err := historyEntries(env.home); err != nil || after != before {
+		t.Errorf("%d history entries after a dry run, want %d (%v)", after, before, err)
+	}
+
+	// --locked reproduces the lockfile; a lockfile the remote no longer matches is drift
+	if _, code := env.run("sync", "proto", "--locked"); code != exitNoChanges {
+		t.Errorf("locked sync of an unchanged lockfile exited %d, want %d", code, exitNoChanges)
+	}
+	lockPath := filepath.Join(env.target, sync.LockFileName)
+	lock, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.write(lockPath, strings.Replace(string(lock), sha256Hex("a1"), sha256Hex("tampered"), 1))
+	if _, code := env.run("sync", "proto", "--locked"); code != exitDrift {
+		t.Errorf("locked sync of a tampered lockfile exited %d, want %d", code, exitDrift)
+	}
+	env.write(lockPath, string(lock))
+
+	if _, code := env.run("sync", "proto"); code != exitChanged {
+		t.Errorf("sync of upstream changes exited %d, want %d", code, exitChanged)
+	}
+	if got := env.readTarget("a.proto"); got != "a2" {
+		t.Errorf("a.proto = %q, want a2", got)
+	}
+
+	// Conflicts and failures
+	env.commit(map[string]string{"api/c.proto": "c1"})
+	env.write(filepath.Join(env.target, "c.proto"), "hand written")
+	if _, code := env.run("sync", "proto"); code != exitFailed {
+		t.Errorf("sync with an unowned conflict exited %d, want %d", code, exitFailed)
+	}
+	if _, code := env.run("sync", "missing"); code != exitFailed {
+		t.Errorf("sync of an unknown repository exited %d, want %d", code, exitFailed)
+	}
+	if _, code := env.run("sync", "proto", "--on-conflict", "nonsense"); code != exitFailed {
+		t.Errorf("sync with an invalid --on-conflict exited %d, want %d", code, exitFailed)
+	}
+}
+
+func TestSyncCommandCancelled(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+	env := newTestEnv(t, map[string]string{"api/a.proto": "a1"}, fmt.Sprintf(`    rollback_on_hook_failure: true
+    post_sync_commands:
+      - command: touch %s && exec sleep 30
+        directory: %s
+`, started, t.TempDir()))
+
+	cmd, stdout, stderr := env.command("sync", "proto")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			t.Fatalf("post-sync command never started\n%s%s", stdout, stderr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := exitCode(t, cmd.Wait(), stdout, stderr); code != exitCancelled {
+		t.Errorf("interrupted sync exited %d, want %d\n%s%s", code, exitCancelled, stdout, stderr)
+	}
+	if got := env.readTarget("a.proto"); got != "<missing>" {
+		t.Errorf("a.proto = %q after the interrupted sync was rolled back", got)
+	}
+
+	store, err := readHistory(env.home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Histories) != 1 || !store.Histories[0].Cancelled || !store.Histories[0].RolledBack {
+		t.Errorf("history = %+v, want one cancelled and rolled back sync", store.Histories)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	env := newTestEnv(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"}, "")
+	if _, code := env.run("sync", "proto"); code != exitChanged {
+		t.Fatalf("sync exited %d", code)
+	}
+
+	// check runs the text format by default
+	if out, code := env.run("check"); code != exitNoChanges || !strings.Contains(out, "proto") {
+		t.Errorf("check without drift exited %d:\n%s", code, out)
+	}
+
+	env.write(filepath.Join(env.target, "a.proto"), "edited")
+	env.write(filepath.Join(env.target, "hand.proto"), "not owned")
+	env.commit(map[string]string{"api/c.proto": "c1"})
+
+	out, code := env.run("check", "--format", "json")
+	if code != exitDrift {
+		t.Errorf("check with drift exited %d, want %d", code, exitDrift)
+	}
+	var reports []sync.DriftReport
+	if err := json.Unmarshal([]byte(out), &reports); err != nil {
+		t.Fatalf("check --format json printed invalid JSON: %v\n%s", err, out)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+	report := reports[0]
+	if report.Repository != "proto" || len(report.Commit) != 40 || report.Error != "" {
+		t.Errorf("report = %+v", report)
+	}
+	if strings.Join(report.Added, " ") != "c.proto" || strings.Join(report.Modified, " ") != "a.proto" || len(report.Deleted) != 0 {
+		t.Errorf("report added %v, modified %v, deleted %v; want c.proto added and a.proto modified", report.Added, report.Modified, report.Deleted)
+	}
+	if got := env.readTarget("a.proto"); got != "edited" {
+		t.Errorf("check changed a.proto to %q", got)
+	}
+
+	if _, code := env.run("check", "missing"); code != exitFailed {
+		t.Errorf("check of an unknown repository exited %d, want %d", code, exitFailed)
+	}
+	if _, code := env.run("check", "--format", "xml"); code != exitFailed {
+		t.Errorf("check with an unknown format exited %d, want %d", code, exitFailed)
+	}
+}
+
+// readHistory reads the sync history below home
+func readHistory(home string) (*models.SyncHistoryStore, error) {
+	data, err := os.ReadFile(filepath.Join(home, ".stack-sync", "history.json"))
+	if err != nil {
+		return nil, err
+	}
+	var store models.SyncHistoryStore
+	return &store, json.Unmarshal(data, &store)
+}
+
+// historyEntries counts the sync history entries below home
+func historyEntries(home string) (int, error) {
+	store, err := readHistory(home)
+	if err != nil {
+		return 0, err
+	}
+	return len(store.Histories), nil
+}
+
+// sha256Hex returns the hex encoded SHA-256 of content
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/stackfilesync/stack-sync-cli/pkg/models"
 	"gopkg.in/yaml.v3"
@@ -21,7 +22,11 @@ type Settings struct {
 	BackupDir     string `yaml:"backup_dir"`
 	ShowIcons     bool   `yaml:"show_icons"`
 	ColorOutput   bool   `yaml:"color_output"`
-	Language      string `yaml:"language"` // Language setting: "en-US" or "zh-CN"
+	Language      string `yaml:"language"`      // Language setting: "en-US" or "zh-CN"
+	CacheEnabled  bool   `yaml:"cache_enabled"` // Reuse a local mirror instead of cloning on every sync
+	CacheDir      string `yaml:"cache_dir,omitempty"`
+
+	models.NetworkConfig `yaml:",inline"` // Proxy and TLS settings for every repository
 }
 
 // Config represents the complete configuration
@@ -45,6 +50,8 @@ func DefaultConfig() *Config {
 			ShowIcons:     true,
 			ColorOutput:   true,
 			Language:      "en-US", // Default to English
+			CacheEnabled:  true,
+			CacheDir:      filepath.Join(homeDir, ".stack-sync", "cache"),
 		},
 		Repositories: []models.Repository{},
 	}
@@ -59,6 +66,42 @@ func GetConfigPath() string {
 	return filepath.Join(homeDir, ".stack-sync", "config.yml")
 }
 
+// GetCacheDir returns the directory holding the mirror cache
+func (c *Config) GetCacheDir() string {
+	if c.Settings.CacheDir != "" {
+		return expandHome(c.Settings.CacheDir)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".stack-sync/cache"
+	}
+	return filepath.Join(homeDir, ".stack-sync", "cache")
+}
+
+// GetBackupDir returns the directory holding the backups of all repositories
+func (c *Config) GetBackupDir() string {
+	if c.Settings.BackupDir != "" {
+		return expandHome(c.Settings.BackupDir)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".stack-sync/backups"
+	}
+	return filepath.Join(homeDir, ".stack-sync", "backups")
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
+
 // Load reads and parses the configuration file
 func Load() (*Config, error) {
 	configPath := GetConfigPath()
@@ -69,16 +112,26 @@ func Load() (*Config, error) {
 		return DefaultConfig(), nil
 	}
 
-	data, err := os.ReadFile(configPath)
+	return LoadFile(configPath)
+}
+
+// LoadFile reads and parses the configuration file at path
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
+	// Settings missing from older config files keep their defaults
+	config := Config{Settings: Settings{CacheEnabled: true}}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+
 	return &config, nil
 }
 
@@ -97,9 +150,13 @@ func Save(config *Config) error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	// The config may hold credentials, keep it private
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	if err := os.Chmod(configPath, 0600); err != nil {
+		return fmt.Errorf("failed to restrict config file permissions: %w", err)
+	}
 
 	return nil
 }
@@ -114,6 +171,10 @@ func (c *Config) AddRepository(repo models.Repository) error {
 	}
 
 	c.Repositories = append(c.Repositories, repo)
+	if err := c.Validate(); err != nil {
+		c.Repositories = c.Repositories[:len(c.Repositories)-1]
+		return err
+	}
 	return Save(c)
 }
 
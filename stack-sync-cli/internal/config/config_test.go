@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFileCacheDefault(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want bool
+	}{
+		{name: "older config without the setting", yaml: "settings:\n  backup_enabled: true\n", want: true},
+		{name: "no settings at all", yaml: "repositories: []\n", want: true},
+		{name: "disabled", yaml: "settings:\n  cache_enabled: false\n", want: false},
+		{name: "enabled", yaml: "settings:\n  cache_enabled: true\n", want: true},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := LoadFile(path)
+		if err != nil {
+			t.Errorf("%s: LoadFile() failed: %v", tt.name, err)
+			continue
+		}
+		if cfg.Settings.CacheEnabled != tt.want {
+			t.Errorf("%s: cache_enabled = %v, want %v", tt.name, cfg.Settings.CacheEnabled, tt.want)
+		}
+	}
+}
+
+func TestGetCacheDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	tests := []struct {
+		cacheDir string
+		want     string
+	}{
+		{"", filepath.Join(home, ".stack-sync", "cache")},
+		{"~/mirrors", filepath.Join(home, "mirrors")},
+		{"~", home},
+		{"/var/cache/stack-sync", "/var/cache/stack-sync"},
+		{"~other/mirrors", "~other/mirrors"},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{Settings: Settings{CacheDir: tt.cacheDir}}
+		if got := cfg.GetCacheDir(); got != tt.want {
+			t.Errorf("GetCacheDir() with cache_dir %q = %s, want %s", tt.cacheDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// Validate checks the repositories' names and dependencies: names are unique,
+// depends_on names configured repositories and dependencies have no cycles
+func (c *Config) Validate() error {
+	byName := make(map[string]*models.Repository, len(c.Repositories))
+	for i := range c.Repositories {
+		repo := &c.Repositories[i]
+		if _, ok := byName[repo.Name]; ok {
+			return fmt.Errorf("repository '%s' is configured more than once", repo.Name)
+		}
+		byName[repo.Name] = repo
+	}
+
+	for _, repo := range c.Repositories {
+		for _, dep := range repo.DependsOn {
+			if dep == repo.Name {
+				return fmt.Errorf("repository '%s' depends on itself", repo.Name)
+			}
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("repository '%s' depends on unknown repository '%s'", repo.Name, dep)
+			}
+		}
+	}
+
+	_, err := topoSort(c.Repositories)
+	return err
+}
+
+// SyncOrder returns repos sorted so that every repository comes after the
+// repositories it depends on, directly or through repositories not in repos.
+// Independent repositories keep their configured order.
+func (c *Config) SyncOrder(repos []*models.Repository) ([]*models.Repository, error) {
+	selected := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		selected[repo.Name] = true
+	}
+
+	all, err := topoSort(c.Repositories)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make([]*models.Repository, 0, len(repos))
+	for _, repo := range all {
+		if selected[repo.Name] {
+			ordered = append(ordered, repo)
+		}
+	}
+	return ordered, nil
+}
+
+// Group returns the repositories in a group or with a tag, in configured order
+func (c *Config) Group(name string) []*models.Repository {
+	var repos []*models.Repository
+	for i := range c.Repositories {
+		if c.Repositories[i].InGroup(name) {
+			repos = append(repos, &c.Repositories[i])
+		}
+	}
+	return repos
+}
+
+// Dependents returns the names of the repositories that depend on name,
+// directly or transitively
+func (c *Config) Dependents(name string) []string {
+	var dependents []string
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, repo := range c.Repositories {
+			if seen[repo.Name] || !repo.DependsOnRepository(current) {
+				continue
+			}
+			seen[repo.Name] = true
+			dependents = append(dependents, repo.Name)
+			queue = append(queue, repo.Name)
+		}
+	}
+	return dependents
+}
+
+// topoSort orders repositories depth-first by their dependencies, reporting
+// the first cycle found
+func topoSort(repositories []models.Repository) ([]*models.Repository, error) {
+	byName := make(map[string]*models.Repository, len(repositories))
+	for i := range repositories {
+		byName[repositories[i].Name] = &repositories[i]
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(repositories))
+	ordered := make([]*models.Repository, 0, len(repositories))
+	var path []string
+
+	var visit func(repo *models.Repository) error
+	visit = func(repo *models.Repository) error {
+		switch state[repo.Name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, name := range path {
+				if name == repo.Name {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), repo.Name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[repo.Name] = visiting
+		path = append(path, repo.Name)
+		for _, dep := range repo.DependsOn {
+			if depRepo, ok := byName[dep]; ok {
+				if err := visit(depRepo); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[repo.Name] = visited
+
+		ordered = append(ordered, repo)
+		return nil
+	}
+
+	for i := range repositories {
+		if err := visit(&repositories[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
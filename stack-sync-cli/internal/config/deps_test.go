@@ -0,0 +1,148 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// repos builds repositories from "name:dep,dep" specs
+func repos(specs ...string) []models.Repository {
+	var result []models.Repository
+	for _, spec := range specs {
+		name, deps, _ := strings.Cut(spec, ":")
+		repo := models.Repository{Name: name}
+		if deps != "" {
+			repo.DependsOn = strings.Split(deps, ",")
+		}
+		result = append(result, repo)
+	}
+	return result
+}
+
+// names returns the names of repositories
+func names(repositories []*models.Repository) string {
+	var result []string
+	for _, repo := range repositories {
+		result = append(result, repo.Name)
+	}
+	return strings.Join(result, " ")
+}
+
+func TestTopoSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		repos   []models.Repository
+		want    string
+		wantErr string
+	}{
+		{name: "no dependencies keep configured order", repos: repos("c", "a", "b"), want: "c a b"},
+		{name: "dependency moves first", repos: repos("app:proto", "proto"), want: "proto app"},
+		{name: "chain", repos: repos("c:b", "b:a", "a"), want: "a b c"},
+		{name: "diamond", repos: repos("app:left,right", "left:base", "right:base", "base"), want: "base left right app"},
+		{name: "unknown dependencies are ignored", repos: repos("a:missing", "b"), want: "a b"},
+		{name: "two-repository cycle", repos: repos("a:b", "b:a"), wantErr: "dependency cycle: a -> b -> a"},
+		{name: "cycle behind a dependency", repos: repos("app:x", "x:y", "y:z", "z:x"), wantErr: "dependency cycle: x -> y -> z -> x"},
+		{name: "self dependency", repos: repos("a:a"), wantErr: "dependency cycle: a -> a"},
+	}
+
+	for _, tt := range tests {
+		got, err := topoSort(tt.repos)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: topoSort() error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: topoSort() failed: %v", tt.name, err)
+			continue
+		}
+		if names(got) != tt.want {
+			t.Errorf("%s: topoSort() = %s, want %s", tt.name, names(got), tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		repos   []models.Repository
+		wantErr string
+	}{
+		{name: "valid", repos: repos("app:proto,shared", "proto:shared", "shared")},
+		{name: "empty", repos: nil},
+		{name: "duplicate name", repos: repos("a", "b", "a"), wantErr: "configured more than once"},
+		{name: "self dependency", repos: repos("a:a"), wantErr: "depends on itself"},
+		{name: "unknown dependency", repos: repos("a:missing"), wantErr: "unknown repository 'missing'"},
+		{name: "cycle", repos: repos("a:b", "b:c", "c:a"), wantErr: "dependency cycle"},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{Repositories: tt.repos}
+		err := cfg.Validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: Validate() failed: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Validate() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSyncOrder(t *testing.T) {
+	cfg := &Config{Repositories: repos("app:api", "docs", "api:proto", "proto")}
+
+	tests := []struct {
+		selected []string
+		want     string
+	}{
+		{[]string{"app", "docs", "api", "proto"}, "proto api app docs"},
+		// Ordered through api even when it isn't selected
+		{[]string{"app", "proto"}, "proto app"},
+		{[]string{"docs"}, "docs"},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		var selected []*models.Repository
+		for _, name := range tt.selected {
+			repo, err := cfg.GetRepository(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			selected = append(selected, repo)
+		}
+		got, err := cfg.SyncOrder(selected)
+		if err != nil {
+			t.Errorf("SyncOrder(%v) failed: %v", tt.selected, err)
+			continue
+		}
+		if names(got) != tt.want {
+			t.Errorf("SyncOrder(%v) = %s, want %s", tt.selected, names(got), tt.want)
+		}
+	}
+}
+
+func TestDependents(t *testing.T) {
+	cfg := &Config{Repositories: repos("app:api", "docs", "api:proto", "cli:proto", "proto")}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"proto", "api cli app"},
+		{"api", "app"},
+		{"app", ""},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(cfg.Dependents(tt.name), " "); got != tt.want {
+			t.Errorf("Dependents(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
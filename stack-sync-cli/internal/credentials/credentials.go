@@ -0,0 +1,162 @@
+// Package credentials resolves HTTPS credentials for repositories, so tokens
+// don't have to be stored in config.yml
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	gosync "sync"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// Built-in credential sources
+const (
+	SourceConfig  = "config"  // username/password in config.yml, ${VAR} references expanded
+	SourceSecrets = "secrets" // encrypted secrets file, see SecretsPath
+	SourceNetrc   = "netrc"   // ~/.netrc or $NETRC
+	SourceGit     = "git"     // git credential helpers via git credential fill, once the remote rejects a request
+)
+
+// DefaultSources are tried in order for repositories without credential_sources
+var DefaultSources = []string{SourceConfig, SourceSecrets, SourceNetrc, SourceGit}
+
+// Credential is a username and password or token
+type Credential struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+}
+
+// Source looks up credentials for a repository. Lookup returns nil without an
+// error if the source has none.
+type Source interface {
+	Name() string
+	Lookup(repo *models.Repository) (*Credential, error)
+}
+
+var (
+	sourcesMu gosync.RWMutex
+	sources   = map[string]Source{}
+)
+
+func init() {
+	Register(configSource{})
+	Register(secretsSource{})
+	Register(netrcSource{})
+	Register(gitSource{})
+}
+
+// Register adds a credential source, replacing any source of the same name
+func Register(source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[source.Name()] = source
+}
+
+// Resolve returns the first credential the repository's sources find, or nil
+// if none has one. A credential without a username gets the repository's
+// username, or git, which servers accept for tokens. git credential helpers
+// are skipped, see ResolveRejected.
+func Resolve(repo *models.Repository) (*Credential, error) {
+	return resolve(repo, false)
+}
+
+// ResolveRejected asks git credential helpers for a credential, if the
+// repository uses them, once the remote rejected a request. Helpers can be
+// slow or pop up a login, so they only run for remotes that need them.
+func ResolveRejected(repo *models.Repository) (*Credential, error) {
+	return resolve(repo, true)
+}
+
+// resolve tries the repository's sources, either all but git credential
+// helpers or only them
+func resolve(repo *models.Repository, helpers bool) (*Credential, error) {
+	names := repo.CredentialSources
+	if len(names) == 0 {
+		names = DefaultSources
+	}
+
+	for _, name := range names {
+		sourcesMu.RLock()
+		source, ok := sources[name]
+		sourcesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown credential source: %s", name)
+		}
+		if (name == SourceGit) != helpers {
+			continue
+		}
+
+		cred, err := source.Lookup(repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s credentials: %w", name, err)
+		}
+		if cred == nil || cred.Password == "" {
+			continue
+		}
+
+		if cred.Username == "" {
+			cred.Username, err = ExpandEnv(repo.Username)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if cred.Username == "" {
+			cred.Username = "git"
+		}
+		return cred, nil
+	}
+
+	return nil, nil
+}
+
+// envReference matches ${NAME} references
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces ${NAME} references with environment variables. Other
+// dollar signs are left alone, so tokens containing them survive.
+func ExpandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// IsReference reports whether value only consists of ${NAME} references
+func IsReference(value string) bool {
+	return value != "" && envReference.ReplaceAllString(value, "") == ""
+}
+
+// configSource reads username and password from config.yml
+type configSource struct{}
+
+// Name implements Source
+func (configSource) Name() string { return SourceConfig }
+
+// Lookup implements Source
+func (configSource) Lookup(repo *models.Repository) (*Credential, error) {
+	if repo.Password == "" {
+		return nil, nil
+	}
+
+	username, err := ExpandEnv(repo.Username)
+	if err != nil {
+		return nil, err
+	}
+	password, err := ExpandEnv(repo.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{Username: username, Password: password}, nil
+}
@@ -0,0 +1,181 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("STACK_SYNC_TEST_TOKEN", "s3cret")
+	t.Setenv("STACK_SYNC_TEST_USER", "ci")
+	t.Setenv("STACK_SYNC_TEST_EMPTY", "")
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "plain", want: "plain"},
+		{value: "${STACK_SYNC_TEST_TOKEN}", want: "s3cret"},
+		{value: "${STACK_SYNC_TEST_USER}:${STACK_SYNC_TEST_TOKEN}", want: "ci:s3cret"},
+		{value: "${STACK_SYNC_TEST_EMPTY}", want: ""},
+		// Only ${NAME} is a reference, tokens with other dollar signs survive
+		{value: "pa$$word", want: "pa$$word"},
+		{value: "$STACK_SYNC_TEST_TOKEN", want: "$STACK_SYNC_TEST_TOKEN"},
+		{value: "${1NVALID}", want: "${1NVALID}"},
+		{value: "${STACK_SYNC_TEST_UNSET}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ExpandEnv(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ExpandEnv(%q) = %q, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ExpandEnv(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ExpandEnv(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsReference(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"${GITHUB_TOKEN}", true},
+		{"${A}${B}", true},
+		{"", false},
+		{"ghp_abc", false},
+		{"token-${GITHUB_TOKEN}", false},
+		{"$GITHUB_TOKEN", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsReference(tt.value); got != tt.want {
+			t.Errorf("IsReference(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+// fakeSource returns a fixed credential
+type fakeSource struct {
+	name string
+	cred *Credential
+}
+
+func (s fakeSource) Name() string { return s.name }
+
+func (s fakeSource) Lookup(*models.Repository) (*Credential, error) {
+	if s.cred == nil {
+		return nil, nil
+	}
+	cred := *s.cred
+	return &cred, nil
+}
+
+func TestResolve(t *testing.T) {
+	Register(fakeSource{name: "test-none"})
+	Register(fakeSource{name: "test-no-password", cred: &Credential{Username: "u"}})
+	Register(fakeSource{name: "test-token", cred: &Credential{Password: "token"}})
+	Register(fakeSource{name: "test-full", cred: &Credential{Username: "alice", Password: "pw"}})
+	t.Setenv("STACK_SYNC_TEST_USER", "bob")
+
+	tests := []struct {
+		name    string
+		repo    models.Repository
+		want    *Credential
+		wantErr bool
+	}{
+		{
+			name: "first source with a password wins",
+			repo: models.Repository{CredentialSources: []string{"test-none", "test-no-password", "test-full", "test-token"}},
+			want: &Credential{Username: "alice", Password: "pw"},
+		},
+		{
+			name: "token without username defaults to git",
+			repo: models.Repository{CredentialSources: []string{"test-token"}},
+			want: &Credential{Username: "git", Password: "token"},
+		},
+		{
+			name: "token takes the repository username",
+			repo: models.Repository{CredentialSources: []string{"test-token"}, Username: "${STACK_SYNC_TEST_USER}"},
+			want: &Credential{Username: "bob", Password: "token"},
+		},
+		{
+			name: "config references are expanded",
+			repo: models.Repository{CredentialSources: []string{SourceConfig}, Password: "${STACK_SYNC_TEST_USER}"},
+			want: &Credential{Username: "git", Password: "bob"},
+		},
+		{
+			name: "nothing found",
+			repo: models.Repository{CredentialSources: []string{"test-none", SourceConfig}},
+		},
+		{
+			name:    "unknown source",
+			repo:    models.Repository{CredentialSources: []string{"test-missing"}},
+			wantErr: true,
+		},
+		{
+			name:    "unset reference",
+			repo:    models.Repository{CredentialSources: []string{SourceConfig}, Password: "${STACK_SYNC_TEST_UNSET}"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Resolve(&tt.repo)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: Resolve() = %+v, want error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Resolve() failed: %v", tt.name, err)
+			continue
+		}
+		switch {
+		case got == nil && tt.want != nil:
+			t.Errorf("%s: Resolve() = nil, want %+v", tt.name, *tt.want)
+		case got != nil && tt.want == nil:
+			t.Errorf("%s: Resolve() = %+v, want nil", tt.name, *got)
+		case got != nil && *got != *tt.want:
+			t.Errorf("%s: Resolve() = %+v, want %+v", tt.name, *got, *tt.want)
+		}
+	}
+}
+
+func TestResolveRejected(t *testing.T) {
+	Register(fakeSource{name: SourceGit, cred: &Credential{Password: "helper-token"}})
+	t.Cleanup(func() { Register(gitSource{}) })
+	Register(fakeSource{name: "test-none"})
+	Register(fakeSource{name: "test-token", cred: &Credential{Password: "token"}})
+
+	// git credential helpers are only asked after a rejection
+	repo := &models.Repository{}
+	if got, err := Resolve(repo); got != nil || err != nil {
+		t.Errorf("Resolve() with the default sources = %+v, %v, want nil", got, err)
+	}
+	if got, err := ResolveRejected(repo); err != nil || got == nil || *got != (Credential{Username: "git", Password: "helper-token"}) {
+		t.Errorf("ResolveRejected() with the default sources = %+v, %v", got, err)
+	}
+
+	// ...and only if the repository uses them
+	repo = &models.Repository{CredentialSources: []string{"test-none", "test-token"}}
+	if got, err := ResolveRejected(repo); got != nil || err != nil {
+		t.Errorf("ResolveRejected() without git = %+v, %v, want nil", got, err)
+	}
+	repo = &models.Repository{CredentialSources: []string{"test-missing", SourceGit}}
+	if _, err := ResolveRejected(repo); err == nil {
+		t.Error("ResolveRejected() with an unknown source succeeded")
+	}
+}
@@ -0,0 +1,74 @@
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// helperTimeout bounds a credential helper that waits for input it can't get
+const helperTimeout = 30 * time.Second
+
+// gitSource asks git's configured credential helpers through git credential fill
+type gitSource struct{}
+
+// Name implements Source
+func (gitSource) Name() string { return SourceGit }
+
+// Lookup implements Source. git never prompts; without git or a helper that
+// knows the URL, it finds nothing.
+func (gitSource) Lookup(repo *models.Repository) (*Credential, error) {
+	u, err := url.Parse(repo.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "protocol=%s\nhost=%s\n", u.Scheme, u.Host)
+	if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+		fmt.Fprintf(&input, "path=%s\n", path)
+	}
+	if u.User != nil && u.User.Username() != "" {
+		fmt.Fprintf(&input, "username=%s\n", u.User.Username())
+	}
+	input.WriteString("\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), helperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = &input
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never")
+	output, err := cmd.Output()
+	if err != nil {
+		// No helper had credentials and git wasn't allowed to prompt
+		return nil, nil
+	}
+
+	cred := &Credential{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			cred.Username = value
+		case "password":
+			cred.Password = value
+		}
+	}
+	return cred, nil
+}
@@ -0,0 +1,126 @@
+package credentials
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// netrcSource reads credentials for the repository's host from a netrc file
+type netrcSource struct{}
+
+// Name implements Source
+func (netrcSource) Name() string { return SourceNetrc }
+
+// Lookup implements Source
+func (netrcSource) Lookup(repo *models.Repository) (*Credential, error) {
+	host := httpHost(repo.URL)
+	if host == "" {
+		return nil, nil
+	}
+
+	path := netrcPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return parseNetrc(string(data), host), nil
+}
+
+// netrcPath returns $NETRC, or ~/.netrc (~/_netrc on Windows)
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".netrc"
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(homeDir, "_netrc")
+	}
+	return filepath.Join(homeDir, ".netrc")
+}
+
+// parseNetrc returns the login and password of the machine entry for host, or
+// of the default entry
+func parseNetrc(data, host string) *Credential {
+	var found, fallback *Credential
+	var current *Credential
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// Macro definitions run until an empty line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				current = nil
+				if i+1 < len(fields) {
+					i++
+					if fields[i] == host && found == nil {
+						found = &Credential{}
+						current = found
+					}
+				}
+			case "default":
+				current = nil
+				if fallback == nil {
+					fallback = &Credential{}
+					current = fallback
+				}
+			case "login":
+				if i+1 < len(fields) {
+					i++
+					if current != nil {
+						current.Username = fields[i]
+					}
+				}
+			case "password":
+				if i+1 < len(fields) {
+					i++
+					if current != nil {
+						current.Password = fields[i]
+					}
+				}
+			case "account":
+				i++
+			case "macdef":
+				current = nil
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+
+	if found != nil {
+		return found
+	}
+	return fallback
+}
+
+// httpHost returns the host of an http(s) URL, or "" for other URLs
+func httpHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return ""
+	}
+	return u.Hostname()
+}
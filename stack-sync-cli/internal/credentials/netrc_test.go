@@ -0,0 +1,100 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+const testNetrc = `# build machines
+machine git.example.com
+  login alice
+  password first
+
+machine github.com login bob password ghp_token account ignored
+
+macdef init
+machine github.com login mallory password fromMacro
+
+machine github.com login carol password second
+default login anon password guest
+`
+
+func TestParseNetrc(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		host string
+		want *Credential
+	}{
+		{name: "multi-line entry", data: testNetrc, host: "git.example.com", want: &Credential{Username: "alice", Password: "first"}},
+		{name: "first matching entry wins, macros are skipped", data: testNetrc, host: "github.com", want: &Credential{Username: "bob", Password: "ghp_token"}},
+		{name: "default entry", data: testNetrc, host: "gitlab.com", want: &Credential{Username: "anon", Password: "guest"}},
+		{name: "no match without default", data: "machine a.com login x password y\n", host: "b.com"},
+		{name: "password only", data: "machine a.com password tok\n", host: "a.com", want: &Credential{Password: "tok"}},
+		{name: "empty file", data: "", host: "a.com"},
+		{name: "truncated entry", data: "machine a.com login", host: "a.com", want: &Credential{}},
+	}
+
+	for _, tt := range tests {
+		got := parseNetrc(tt.data, tt.host)
+		switch {
+		case got == nil && tt.want != nil:
+			t.Errorf("%s: parseNetrc() = nil, want %+v", tt.name, *tt.want)
+		case got != nil && tt.want == nil:
+			t.Errorf("%s: parseNetrc() = %+v, want nil", tt.name, *got)
+		case got != nil && *got != *tt.want:
+			t.Errorf("%s: parseNetrc() = %+v, want %+v", tt.name, *got, *tt.want)
+		}
+	}
+}
+
+func TestHTTPHost(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://github.com/org/repo.git", "github.com"},
+		{"http://git.example.com:8080/repo", "git.example.com"},
+		{"https://user@git.example.com/repo", "git.example.com"},
+		{"git@github.com:org/repo.git", ""},
+		{"ssh://git@github.com/org/repo.git", ""},
+		{"/srv/git/repo", ""},
+	}
+
+	for _, tt := range tests {
+		if got := httpHost(tt.url); got != tt.want {
+			t.Errorf("httpHost(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNetrcLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte(testNetrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", path)
+
+	cred, err := netrcSource{}.Lookup(&models.Repository{URL: "https://git.example.com/org/repo.git"})
+	if err != nil {
+		t.Fatalf("Lookup() failed: %v", err)
+	}
+	if cred == nil || cred.Username != "alice" || cred.Password != "first" {
+		t.Errorf("Lookup() = %+v, want alice/first", cred)
+	}
+
+	// SSH remotes never use netrc
+	cred, err = netrcSource{}.Lookup(&models.Repository{URL: "git@git.example.com:org/repo.git"})
+	if err != nil || cred != nil {
+		t.Errorf("Lookup(ssh) = %+v, %v, want nil", cred, err)
+	}
+
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "missing"))
+	cred, err = netrcSource{}.Lookup(&models.Repository{URL: "https://git.example.com/org/repo.git"})
+	if err != nil || cred != nil {
+		t.Errorf("Lookup(missing netrc) = %+v, %v, want nil", cred, err)
+	}
+}
@@ -0,0 +1,191 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	gosync "sync"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/config"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv holds the passphrase of the secrets file for non-interactive use
+const PassphraseEnv = "STACK_SYNC_SECRETS_PASSPHRASE"
+
+// ErrWrongPassphrase is returned for a secrets file that can't be decrypted
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted secrets file")
+
+// PassphraseFunc returns the passphrase unlocking the secrets file, or "" if
+// none is available. It reads PassphraseEnv unless replaced, e.g. by a prompt.
+var PassphraseFunc = func() (string, error) {
+	return os.Getenv(PassphraseEnv), nil
+}
+
+// Scrypt parameters for deriving the AES-256 key from a passphrase
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	secretsKeyLen = 32
+)
+
+// SecretsPath returns the path of the encrypted secrets file
+func SecretsPath() string {
+	return filepath.Join(filepath.Dir(config.GetConfigPath()), "secrets.enc")
+}
+
+// Secrets are credentials by repository name
+type Secrets map[string]Credential
+
+// secretsFile is the on-disk format: the secrets as JSON, encrypted with
+// AES-256-GCM under a key derived by scrypt
+type secretsFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// LoadSecrets decrypts the secrets file at path. A missing file has no secrets.
+func LoadSecrets(path, passphrase string) (Secrets, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Secrets{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	var file secretsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported secrets file version: %d", file.Version)
+	}
+
+	gcm, err := secretsCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	secrets := Secrets{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// Save encrypts the secrets with passphrase and writes them to path, readable
+// only by the current user
+func (s Secrets) Save(path, passphrase string) error {
+	plain, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	file := secretsFile{Version: 1, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := secretsCipher(passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	// Write next to the old file and rename, so a failed write keeps it intact
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return nil
+}
+
+// secretsCipher derives the AES-GCM cipher for a passphrase and salt
+func secretsCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("secrets passphrase is empty")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, secretsKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive secrets key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// unlocked caches the decrypted secrets file, so the passphrase is asked once
+var unlocked struct {
+	mu      gosync.Mutex
+	secrets Secrets
+}
+
+// secretsSource reads credentials from the encrypted secrets file
+type secretsSource struct{}
+
+// Name implements Source
+func (secretsSource) Name() string { return SourceSecrets }
+
+// Lookup implements Source. Without a secrets file or passphrase it finds
+// nothing.
+func (secretsSource) Lookup(repo *models.Repository) (*Credential, error) {
+	path := SecretsPath()
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil
+	}
+
+	unlocked.mu.Lock()
+	defer unlocked.mu.Unlock()
+	if unlocked.secrets == nil {
+		passphrase, err := PassphraseFunc()
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, nil
+		}
+
+		secrets, err := LoadSecrets(path, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		unlocked.secrets = secrets
+	}
+
+	cred, ok := unlocked.secrets[repo.Name]
+	if !ok {
+		return nil, nil
+	}
+	return &cred, nil
+}
@@ -0,0 +1,97 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "secrets.enc")
+	secrets := Secrets{
+		"backend":  {Username: "ci", Password: "ghp_token"},
+		"frontend": {Password: "glpat-token"},
+	}
+
+	if err := secrets.Save(path, "correct horse"); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("secrets file mode = %o, want 600", perm)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"ghp_token", "glpat-token", "backend"} {
+		if bytes.Contains(data, []byte(plain)) {
+			t.Errorf("secrets file contains %q in plain text", plain)
+		}
+	}
+
+	loaded, err := LoadSecrets(path, "correct horse")
+	if err != nil {
+		t.Fatalf("LoadSecrets() failed: %v", err)
+	}
+	if len(loaded) != len(secrets) {
+		t.Fatalf("LoadSecrets() = %v, want %v", loaded, secrets)
+	}
+	for name, cred := range secrets {
+		if loaded[name] != cred {
+			t.Errorf("LoadSecrets()[%s] = %+v, want %+v", name, loaded[name], cred)
+		}
+	}
+}
+
+func TestLoadSecretsErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.enc")
+	if err := (Secrets{"repo": {Password: "x"}}).Save(path, "right"); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if _, err := LoadSecrets(path, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("LoadSecrets(wrong passphrase) error = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := LoadSecrets(path, ""); err == nil {
+		t.Error("LoadSecrets(empty passphrase) should fail")
+	}
+
+	garbage := filepath.Join(dir, "garbage.enc")
+	if err := os.WriteFile(garbage, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSecrets(garbage, "right"); err == nil {
+		t.Error("LoadSecrets(garbage) should fail")
+	}
+
+	future := filepath.Join(dir, "future.enc")
+	if err := os.WriteFile(future, []byte(`{"version": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSecrets(future, "right"); err == nil {
+		t.Error("LoadSecrets(version 2) should fail")
+	}
+
+	secrets, err := LoadSecrets(filepath.Join(dir, "missing.enc"), "right")
+	if err != nil || len(secrets) != 0 {
+		t.Errorf("LoadSecrets(missing) = %v, %v, want no secrets", secrets, err)
+	}
+}
+
+func TestSaveEmptyPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	if err := (Secrets{}).Save(path, ""); err == nil {
+		t.Error("Save() with an empty passphrase should fail")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Save() with an empty passphrase wrote %s", path)
+	}
+}
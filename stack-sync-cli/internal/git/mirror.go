@@ -0,0 +1,400 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// Mirror wraps a bare mirror clone kept in the local cache
+type Mirror struct {
+	repo *git.Repository
+	path string
+}
+
+// MirrorInfo describes a cached mirror on disk
+type MirrorInfo struct {
+	Name        string
+	Path        string
+	URL         string
+	Size        int64
+	LastFetched time.Time
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// MirrorPath returns the cache path used for a repository name
+func MirrorPath(cacheDir, name string) string {
+	return filepath.Join(cacheDir, unsafeNameChars.ReplaceAllString(name, "_"))
+}
+
+// OpenMirror creates the mirror for a repository or fetches it incrementally if it already exists.
+// The remote is reached through tr, see NewTransport. Progress and status
+// messages are written to out. Cancelling ctx aborts the clone or fetch.
+func OpenMirror(ctx context.Context, repo *models.Repository, path string, tr *Transport, out io.Writer) (*Mirror, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err == nil && mirrorURL(gitRepo) != repo.URL {
+		// Repository URL changed since the mirror was created, start over
+		fmt.Fprintf(out, "Cached mirror points to a different URL, recreating: %s\n", path)
+		gitRepo = nil
+	}
+
+	if gitRepo == nil || err != nil {
+		if err := os.RemoveAll(path); err != nil {
+			return nil, fmt.Errorf("failed to clean cache path: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+
+		fmt.Fprintf(out, "Creating mirror of %s in cache...\n", repo.URL)
+		opts := &git.CloneOptions{
+			URL:      repo.URL,
+			Mirror:   true,
+			Progress: out,
+		}
+		err = tr.retry(func() (err error) {
+			tr.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+			gitRepo, err = git.PlainCloneContext(ctx, path, true, opts)
+			return err
+		})
+		if err != nil {
+			os.RemoveAll(path)
+			return nil, fmt.Errorf("failed to create mirror: %w", err)
+		}
+	} else {
+		fmt.Fprintf(out, "Fetching %s into cached mirror...\n", repo.URL)
+		opts := &git.FetchOptions{
+			RemoteName: "origin",
+			Progress:   out,
+			Tags:       git.AllTags,
+			Force:      true,
+			Prune:      true,
+		}
+		err = tr.retry(func() error {
+			tr.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+			return gitRepo.FetchContext(ctx, opts)
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return nil, fmt.Errorf("failed to fetch mirror: %w", err)
+		}
+	}
+
+	// Record the fetch time on the mirror directory itself
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return &Mirror{
+		repo: gitRepo,
+		path: path,
+	}, nil
+}
+
+// OpenCachedMirror opens the existing mirror of a repository without fetching,
+// for offline use. It fails if there's no mirror of the repository's URL.
+func OpenCachedMirror(repo *models.Repository, path string) (*Mirror, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("no cached mirror of %s", repo.Name)
+	}
+	if mirrorURL(gitRepo) != repo.URL {
+		return nil, fmt.Errorf("cached mirror of %s points to a different URL", repo.Name)
+	}
+
+	return &Mirror{
+		repo: gitRepo,
+		path: path,
+	}, nil
+}
+
+// LastFetched returns when the mirror was created or last fetched
+func (m *Mirror) LastFetched() time.Time {
+	stat, err := os.Stat(m.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// References lists the references in the mirror the way ListRemoteRefs lists
+// them on the remote, annotated tags peeled, so ResolvePinFrom works offline
+func (m *Mirror) References() ([]*plumbing.Reference, error) {
+	iter, err := m.repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mirror references: %w", err)
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		if ref.Type() != plumbing.HashReference || !ref.Name().IsTag() {
+			return nil
+		}
+		if tag, err := m.repo.TagObject(ref.Hash()); err == nil {
+			if commit, err := tag.Commit(); err == nil {
+				refs = append(refs, plumbing.NewHashReference(ref.Name()+"^{}", commit.Hash))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// ChangedFiles returns the files under subDir that differ between two
+// commits, relative to subDir. It fails if either commit isn't in the mirror.
+func (m *Mirror) ChangedFiles(from, to plumbing.Hash, subDir string) ([]string, error) {
+	subDir = strings.Trim(filepath.ToSlash(subDir), "/")
+
+	fromTree, err := m.subTree(from, subDir)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := m.subTree(to, subDir)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s and %s: %w", from.String()[:8], to.String()[:8], err)
+	}
+
+	files := make([]string, 0, len(changes))
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// subTree returns the tree of subDir at a commit, nil if subDir doesn't exist
+func (m *Mirror) subTree(hash plumbing.Hash, subDir string) (*object.Tree, error) {
+	commit, err := m.repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree: %w", err)
+	}
+	if subDir == "" {
+		return tree, nil
+	}
+
+	tree, err = tree.Tree(subDir)
+	if err == object.ErrDirectoryNotFound {
+		return nil, nil
+	}
+	return tree, err
+}
+
+// mirrorURL returns the origin URL of a mirror, or an empty string
+func mirrorURL(repo *git.Repository) string {
+	remote, err := repo.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	return remote.Config().URLs[0]
+}
+
+// ResolveBranch returns the commit a branch points to; an empty branch resolves HEAD
+func (m *Mirror) ResolveBranch(branch string) (plumbing.Hash, error) {
+	if branch == "" {
+		head, err := m.repo.Head()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+		return head.Hash(), nil
+	}
+
+	ref, err := m.repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("branch not found in mirror: %s", branch)
+	}
+	return ref.Hash(), nil
+}
+
+// Extract writes the files under subDir at the given commit into dest, keeping the subDir prefix
+func (m *Mirror) Extract(hash plumbing.Hash, subDir, dest string) error {
+	commit, err := m.repo.CommitObject(hash)
+	if err != nil {
+		return fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	subDir = strings.Trim(filepath.ToSlash(subDir), "/")
+	if subDir != "" {
+		tree, err = tree.Tree(subDir)
+		if err != nil {
+			return fmt.Errorf("source directory does not exist: %s", subDir)
+		}
+	}
+
+	root := filepath.Join(dest, filepath.FromSlash(subDir))
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+
+	return tree.Files().ForEach(func(f *object.File) error {
+		return writeTreeFile(f, filepath.Join(root, filepath.FromSlash(f.Name)))
+	})
+}
+
+// writeTreeFile writes a single blob from a tree to disk
+func writeTreeFile(f *object.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if f.Mode == filemode.Symlink {
+		target, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+
+	perm := os.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		perm = 0755
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, reader)
+	return err
+}
+
+// ListMirrors returns all mirrors found in the cache directory
+func ListMirrors(cacheDir string) ([]MirrorInfo, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if os.IsNotExist(err) {
+		return []MirrorInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var mirrors []MirrorInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(cacheDir, entry.Name())
+		info := MirrorInfo{
+			Name: entry.Name(),
+			Path: path,
+			Size: dirSize(path),
+		}
+		if stat, err := os.Stat(path); err == nil {
+			info.LastFetched = stat.ModTime()
+		}
+		if repo, err := git.PlainOpen(path); err == nil {
+			info.URL = mirrorURL(repo)
+		}
+
+		mirrors = append(mirrors, info)
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].Name < mirrors[j].Name
+	})
+
+	return mirrors, nil
+}
+
+// VerifyMirror checks that a mirror opens as a bare repository and that every ref resolves
+func VerifyMirror(path string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return fmt.Errorf("not a git repository: %w", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if !cfg.Core.IsBare {
+		return fmt.Errorf("repository is not bare")
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return fmt.Errorf("failed to list references: %w", err)
+	}
+
+	var broken []string
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		obj, err := repo.Object(plumbing.AnyObject, ref.Hash())
+		if err != nil {
+			broken = append(broken, ref.Name().String())
+			return nil
+		}
+
+		if commit, ok := obj.(*object.Commit); ok {
+			if _, err := commit.Tree(); err != nil {
+				broken = append(broken, ref.Name().String())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(broken) > 0 {
+		return fmt.Errorf("%d broken references: %s", len(broken), strings.Join(broken, ", "))
+	}
+
+	return nil
+}
+
+// dirSize returns the total size of all files under a directory
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -1,7 +1,9 @@
 package git
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,114 +14,291 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/stackfilesync/stack-sync-cli/internal/credentials"
 	"github.com/stackfilesync/stack-sync-cli/pkg/models"
 )
 
 // Operations provides Git operations wrapper
 type Operations struct {
-	repo *git.Repository
-	path string
+	repo      *git.Repository
+	path      string
+	strategy  string
+	transport *Transport // used by every operation that talks to the remote
 }
 
-// New creates a new Git operations instance
-func New(repoPath string) (*Operations, error) {
-	repo, err := git.PlainOpen(repoPath)
+// New creates a new Git operations instance for an existing checkout. Network
+// operations reach the remote through tr; a nil tr connects anonymously.
+func New(repoPath string, tr *Transport) (*Operations, error) {
+	gitRepo, err := git.PlainOpen(repoPath)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Operations{
-		repo: repo,
-		path: repoPath,
+		repo:      gitRepo,
+		path:      repoPath,
+		transport: tr,
 	}, nil
 }
 
-// Clone clones a repository to the specified path with authentication
-func Clone(repo *models.Repository, path string) (*Operations, error) {
+// CloneContext clones a repository to the specified path with authentication.
+// The repository's clone strategy is applied first; if it fails, a full clone is used instead.
+// A non-nil pin makes branch-limited strategies fetch the pinned tag or branch.
+// The remote is reached through tr, see NewTransport. Progress and status
+// messages are written to out. Cancelling ctx aborts the clone.
+func CloneContext(ctx context.Context, repo *models.Repository, path string, pin *Pin, tr *Transport, out io.Writer) (*Operations, error) {
+	if err := preparePath(path); err != nil {
+		return nil, err
+	}
+
+	strategy := repo.CloneStrategy
+	if strategy == "" || strategy == models.CloneStrategyMirror {
+		strategy = models.CloneStrategyFull
+	}
+
+	if strategy != models.CloneStrategyFull {
+		ops, err := cloneWithStrategy(ctx, repo, path, tr, strategy, pin, out)
+		if err == nil {
+			return ops, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(out, "Warning: %s clone failed (%v), falling back to full clone\n", strategy, err)
+		if err := preparePath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := &git.CloneOptions{
+		URL:      repo.URL,
+		Progress: out,
+	}
+	if pin != nil {
+		// Pinned commits may only be reachable from tags
+		opts.Tags = git.AllTags
+	}
+
+	// Clone the repository
+	var gitRepo *git.Repository
+	err := tr.retry(func() (err error) {
+		tr.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+		gitRepo, err = git.PlainCloneContext(ctx, path, false, opts)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	return &Operations{
+		repo:      gitRepo,
+		path:      path,
+		strategy:  models.CloneStrategyFull,
+		transport: tr,
+	}, nil
+}
+
+// preparePath removes any leftover content at path and creates its parent directory
+func preparePath(path string) error {
 	// Check if path exists and clean it (safe for temp directories)
 	if _, err := os.Stat(path); !os.IsNotExist(err) {
 		// Remove existing directory (likely leftover temp directory)
 		if err := os.RemoveAll(path); err != nil {
-			return nil, fmt.Errorf("failed to clean existing path: %w", err)
+			return fmt.Errorf("failed to clean existing path: %w", err)
 		}
 	}
 
 	// Create parent directory
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Determine authentication based on repo configuration
-	auth, err := getAuth(repo)
-	if err != nil {
-		return nil, fmt.Errorf("failed to setup authentication: %w", err)
+	return nil
+}
+
+// cloneWithStrategy clones only the configured branch, optionally shallow.
+// Sparse limits the worktree only: go-git can't fetch blobs lazily, so the
+// clone transfers as much as a shallow one and only the checkout is smaller.
+func cloneWithStrategy(ctx context.Context, repo *models.Repository, path string, tr *Transport, strategy string, pin *Pin, out io.Writer) (*Operations, error) {
+	depth := repo.CloneDepth
+	if depth <= 0 {
+		depth = 1
 	}
 
-	// Clone the repository
-	gitRepo, err := git.PlainClone(path, false, &git.CloneOptions{
-		URL:      repo.URL,
-		Auth:     auth,
-		Progress: os.Stdout,
+	opts := &git.CloneOptions{
+		URL:          repo.URL,
+		Progress:     out,
+		SingleBranch: true,
+	}
+	if pin != nil {
+		if pin.Name == "" {
+			return nil, fmt.Errorf("%s clone cannot target commit %s", strategy, pin.Ref)
+		}
+		opts.ReferenceName = pin.Name
+	} else if repo.Branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(repo.Branch)
+	}
+
+	switch strategy {
+	case models.CloneStrategyShallow:
+		opts.Depth = depth
+	case models.CloneStrategySingleBranch:
+		// SingleBranch is already set
+	case models.CloneStrategySparse:
+		opts.Depth = depth
+		opts.NoCheckout = true
+	default:
+		return nil, fmt.Errorf("unknown clone strategy: %s", strategy)
+	}
+
+	fmt.Fprintf(out, "Using %s clone strategy\n", strategy)
+	var gitRepo *git.Repository
+	err := tr.retry(func() (err error) {
+		tr.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+		gitRepo, err = git.PlainCloneContext(ctx, path, false, opts)
+		return err
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to clone repository: %w", err)
+		return nil, err
+	}
+
+	if strategy == models.CloneStrategySparse {
+		head, err := gitRepo.Head()
+		if err != nil {
+			return nil, err
+		}
+
+		w, err := gitRepo.Worktree()
+		if err != nil {
+			return nil, err
+		}
+
+		dirs := SparseDirectories(repo)
+		if len(dirs) > 0 {
+			fmt.Fprintf(out, "Sparse checkout (worktree only) of: %s\n", strings.Join(dirs, ", "))
+		}
+		checkout := &git.CheckoutOptions{
+			Force:                     true,
+			SparseCheckoutDirectories: dirs,
+		}
+		if head.Name().IsBranch() {
+			checkout.Branch = head.Name()
+		} else {
+			// Tag pins leave HEAD detached
+			checkout.Hash = head.Hash()
+		}
+		err = w.Checkout(checkout)
+		if err != nil {
+			return nil, fmt.Errorf("sparse checkout failed: %w", err)
+		}
 	}
 
 	return &Operations{
-		repo: gitRepo,
-		path: path,
+		repo:      gitRepo,
+		path:      path,
+		strategy:  strategy,
+		transport: tr,
 	}, nil
 }
 
-// getAuth returns appropriate authentication based on repository configuration
-func getAuth(repo *models.Repository) (transport.AuthMethod, error) {
-	// Determine auth type by URL or explicit repo_type
-	isSSH := strings.HasPrefix(repo.URL, "git@") ||
-	         strings.HasPrefix(repo.URL, "ssh://") ||
-	         strings.EqualFold(repo.RepoType, "SSH")
+// SparseDirectories returns the directories a sparse checkout needs, derived from
+// the source directory and the literal directory prefix of each file pattern
+func SparseDirectories(repo *models.Repository) []string {
+	base := strings.Trim(filepath.ToSlash(repo.SourceDirectory), "/")
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, pattern := range repo.FilePatterns {
+		prefix := literalDirPrefix(pattern)
+		if prefix == "" {
+			// Pattern may match anywhere below the source directory
+			dirs = nil
+			break
+		}
 
-	if isSSH {
-		// SSH authentication
-		return getSSHAuth()
+		dir := strings.Trim(base+"/"+prefix, "/")
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
 	}
 
-	// HTTPS authentication
-	if repo.Username != "" || repo.Password != "" {
-		// Use basic auth with username/password or token
-		username := repo.Username
-		password := repo.Password
+	if len(dirs) == 0 && base != "" {
+		return []string{base}
+	}
+	return dirs
+}
 
-		// If username is empty but password is provided, treat password as token
-		if username == "" && password != "" {
-			username = "git" // Some Git servers accept any username with token
+// literalDirPrefix returns the leading directories of a pattern that contain no glob characters
+func literalDirPrefix(pattern string) string {
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	var literal []string
+	for _, part := range parts[:len(parts)-1] {
+		if strings.ContainsAny(part, "*?[") {
+			break
 		}
+		literal = append(literal, part)
+	}
+	return strings.Join(literal, "/")
+}
 
-		if username != "" && password != "" {
-			return &http.BasicAuth{
-				Username: username,
-				Password: password,
-			}, nil
-		}
+// Strategy returns the clone strategy that produced this checkout
+func (o *Operations) Strategy() string {
+	return o.strategy
+}
+
+// getAuth returns appropriate authentication based on repository configuration
+func getAuth(repo *models.Repository) (transport.AuthMethod, error) {
+	// Determine auth type by URL or explicit repo_type
+	if IsSSH(repo) {
+		// SSH authentication
+		return getSSHAuth(repo)
+	}
+
+	// HTTPS authentication from the repository's credential sources
+	cred, err := credentials.Resolve(repo)
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		return &http.BasicAuth{
+			Username: cred.Username,
+			Password: cred.Password,
+		}, nil
 	}
 
 	// No authentication (for public repos)
 	return nil, nil
 }
 
-// Pull pulls the latest changes
-func (o *Operations) Pull() error {
+// getRejectedAuth asks git credential helpers for HTTPS credentials after the
+// remote rejected a request, or returns nil if they have none
+func getRejectedAuth(repo *models.Repository) (transport.AuthMethod, error) {
+	cred, err := credentials.ResolveRejected(repo)
+	if err != nil || cred == nil {
+		return nil, err
+	}
+	return &http.BasicAuth{
+		Username: cred.Username,
+		Password: cred.Password,
+	}, nil
+}
+
+// Pull pulls the latest changes, writing progress to out
+func (o *Operations) Pull(out io.Writer) error {
 	w, err := o.repo.Worktree()
 	if err != nil {
 		return err
 	}
 
-	auth, _ := getSSHAuth()
-
-	err = w.Pull(&git.PullOptions{
+	opts := &git.PullOptions{
 		RemoteName: "origin",
-		Auth:       auth,
-		Progress:   os.Stdout,
+		Progress:   out,
+	}
+	err = o.transport.retry(func() error {
+		o.transport.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+		return w.Pull(opts)
 	})
 
 	if err != nil && err != git.NoErrAlreadyUpToDate {
@@ -140,7 +319,7 @@ func (o *Operations) Status() (git.Status, error) {
 }
 
 // GetStatus returns the sync status of the repository
-func (o *Operations) GetStatus() (models.SyncStatus, error) {
+func (o *Operations) GetStatus(ctx context.Context) (models.SyncStatus, error) {
 	status, err := o.Status()
 	if err != nil {
 		return models.StatusError, err
@@ -152,7 +331,7 @@ func (o *Operations) GetStatus() (models.SyncStatus, error) {
 	}
 
 	// Check if behind remote
-	isBehind, err := o.IsBehindRemote()
+	isBehind, err := o.IsBehindRemote(ctx)
 	if err != nil {
 		return models.StatusError, err
 	}
@@ -165,7 +344,7 @@ func (o *Operations) GetStatus() (models.SyncStatus, error) {
 }
 
 // IsBehindRemote checks if local is behind remote
-func (o *Operations) IsBehindRemote() (bool, error) {
+func (o *Operations) IsBehindRemote(ctx context.Context) (bool, error) {
 	head, err := o.repo.Head()
 	if err != nil {
 		return false, err
@@ -176,7 +355,13 @@ func (o *Operations) IsBehindRemote() (bool, error) {
 		return false, err
 	}
 
-	refs, err := remote.List(&git.ListOptions{})
+	opts := &git.ListOptions{}
+	var refs []*plumbing.Reference
+	err = o.transport.retry(func() (err error) {
+		o.transport.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+		refs, err = remote.ListContext(ctx, opts)
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
@@ -251,31 +436,16 @@ func (o *Operations) Commit(message string) error {
 	return err
 }
 
-// Push pushes commits to remote
-func (o *Operations) Push() error {
-	auth, _ := getSSHAuth()
-
-	return o.repo.Push(&git.PushOptions{
+// Push pushes commits to remote, writing progress to out
+func (o *Operations) Push(out io.Writer) error {
+	opts := &git.PushOptions{
 		RemoteName: "origin",
-		Auth:       auth,
-		Progress:   os.Stdout,
-	})
-}
-
-// getSSHAuth returns SSH authentication
-func getSSHAuth() (*ssh.PublicKeys, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+		Progress:   out,
 	}
-
-	sshKeyPath := filepath.Join(homeDir, ".ssh", "id_rsa")
-	auth, err := ssh.NewPublicKeysFromFile("git", sshKeyPath, "")
-	if err != nil {
-		return nil, err
-	}
-
-	return auth, nil
+	return o.transport.retry(func() error {
+		o.transport.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+		return o.repo.Push(opts)
+	})
 }
 
 // IsGitRepository checks if a path is a git repository
@@ -0,0 +1,343 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// newBareRepo creates a bare repository with one commit per snapshot on main,
+// a branch named other and a tag v1.0.0 on the first commit. It returns the
+// file:// URL and the commits, oldest first.
+func newBareRepo(t *testing.T, snapshots ...map[string]string) (string, []plumbing.Hash) {
+	t.Helper()
+	work := t.TempDir()
+	repo, err := git.PlainInitWithOptions(work, &git.PlainInitOptions{InitOptions: git.InitOptions{DefaultBranch: plumbing.Main}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var commits []plumbing.Hash
+	for i, files := range snapshots {
+		for path, content := range files {
+			full := filepath.Join(work, filepath.FromSlash(path))
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := w.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(int64(1700000000+i), 0)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, hash)
+	}
+
+	if _, err := repo.CreateTag("v1.0.0", commits[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("other"), commits[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	bare := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := git.PlainClone(bare, true, &git.CloneOptions{URL: work, Mirror: true}); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + filepath.ToSlash(bare), commits
+}
+
+// checkedOut returns the files in a checkout, without .git
+func checkedOut(t *testing.T, dir string) string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return strings.Join(files, " ")
+}
+
+// depth returns how many commits of history a checkout holds below HEAD,
+// stopping at the boundary of a shallow clone
+func depth(t *testing.T, ops *Operations) int {
+	t.Helper()
+	shallow, err := ops.repo.Storer.Shallow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	boundary := make(map[plumbing.Hash]bool)
+	for _, hash := range shallow {
+		boundary[hash] = true
+	}
+
+	hash, err := ops.HeadHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for {
+		commit, err := ops.repo.CommitObject(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+		if boundary[hash] || commit.NumParents() == 0 {
+			return count
+		}
+		hash = commit.ParentHashes[0]
+	}
+}
+
+func TestCloneStrategies(t *testing.T) {
+	url, commits := newBareRepo(t,
+		map[string]string{"README.md": "v1", "api/a.proto": "a1", "docs/guide.md": "g1"},
+		map[string]string{"api/a.proto": "a2", "api/v1/b.proto": "b2"},
+		map[string]string{"api/a.proto": "a3"},
+	)
+	all := "README.md api/a.proto api/v1/b.proto docs/guide.md"
+
+	tests := []struct {
+		name         string
+		repo         models.Repository
+		pin          *Pin
+		wantStrategy string
+		wantDepth    int
+		wantFiles    string
+		wantHead     plumbing.Hash
+		wantBranches int // remote-tracking branches fetched
+	}{
+		{
+			name:         "full",
+			repo:         models.Repository{Branch: "main"},
+			wantStrategy: models.CloneStrategyFull,
+			wantDepth:    3,
+			wantFiles:    all,
+			wantBranches: 2,
+		},
+		{
+			name:         "mirror clones in full without a cache",
+			repo:         models.Repository{Branch: "main", CloneStrategy: models.CloneStrategyMirror},
+			wantStrategy: models.CloneStrategyFull,
+			wantDepth:    3,
+			wantFiles:    all,
+			wantBranches: 2,
+		},
+		{
+			name:         "shallow",
+			repo:         models.Repository{Branch: "main", CloneStrategy: models.CloneStrategyShallow},
+			wantStrategy: models.CloneStrategyShallow,
+			wantDepth:    1,
+			wantFiles:    all,
+			wantBranches: 1,
+		},
+		{
+			name:         "shallow with depth",
+			repo:         models.Repository{Branch: "main", CloneStrategy: models.CloneStrategyShallow, CloneDepth: 2},
+			wantStrategy: models.CloneStrategyShallow,
+			wantDepth:    2,
+			wantFiles:    all,
+			wantBranches: 1,
+		},
+		{
+			name:         "single branch",
+			repo:         models.Repository{Branch: "main", CloneStrategy: models.CloneStrategySingleBranch},
+			wantStrategy: models.CloneStrategySingleBranch,
+			wantDepth:    3,
+			wantFiles:    all,
+			wantBranches: 1,
+		},
+		{
+			name:         "single branch of another branch",
+			repo:         models.Repository{Branch: "other", CloneStrategy: models.CloneStrategySingleBranch},
+			wantStrategy: models.CloneStrategySingleBranch,
+			wantDepth:    1,
+			wantFiles:    "README.md api/a.proto docs/guide.md",
+			wantHead:     commits[0],
+			wantBranches: 1,
+		},
+		{
+			name:         "sparse checks out the source directory",
+			repo:         models.Repository{Branch: "main", CloneStrategy: models.CloneStrategySparse, SourceDirectory: "api"},
+			wantStrategy: models.CloneStrategySparse,
+			wantDepth:    1,
+			wantFiles:    "api/a.proto api/v1/b.proto",
+			wantBranches: 1,
+		},
+		{
+			name:         "sparse narrows to literal pattern directories",
+			repo:         models.Repository{Branch: "main", CloneStrategy: models.CloneStrategySparse, SourceDirectory: "api", FilePatterns: []string{"v1/*.proto"}},
+			wantStrategy: models.CloneStrategySparse,
+			wantDepth:    1,
+			wantFiles:    "api/v1/b.proto",
+			wantBranches: 1,
+		},
+		{
+			name:         "shallow clone of a tag pin",
+			repo:         models.Repository{CloneStrategy: models.CloneStrategyShallow},
+			pin:          &Pin{Ref: "v1.0.0", Name: plumbing.NewTagReferenceName("v1.0.0"), Hash: commits[0]},
+			wantStrategy: models.CloneStrategyShallow,
+			wantDepth:    1,
+			wantFiles:    "README.md api/a.proto docs/guide.md",
+			wantHead:     commits[0],
+		},
+		{
+			name:         "commit pins fall back to a full clone",
+			repo:         models.Repository{CloneStrategy: models.CloneStrategyShallow},
+			pin:          &Pin{Ref: commits[1].String(), Hash: commits[1]},
+			wantStrategy: models.CloneStrategyFull,
+			wantDepth:    2,
+			wantFiles:    all,
+		},
+		{
+			name:         "unknown strategies fall back to a full clone",
+			repo:         models.Repository{Branch: "main", CloneStrategy: "partial"},
+			wantStrategy: models.CloneStrategyFull,
+			wantDepth:    3,
+			wantFiles:    all,
+			wantBranches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		repo := tt.repo
+		repo.URL = url
+		path := filepath.Join(t.TempDir(), "checkout")
+		var out bytes.Buffer
+
+		ops, err := CloneContext(context.Background(), &repo, path, tt.pin, nil, &out)
+		if err != nil {
+			t.Errorf("%s: CloneContext() failed: %v\n%s", tt.name, err, out.String())
+			continue
+		}
+		if tt.pin != nil && ops.Strategy() == models.CloneStrategyFull {
+			if _, err := ops.CheckoutPin(tt.pin); err != nil {
+				t.Errorf("%s: CheckoutPin() failed: %v", tt.name, err)
+				continue
+			}
+		}
+
+		if got := ops.Strategy(); got != tt.wantStrategy {
+			t.Errorf("%s: strategy = %s, want %s", tt.name, got, tt.wantStrategy)
+		}
+		fellBack := strings.Contains(out.String(), "falling back to full clone")
+		if want := tt.repo.CloneStrategy != "" && tt.repo.CloneStrategy != models.CloneStrategyMirror && tt.wantStrategy == models.CloneStrategyFull; fellBack != want {
+			t.Errorf("%s: fallback reported = %v, want %v", tt.name, fellBack, want)
+		}
+		if got := depth(t, ops); got != tt.wantDepth {
+			t.Errorf("%s: depth = %d, want %d", tt.name, got, tt.wantDepth)
+		}
+		if got := checkedOut(t, path); got != tt.wantFiles {
+			t.Errorf("%s: checked out %q, want %q", tt.name, got, tt.wantFiles)
+		}
+
+		head, err := ops.HeadHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantHead := tt.wantHead
+		if wantHead.IsZero() {
+			wantHead = commits[len(commits)-1]
+			if tt.pin != nil {
+				wantHead = tt.pin.Hash
+			}
+		}
+		if head != wantHead {
+			t.Errorf("%s: HEAD = %s, want %s", tt.name, head, wantHead)
+		}
+
+		if tt.wantBranches > 0 {
+			refs, err := ops.repo.References()
+			if err != nil {
+				t.Fatal(err)
+			}
+			branches := 0
+			refs.ForEach(func(ref *plumbing.Reference) error {
+				if ref.Name().IsRemote() && ref.Type() == plumbing.HashReference {
+					branches++
+				}
+				return nil
+			})
+			if branches != tt.wantBranches {
+				t.Errorf("%s: fetched %d branches, want %d", tt.name, branches, tt.wantBranches)
+			}
+		}
+	}
+}
+
+func TestSparseDirectories(t *testing.T) {
+	tests := []struct {
+		source   string
+		patterns []string
+		want     string
+	}{
+		{source: "api", want: "api"},
+		{source: "/api/proto/", patterns: []string{"*.proto"}, want: "api/proto"},
+		{source: "api", patterns: []string{"v1/*.proto", "v2/*.proto", "v1/*.json"}, want: "api/v1 api/v2"},
+		{source: "api", patterns: []string{"v1/*.proto", "*.json"}, want: "api"},
+		{source: "", patterns: []string{"proto/v1/*.proto"}, want: "proto/v1"},
+		{source: "", patterns: []string{"*.proto"}, want: ""},
+		{source: "api", patterns: []string{"v*/a.proto"}, want: "api"},
+	}
+
+	for _, tt := range tests {
+		repo := &models.Repository{SourceDirectory: tt.source, FilePatterns: tt.patterns}
+		if got := strings.Join(SparseDirectories(repo), " "); got != tt.want {
+			t.Errorf("SparseDirectories(%q, %v) = %q, want %q", tt.source, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestLiteralDirPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"*.proto", ""},
+		{"v1/*.proto", "v1"},
+		{"v1/events/*.proto", "v1/events"},
+		{"v1/*/a.proto", "v1"},
+		{"v[12]/a.proto", ""},
+		{"a.proto", ""},
+	}
+
+	for _, tt := range tests {
+		if got := literalDirPrefix(tt.pattern); got != tt.want {
+			t.Errorf("literalDirPrefix(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
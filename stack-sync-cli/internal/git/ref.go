@@ -0,0 +1,266 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stackfilesync/stack-sync-cli/internal/semver"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// Pin is a configured ref resolved to a concrete commit
+type Pin struct {
+	Ref   string                 // ref as configured: tag, branch, commit SHA or semver constraint
+	Name  plumbing.ReferenceName // tag or branch the ref resolved to, empty for commit SHAs
+	Hash  plumbing.Hash          // resolved object; zero while Short is still unresolved
+	Short string                 // abbreviated SHA that can only be resolved after fetching
+}
+
+// String returns a short description such as "v1.4.2 (1a2b3c4d)"
+func (p *Pin) String() string {
+	name := p.Name.Short()
+	if p.Name == "" {
+		name = p.Ref
+	}
+	if p.Hash.IsZero() {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, p.Hash.String()[:8])
+}
+
+var hexPattern = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// ListRemoteRefs lists the references advertised by the remote, including peeled tags
+func ListRemoteRefs(ctx context.Context, repo *models.Repository, tr *Transport) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repo.URL},
+	})
+
+	opts := &git.ListOptions{
+		PeelingOption: git.AppendPeeled,
+	}
+	var refs []*plumbing.Reference
+	err := tr.retry(func() (err error) {
+		tr.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert, &opts.ClientKey, &opts.InsecureSkipTLS)
+		refs, err = remote.ListContext(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote references: %w", err)
+	}
+
+	return refs, nil
+}
+
+// ResolvePin resolves the repository's ref against the remote without cloning it
+func ResolvePin(ctx context.Context, repo *models.Repository, tr *Transport) (*Pin, error) {
+	refs, err := ListRemoteRefs(ctx, repo, tr)
+	if err != nil {
+		return nil, err
+	}
+	return ResolvePinFrom(repo.Ref, refs)
+}
+
+// ResolvePinFrom resolves a ref against a list of references. Exact tag and
+// branch names win over semver constraints; anything else that looks like
+// hex is treated as a commit SHA.
+func ResolvePinFrom(ref string, refs []*plumbing.Reference) (*Pin, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("empty ref")
+	}
+
+	hashes := peeledHashes(refs)
+
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewTagReferenceName(ref),
+		plumbing.NewBranchReferenceName(ref),
+	} {
+		if hash, ok := hashes[name]; ok {
+			return &Pin{Ref: ref, Name: name, Hash: hash}, nil
+		}
+	}
+
+	if semver.IsConstraint(ref) {
+		constraint, err := semver.ParseConstraint(ref)
+		if err == nil {
+			versions := TagVersions(refs)
+			if latest := semver.Latest(versions, constraint); latest != nil {
+				name := plumbing.NewTagReferenceName(latest.Original)
+				return &Pin{Ref: ref, Name: name, Hash: hashes[name]}, nil
+			}
+			if !hexPattern.MatchString(ref) {
+				return nil, fmt.Errorf("no tag matches %s", ref)
+			}
+		} else if !hexPattern.MatchString(ref) {
+			return nil, err
+		}
+	}
+
+	if hexPattern.MatchString(ref) {
+		if len(ref) == 40 {
+			return &Pin{Ref: ref, Hash: plumbing.NewHash(ref)}, nil
+		}
+		return &Pin{Ref: ref, Short: strings.ToLower(ref)}, nil
+	}
+
+	return nil, fmt.Errorf("ref not found on remote: %s", ref)
+}
+
+// TagVersions returns the tags that parse as semantic versions
+func TagVersions(refs []*plumbing.Reference) []*semver.Version {
+	var versions []*semver.Version
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		tag := strings.TrimSuffix(ref.Name().Short(), "^{}")
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		if v, err := semver.Parse(tag); err == nil {
+			v.Original = tag
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// TagsForCommit returns the tags in refs that point at the given commit
+func TagsForCommit(refs []*plumbing.Reference, commit string) []string {
+	var tags []string
+	for name, hash := range peeledHashes(refs) {
+		if name.IsTag() && hash.String() == commit {
+			tags = append(tags, name.Short())
+		}
+	}
+	return tags
+}
+
+// PeeledHash returns the commit a reference points at, following annotated tags when advertised
+func PeeledHash(refs []*plumbing.Reference, name plumbing.ReferenceName) plumbing.Hash {
+	return peeledHashes(refs)[name]
+}
+
+// peeledHashes maps reference names to hashes, preferring the peeled "^{}" entries of annotated tags
+func peeledHashes(refs []*plumbing.Reference) map[plumbing.ReferenceName]plumbing.Hash {
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+	peeled := make(map[plumbing.ReferenceName]bool)
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		name := ref.Name().String()
+		if strings.HasSuffix(name, "^{}") {
+			base := plumbing.ReferenceName(strings.TrimSuffix(name, "^{}"))
+			hashes[base] = ref.Hash()
+			peeled[base] = true
+			continue
+		}
+		if !peeled[ref.Name()] {
+			hashes[ref.Name()] = ref.Hash()
+		}
+	}
+	return hashes
+}
+
+// peelToCommit resolves short hashes and annotated tags to a commit hash
+func peelToCommit(repo *git.Repository, pin *Pin) (plumbing.Hash, error) {
+	hash := pin.Hash
+	if hash.IsZero() {
+		resolved, err := repo.ResolveRevision(plumbing.Revision(pin.Short))
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("commit not found: %s", pin.Short)
+		}
+		hash = *resolved
+	}
+
+	obj, err := repo.Object(plumbing.AnyObject, hash)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("object not found: %s", hash)
+	}
+
+	for {
+		switch o := obj.(type) {
+		case *object.Commit:
+			return o.Hash, nil
+		case *object.Tag:
+			obj, err = o.Object()
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+		default:
+			return plumbing.ZeroHash, fmt.Errorf("%s does not point to a commit", pin.Ref)
+		}
+	}
+}
+
+// ResolvePin resolves a ref against the references stored in the mirror
+func (m *Mirror) ResolvePin(ref string) (*Pin, error) {
+	iter, err := m.repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+
+	var refs []*plumbing.Reference
+	iter.ForEach(func(r *plumbing.Reference) error {
+		refs = append(refs, r)
+		return nil
+	})
+
+	pin, err := ResolvePinFrom(ref, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	pin.Hash, err = peelToCommit(m.repo, pin)
+	if err != nil {
+		return nil, err
+	}
+	return pin, nil
+}
+
+// CheckoutPin checks out the commit a pin resolved to (detached HEAD)
+func (o *Operations) CheckoutPin(pin *Pin) (plumbing.Hash, error) {
+	hash, err := peelToCommit(o.repo, pin)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	w, err := o.repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to checkout %s: %w", pin.Ref, err)
+	}
+
+	pin.Hash = hash
+	return hash, nil
+}
+
+// HeadHash returns the commit currently checked out
+func (o *Operations) HeadHash() (plumbing.Hash, error) {
+	head, err := o.repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return head.Hash(), nil
+}
+
+// NewHash parses a hex commit hash
+func NewHash(s string) plumbing.Hash {
+	return plumbing.NewHash(s)
+}
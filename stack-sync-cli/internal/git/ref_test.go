@@ -0,0 +1,112 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// testRefs is what a remote advertises: branches, lightweight tags and an
+// annotated tag with its peeled commit
+func testRefs() []*plumbing.Reference {
+	hash := func(c string) plumbing.Hash { return plumbing.NewHash(strings.Repeat(c, 40)) }
+	return []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/main", hash("a")),
+		plumbing.NewHashReference("refs/heads/release", hash("b")),
+		plumbing.NewHashReference("refs/tags/v1.0.0", hash("1")),
+		plumbing.NewHashReference("refs/tags/v1.4.2", hash("2")),
+		plumbing.NewHashReference("refs/tags/v1.5.0-rc.1", hash("3")),
+		plumbing.NewHashReference("refs/tags/v2.0.0", hash("4")),
+		plumbing.NewHashReference("refs/tags/v2.0.0^{}", hash("5")),
+		plumbing.NewHashReference("refs/tags/nightly", hash("6")),
+		plumbing.NewHashReference("refs/tags/1.4", hash("7")),
+	}
+}
+
+func TestResolvePinFrom(t *testing.T) {
+	full := strings.Repeat("c", 40)
+
+	tests := []struct {
+		ref       string
+		wantName  plumbing.ReferenceName
+		wantHash  string
+		wantShort string
+		wantErr   bool
+	}{
+		{ref: "main", wantName: "refs/heads/main", wantHash: strings.Repeat("a", 40)},
+		{ref: "nightly", wantName: "refs/tags/nightly", wantHash: strings.Repeat("6", 40)},
+		{ref: "v1.4.2", wantName: "refs/tags/v1.4.2", wantHash: strings.Repeat("2", 40)},
+		// Annotated tags resolve to the commit they point at
+		{ref: "v2.0.0", wantName: "refs/tags/v2.0.0", wantHash: strings.Repeat("5", 40)},
+		// An exact tag name wins over the constraint it also parses as
+		{ref: "1.4", wantName: "refs/tags/1.4", wantHash: strings.Repeat("7", 40)},
+		{ref: "^1.0", wantName: "refs/tags/v1.4.2", wantHash: strings.Repeat("2", 40)},
+		{ref: "~1.0.0", wantName: "refs/tags/v1.0.0", wantHash: strings.Repeat("1", 40)},
+		{ref: ">=1.5.0-rc.1 <2", wantName: "refs/tags/v1.5.0-rc.1", wantHash: strings.Repeat("3", 40)},
+		{ref: "*", wantName: "refs/tags/v2.0.0", wantHash: strings.Repeat("5", 40)},
+		{ref: full, wantHash: full},
+		{ref: "ABCDEF12", wantShort: "abcdef12"},
+		// All digits parses as a partial version, but no tag matches it
+		{ref: "1234567", wantShort: "1234567"},
+		{ref: "^3", wantErr: true},
+		{ref: "feature/x", wantErr: true},
+		{ref: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		pin, err := ResolvePinFrom(tt.ref, testRefs())
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ResolvePinFrom(%q) = %v, want error", tt.ref, pin)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolvePinFrom(%q) failed: %v", tt.ref, err)
+			continue
+		}
+
+		if pin.Name != tt.wantName {
+			t.Errorf("ResolvePinFrom(%q).Name = %q, want %q", tt.ref, pin.Name, tt.wantName)
+		}
+		if tt.wantHash != "" && pin.Hash.String() != tt.wantHash {
+			t.Errorf("ResolvePinFrom(%q).Hash = %s, want %s", tt.ref, pin.Hash, tt.wantHash)
+		}
+		if tt.wantHash == "" && !pin.Hash.IsZero() {
+			t.Errorf("ResolvePinFrom(%q).Hash = %s, want zero", tt.ref, pin.Hash)
+		}
+		if pin.Short != tt.wantShort {
+			t.Errorf("ResolvePinFrom(%q).Short = %q, want %q", tt.ref, pin.Short, tt.wantShort)
+		}
+	}
+}
+
+func TestTagVersions(t *testing.T) {
+	got := map[string]bool{}
+	for _, v := range TagVersions(testRefs()) {
+		if got[v.Original] {
+			t.Errorf("TagVersions() returned %s twice", v.Original)
+		}
+		got[v.Original] = true
+	}
+
+	for _, tag := range []string{"v1.0.0", "v1.4.2", "v1.5.0-rc.1", "v2.0.0", "1.4"} {
+		if !got[tag] {
+			t.Errorf("TagVersions() is missing %s", tag)
+		}
+	}
+	if got["nightly"] || len(got) != 5 {
+		t.Errorf("TagVersions() = %v, want only the semver tags", got)
+	}
+}
+
+func TestTagsForCommit(t *testing.T) {
+	tags := TagsForCommit(testRefs(), strings.Repeat("5", 40))
+	if len(tags) != 1 || tags[0] != "v2.0.0" {
+		t.Errorf("TagsForCommit(peeled v2.0.0) = %v, want [v2.0.0]", tags)
+	}
+	if tags := TagsForCommit(testRefs(), strings.Repeat("4", 40)); len(tags) != 0 {
+		t.Errorf("TagsForCommit(annotated tag object) = %v, want none", tags)
+	}
+}
@@ -0,0 +1,227 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+	sshagent "github.com/xanzy/ssh-agent"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// defaultSSHKeys are tried, in order, when a repository sets no ssh_key
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshConfig looks up settings of ~/.ssh/config and /etc/ssh/ssh_config
+var sshConfig interface {
+	Get(alias, key string) string
+	GetAll(alias, key string) []string
+} = ssh_config.DefaultUserSettings
+
+// IsSSH reports whether a repository is fetched over SSH: ssh:// URLs,
+// scp-like URLs such as git@host:repo or host-alias:repo, or repo_type SSH
+func IsSSH(repo *models.Repository) bool {
+	if strings.EqualFold(repo.RepoType, "SSH") {
+		return true
+	}
+	endpoint, err := transport.NewEndpoint(repo.URL)
+	return err == nil && endpoint.Protocol == "ssh"
+}
+
+// getSSHAuth returns SSH authentication for a repository. Keys are offered in
+// this order: the repository's ssh_key, keys held by ssh-agent unless
+// use_agent is false, then without ssh_key the IdentityFile entries of
+// ~/.ssh/config for the host and ~/.ssh/id_ed25519, id_ecdsa and id_rsa.
+// Host keys are always verified against known_hosts.
+func getSSHAuth(repo *models.Repository) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(repo.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH URL %s: %w", repo.URL, err)
+	}
+
+	var signers []gossh.Signer
+	var tried []string
+
+	if repo.SSHKey != "" {
+		signer, err := loadSSHKey(expandHome(repo.SSHKey), repo.SSHPassphraseEnv)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	if repo.UseAgent == nil || *repo.UseAgent {
+		tried = append(tried, "ssh-agent")
+		agentSigners, err := sshAgentSigners()
+		if err != nil && repo.UseAgent != nil {
+			return nil, err
+		}
+		signers = append(signers, agentSigners...)
+	}
+
+	if repo.SSHKey == "" {
+		seen := make(map[string]bool)
+		for _, path := range defaultSSHKeyPaths(endpoint.Host) {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			tried = append(tried, path)
+
+			signer, err := loadSSHKey(path, repo.SSHPassphraseEnv)
+			if err != nil {
+				// An encrypted default key without a passphrase isn't fatal,
+				// another key or the agent may still work
+				continue
+			}
+			signers = append(signers, signer)
+		}
+	}
+
+	if len(signers) == 0 {
+		if len(tried) == 0 {
+			return nil, errors.New("no SSH key found, set ssh_key or start ssh-agent")
+		}
+		return nil, fmt.Errorf("no usable SSH key found (tried %s), set ssh_key or ssh_passphrase_env", strings.Join(tried, ", "))
+	}
+
+	hostKeys, err := knownHostsCallback(repo, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.PublicKeysCallback{
+		User: sshUser(endpoint),
+		Callback: func() ([]gossh.Signer, error) {
+			return signers, nil
+		},
+		HostKeyCallbackHelper: hostKeys,
+	}, nil
+}
+
+// loadSSHKey reads a private key, decrypting it with the passphrase in the
+// environment variable passphraseEnv if the key is encrypted
+func loadSSHKey(path, passphraseEnv string) (gossh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+
+	signer, err := gossh.ParsePrivateKey(data)
+	var missing *gossh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase := ""
+		if passphraseEnv != "" {
+			passphrase = os.Getenv(passphraseEnv)
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("SSH key %s is encrypted, set ssh_passphrase_env to a variable holding its passphrase", path)
+		}
+		signer, err = gossh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", path, err)
+	}
+
+	return signer, nil
+}
+
+// sshAgentSigners returns the keys held by the running ssh-agent. The agent
+// connection stays open for the signers to use.
+func sshAgentSigners() ([]gossh.Signer, error) {
+	agent, _, err := sshagent.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+
+	signers, err := agent.Signers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	return signers, nil
+}
+
+// defaultSSHKeyPaths returns the IdentityFile entries of ~/.ssh/config for
+// host, followed by the default key files
+func defaultSSHKeyPaths(host string) []string {
+	var paths []string
+	for _, path := range sshConfig.GetAll(host, "IdentityFile") {
+		paths = append(paths, expandHome(path))
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return paths
+	}
+	for _, name := range defaultSSHKeys {
+		paths = append(paths, filepath.Join(homeDir, ".ssh", name))
+	}
+	return paths
+}
+
+// sshUser returns the user of an SSH URL, the User of ~/.ssh/config for its
+// host, or git
+func sshUser(endpoint *transport.Endpoint) string {
+	if endpoint.User != "" {
+		return endpoint.User
+	}
+	if user := sshConfig.Get(endpoint.Host, "User"); user != "" {
+		return user
+	}
+	return "git"
+}
+
+// knownHostsCallback verifies host keys against the repository's known_hosts
+// file, or the default known_hosts files. Host key algorithms are limited to
+// the ones known for the host, so servers offering several keys still match.
+func knownHostsCallback(repo *models.Repository, endpoint *transport.Endpoint) (ssh.HostKeyCallbackHelper, error) {
+	var files []string
+	if repo.KnownHosts != "" {
+		files = append(files, expandHome(repo.KnownHosts))
+	}
+
+	db, err := ssh.NewKnownHostsDb(files...)
+	if err != nil {
+		return ssh.HostKeyCallbackHelper{}, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+
+	// Resolve host aliases the same way the SSH transport does
+	host := endpoint.Host
+	if hostname := sshConfig.Get(endpoint.Host, "Hostname"); hostname != "" {
+		host = hostname
+	}
+	port := fmt.Sprint(endpoint.Port)
+	if endpoint.Port == 0 || endpoint.Port == 22 {
+		port = "22"
+		if configPort := sshConfig.Get(endpoint.Host, "Port"); configPort != "" {
+			port = configPort
+		}
+	}
+
+	return ssh.HostKeyCallbackHelper{
+		HostKeyCallback:   db.HostKeyCallback(),
+		HostKeyAlgorithms: db.HostKeyAlgorithms(net.JoinHostPort(host, port)),
+	}, nil
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,388 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHConfig serves ssh_config settings from a decoded file
+type testSSHConfig struct {
+	config *ssh_config.Config
+}
+
+// Get implements sshConfig
+func (c testSSHConfig) Get(alias, key string) string {
+	value, _ := c.config.Get(alias, key)
+	return value
+}
+
+// GetAll implements sshConfig
+func (c testSSHConfig) GetAll(alias, key string) []string {
+	values, _ := c.config.GetAll(alias, key)
+	return values
+}
+
+// sshHome points HOME at a temporary directory with an empty known_hosts,
+// stops ssh-agent from being found and uses config as ~/.ssh/config
+func sshHome(t *testing.T, config string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("SSH_KNOWN_HOSTS", "")
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := ssh_config.Decode(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := sshConfig
+	sshConfig = testSSHConfig{config: decoded}
+	t.Cleanup(func() { sshConfig = previous })
+	return home
+}
+
+// newSSHKey writes a new ed25519 private key to path, encrypted if passphrase
+// isn't empty, and returns the key
+func newSSHKey(t *testing.T, path, passphrase string) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = gossh.MarshalPrivateKey(key, "")
+	} else {
+		block, err = gossh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// startSSHAgent serves keys from an in-process ssh-agent on SSH_AUTH_SOCK
+func startSSHAgent(t *testing.T, keys ...ed25519.PrivateKey) {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	for _, key := range keys {
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+}
+
+// publicKey returns the SSH public key of key
+func publicKey(t *testing.T, key ed25519.PrivateKey) gossh.PublicKey {
+	t.Helper()
+	pub, err := gossh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+// offeredKeys returns the names of the keys auth offers, in order
+func offeredKeys(t *testing.T, auth transport.AuthMethod, names map[string]ed25519.PrivateKey) string {
+	t.Helper()
+	callback, ok := auth.(*ssh.PublicKeysCallback)
+	if !ok {
+		t.Fatalf("auth is %T, want *ssh.PublicKeysCallback", auth)
+	}
+	signers, err := callback.Callback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offered []string
+	for _, signer := range signers {
+		name := "unknown"
+		for candidate, key := range names {
+			if string(signer.PublicKey().Marshal()) == string(publicKey(t, key).Marshal()) {
+				name = candidate
+			}
+		}
+		offered = append(offered, name)
+	}
+	return strings.Join(offered, " ")
+}
+
+func TestGetSSHAuthKeyOrder(t *testing.T) {
+	home := sshHome(t, `Host work
+  HostName git.example.com
+  User deploy
+  IdentityFile ~/.ssh/work_key
+  IdentityFile ~/.ssh/id_ed25519
+`)
+	sshDir := filepath.Join(home, ".ssh")
+	_, agentKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]ed25519.PrivateKey{
+		"repo":       newSSHKey(t, filepath.Join(home, "keys", "repo_key"), ""),
+		"work_key":   newSSHKey(t, filepath.Join(sshDir, "work_key"), ""),
+		"id_ed25519": newSSHKey(t, filepath.Join(sshDir, "id_ed25519"), ""),
+		"id_ecdsa":   newSSHKey(t, filepath.Join(sshDir, "id_ecdsa"), ""),
+		"id_rsa":     newSSHKey(t, filepath.Join(sshDir, "id_rsa"), "secret"),
+		"agent":      agentKey,
+	}
+	no, yes := false, true
+
+	tests := []struct {
+		name       string
+		repo       models.Repository
+		agent      bool
+		passphrase string
+		want       string
+		wantUser   string
+	}{
+		{
+			name:     "repository key, then agent",
+			repo:     models.Repository{URL: "git@github.com:org/repo.git", SSHKey: "~/keys/repo_key"},
+			agent:    true,
+			want:     "repo agent",
+			wantUser: "git",
+		},
+		{
+			name:     "repository key without agent",
+			repo:     models.Repository{URL: "ssh://git@github.com/org/repo.git", SSHKey: "~/keys/repo_key"},
+			want:     "repo",
+			wantUser: "git",
+		},
+		{
+			name:     "agent, ssh_config identity files, then defaults",
+			repo:     models.Repository{URL: "work:org/repo.git"},
+			agent:    true,
+			want:     "agent work_key id_ed25519 id_ecdsa",
+			wantUser: "deploy",
+		},
+		{
+			name:     "use_agent false",
+			repo:     models.Repository{URL: "work:org/repo.git", UseAgent: &no},
+			agent:    true,
+			want:     "work_key id_ed25519 id_ecdsa",
+			wantUser: "deploy",
+		},
+		{
+			name:     "defaults only for hosts without identity files",
+			repo:     models.Repository{URL: "git@github.com:org/repo.git"},
+			want:     "id_ed25519 id_ecdsa",
+			wantUser: "git",
+		},
+		{
+			name:       "encrypted default key with its passphrase",
+			repo:       models.Repository{URL: "git@github.com:org/repo.git", SSHPassphraseEnv: "TEST_SSH_PASSPHRASE"},
+			passphrase: "secret",
+			want:       "id_ed25519 id_ecdsa id_rsa",
+			wantUser:   "git",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("SSH_AUTH_SOCK", "")
+		if tt.agent {
+			startSSHAgent(t, keys["agent"])
+		}
+		t.Setenv("TEST_SSH_PASSPHRASE", tt.passphrase)
+
+		repo := tt.repo
+		auth, err := getSSHAuth(&repo)
+		if err != nil {
+			t.Errorf("%s: getSSHAuth() failed: %v", tt.name, err)
+			continue
+		}
+		if got := offeredKeys(t, auth, keys); got != tt.want {
+			t.Errorf("%s: offered %q, want %q", tt.name, got, tt.want)
+		}
+		if user := auth.(*ssh.PublicKeysCallback).User; user != tt.wantUser {
+			t.Errorf("%s: user = %q, want %q", tt.name, user, tt.wantUser)
+		}
+	}
+
+	// use_agent: true requires a running agent
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := getSSHAuth(&models.Repository{URL: "git@github.com:org/repo.git", UseAgent: &yes}); err == nil || !strings.Contains(err.Error(), "ssh-agent") {
+		t.Errorf("getSSHAuth() with use_agent and no agent = %v", err)
+	}
+
+	// A broken repository key is fatal, broken default keys are skipped
+	if _, err := getSSHAuth(&models.Repository{URL: "git@github.com:org/repo.git", SSHKey: "~/keys/missing"}); err == nil {
+		t.Error("getSSHAuth() with a missing ssh_key succeeded")
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa"} {
+		if err := os.Remove(filepath.Join(sshDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = getSSHAuth(&models.Repository{URL: "git@github.com:org/repo.git"})
+	if err == nil || !strings.Contains(err.Error(), "tried ssh-agent, "+filepath.Join(sshDir, "id_rsa")) {
+		t.Errorf("getSSHAuth() with only an encrypted key = %v", err)
+	}
+	if _, err := getSSHAuth(&models.Repository{URL: "git@github.com:org/repo.git", UseAgent: &no}); err == nil {
+		t.Error("getSSHAuth() without any usable key succeeded")
+	}
+}
+
+func TestLoadSSHKey(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain")
+	encrypted := filepath.Join(dir, "encrypted")
+	garbage := filepath.Join(dir, "garbage")
+	plainKey := newSSHKey(t, plain, "")
+	encryptedKey := newSSHKey(t, encrypted, "secret")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		env        string
+		passphrase string
+		want       ed25519.PrivateKey
+		wantErr    string
+	}{
+		{name: "plain", path: plain, want: plainKey},
+		{name: "plain ignores the passphrase", path: plain, env: "TEST_SSH_PASSPHRASE", passphrase: "unused", want: plainKey},
+		{name: "encrypted", path: encrypted, env: "TEST_SSH_PASSPHRASE", passphrase: "secret", want: encryptedKey},
+		{name: "encrypted without ssh_passphrase_env", path: encrypted, wantErr: "set ssh_passphrase_env"},
+		{name: "encrypted with an empty variable", path: encrypted, env: "TEST_SSH_PASSPHRASE", wantErr: "set ssh_passphrase_env"},
+		{name: "wrong passphrase", path: encrypted, env: "TEST_SSH_PASSPHRASE", passphrase: "wrong", wantErr: "failed to load SSH key"},
+		{name: "missing", path: filepath.Join(dir, "missing"), wantErr: "failed to read SSH key"},
+		{name: "not a key", path: garbage, wantErr: "failed to load SSH key"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_SSH_PASSPHRASE", tt.passphrase)
+		signer, err := loadSSHKey(tt.path, tt.env)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: loadSSHKey() error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: loadSSHKey() failed: %v", tt.name, err)
+			continue
+		}
+		if string(signer.PublicKey().Marshal()) != string(publicKey(t, tt.want).Marshal()) {
+			t.Errorf("%s: loaded the wrong key", tt.name)
+		}
+	}
+}
+
+func TestKnownHostsCallback(t *testing.T) {
+	home := sshHome(t, `Host work
+  HostName git.example.com
+  Port 2222
+`)
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	line := knownhosts.Line([]string{knownhosts.Normalize("git.example.com:2222"), knownhosts.Normalize("192.0.2.1:2222")}, publicKey(t, hostKey))
+	custom := filepath.Join(home, "custom_known_hosts")
+	if err := os.WriteFile(custom, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2222}
+
+	endpoint, err := transport.NewEndpoint("work:org/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The custom file knows the host behind the alias, at the configured port
+	helper, err := knownHostsCallback(&models.Repository{KnownHosts: "~/custom_known_hosts"}, endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(helper.HostKeyAlgorithms, " "); got != gossh.KeyAlgoED25519 {
+		t.Errorf("host key algorithms = %q, want %s", got, gossh.KeyAlgoED25519)
+	}
+	if err := helper.HostKeyCallback("git.example.com:2222", remote, publicKey(t, hostKey)); err != nil {
+		t.Errorf("known host key rejected: %v", err)
+	}
+	if err := helper.HostKeyCallback("git.example.com:2222", remote, publicKey(t, otherKey)); err == nil {
+		t.Error("changed host key accepted")
+	}
+
+	// The default known_hosts doesn't know the host
+	helper, err = knownHostsCallback(&models.Repository{}, endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(helper.HostKeyAlgorithms) != 0 {
+		t.Errorf("host key algorithms from the empty known_hosts = %v", helper.HostKeyAlgorithms)
+	}
+	if err := helper.HostKeyCallback("git.example.com:2222", remote, publicKey(t, hostKey)); err == nil {
+		t.Error("unknown host accepted")
+	}
+
+	if _, err := knownHostsCallback(&models.Repository{KnownHosts: filepath.Join(home, "missing")}, endpoint); err == nil || !strings.Contains(err.Error(), "known_hosts") {
+		t.Errorf("knownHostsCallback() with a missing known_hosts = %v", err)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	tests := map[string]string{
+		"~":                 home,
+		"~/.ssh/id_ed25519": filepath.Join(home, ".ssh", "id_ed25519"),
+		"~user/key":         "~user/key",
+		"/etc/ssh/key":      "/etc/ssh/key",
+		"relative/~/key":    "relative/~/key",
+		"":                  "",
+	}
+	for path, want := range tests {
+		if got := expandHome(path); got != want {
+			t.Errorf("expandHome(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package git
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stackfilesync/stack-sync-cli/internal/credentials"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Transport is what every network operation on a repository's remote needs:
+// the resolved authentication, and the TLS and proxy settings. A nil
+// *Transport connects anonymously with default settings.
+type Transport struct {
+	Auth            transport.AuthMethod
+	ProxyOptions    transport.ProxyOptions
+	CABundle        []byte // PEM certificates trusted in addition to the system pool
+	ClientCert      []byte // PEM client certificate for mutual TLS
+	ClientKey       []byte // PEM key of ClientCert
+	InsecureSkipTLS bool
+
+	// rejected looks up credentials with git credential helpers once the
+	// remote rejected a request, see retry
+	rejected func() (transport.AuthMethod, error)
+}
+
+// NewTransport resolves how to reach a repository's remote: its credentials,
+// and its proxy and TLS settings applied over the global defaults
+func NewTransport(repo *models.Repository, defaults models.NetworkConfig) (*Transport, error) {
+	auth, err := getAuth(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup authentication: %w", err)
+	}
+
+	network := defaults.Merge(repo.NetworkConfig)
+	tr := &Transport{Auth: auth, InsecureSkipTLS: network.InsecureSkipTLS}
+	if !IsSSH(repo) {
+		tr.rejected = func() (transport.AuthMethod, error) { return getRejectedAuth(repo) }
+	}
+
+	if network.CABundle != "" {
+		tr.CABundle, err = os.ReadFile(expandHome(network.CABundle))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_bundle: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(tr.CABundle) {
+			return nil, fmt.Errorf("ca_bundle %s contains no PEM certificates", network.CABundle)
+		}
+	}
+
+	if network.ClientCert != "" || network.ClientKey != "" {
+		if network.ClientCert == "" || network.ClientKey == "" {
+			return nil, errors.New("client_cert and client_key must be set together")
+		}
+		if tr.ClientCert, err = os.ReadFile(expandHome(network.ClientCert)); err != nil {
+			return nil, fmt.Errorf("failed to read client_cert: %w", err)
+		}
+		if tr.ClientKey, err = os.ReadFile(expandHome(network.ClientKey)); err != nil {
+			return nil, fmt.Errorf("failed to read client_key: %w", err)
+		}
+		if _, err := tls.X509KeyPair(tr.ClientCert, tr.ClientKey); err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+	}
+
+	proxy, source, err := ProxyFor(repo.URL, network.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if source == "config" {
+		tr.ProxyOptions.URL = (&url.URL{Scheme: proxy.Scheme, Host: proxy.Host}).String()
+		if proxy.User != nil {
+			tr.ProxyOptions.Username = proxy.User.Username()
+			tr.ProxyOptions.Password, _ = proxy.User.Password()
+		}
+	}
+
+	return tr, nil
+}
+
+// ProxyFor returns the proxy connections to rawURL go through, and where the
+// proxy came from: "config", "environment", or "" for direct connections.
+// ${VAR} references in configured are expanded. Hosts listed in NO_PROXY are
+// always reached directly. Over SSH only configured socks5 proxies are used.
+func ProxyFor(rawURL, configured string) (*url.URL, string, error) {
+	configured, err := credentials.ExpandEnv(configured)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid proxy: %w", err)
+	}
+
+	endpoint, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if endpoint.Protocol == "ssh" {
+		if configured == "" {
+			return nil, "", nil
+		}
+		proxy, err := url.Parse(configured)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid proxy: %w", err)
+		}
+		if proxy.Scheme != "socks5" {
+			return nil, "", fmt.Errorf("SSH remotes can only use socks5 proxies, not %s", proxy.Scheme)
+		}
+		return proxy, "config", nil
+	}
+	if endpoint.Protocol != "http" && endpoint.Protocol != "https" {
+		return nil, "", nil
+	}
+
+	target := &url.URL{Scheme: endpoint.Protocol, Host: endpoint.Host}
+	if endpoint.Port != 0 {
+		target.Host = net.JoinHostPort(endpoint.Host, fmt.Sprint(endpoint.Port))
+	}
+
+	if configured == "" {
+		// The default HTTP transport reads the environment itself
+		proxy, err := httpproxy.FromEnvironment().ProxyFunc()(target)
+		if err != nil || proxy == nil {
+			return nil, "", err
+		}
+		return proxy, "environment", nil
+	}
+
+	env := httpproxy.FromEnvironment()
+	config := &httpproxy.Config{HTTPProxy: configured, HTTPSProxy: configured, NoProxy: env.NoProxy}
+	proxy, err := config.ProxyFunc()(target)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid proxy: %w", err)
+	}
+	if proxy == nil {
+		return nil, "", nil
+	}
+	return proxy, "config", nil
+}
+
+// apply fills the transport fields every go-git option struct has, like
+// tr.apply(&opts.Auth, &opts.ProxyOptions, &opts.CABundle, &opts.ClientCert,
+// &opts.ClientKey, &opts.InsecureSkipTLS). A nil transport leaves them unset.
+func (t *Transport) apply(auth *transport.AuthMethod, proxy *transport.ProxyOptions, caBundle, clientCert, clientKey *[]byte, insecureSkipTLS *bool) {
+	if t == nil {
+		return
+	}
+	*auth = t.Auth
+	*proxy = t.ProxyOptions
+	*caBundle = t.CABundle
+	*clientCert = t.ClientCert
+	*clientKey = t.ClientKey
+	*insecureSkipTLS = t.InsecureSkipTLS
+}
+
+// retry runs op, which applies the transport to its options, and runs it once
+// more if the remote rejected it with 401 or 403 and git credential helpers
+// have credentials for it. Those are used for the transport's later requests.
+func (t *Transport) retry(op func() error) error {
+	err := op()
+	if t == nil || t.rejected == nil {
+		return err
+	}
+	if !errors.Is(err, transport.ErrAuthenticationRequired) && !errors.Is(err, transport.ErrAuthorizationFailed) {
+		return err
+	}
+
+	rejected := t.rejected
+	t.rejected = nil
+	auth, authErr := rejected()
+	if authErr != nil || auth == nil {
+		return err
+	}
+	t.Auth = auth
+	return op()
+}
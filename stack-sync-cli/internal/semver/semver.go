@@ -0,0 +1,355 @@
+package semver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version represents a semantic version such as v1.4.2 or 2.0.0-rc.1
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Original   string // the string the version was parsed from (e.g. a tag name)
+}
+
+// Parse parses a version with an optional "v" prefix; missing minor/patch parts default to 0
+func Parse(s string) (*Version, error) {
+	v, parts, err := parsePartial(s)
+	if err != nil {
+		return nil, err
+	}
+	if parts < 0 {
+		return nil, fmt.Errorf("wildcards are not allowed in a version: %s", s)
+	}
+	return v, nil
+}
+
+// parsePartial parses a possibly incomplete version. It returns the number of
+// numeric parts that were given, or -(parts+1) if the next part was a wildcard.
+func parsePartial(s string) (*Version, int, error) {
+	original := s
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if s == "" {
+		return nil, 0, fmt.Errorf("empty version")
+	}
+
+	v := &Version{Original: original}
+
+	// Strip build metadata, keep prerelease
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+	}
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return nil, 0, fmt.Errorf("invalid version: %s", original)
+	}
+
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			if v.Prerelease != "" {
+				return nil, 0, fmt.Errorf("invalid version: %s", original)
+			}
+			return v, -(i + 1), nil
+		}
+
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("invalid version: %s", original)
+		}
+		*numbers[i] = n
+	}
+
+	return v, len(fields), nil
+}
+
+// String returns the original text of the version
+func (v *Version) String() string {
+	if v.Original != "" {
+		return v.Original
+	}
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or greater than o
+func (v *Version) Compare(o *Version) int {
+	for _, pair := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// comparePrerelease orders prerelease identifiers; a release sorts after its prereleases
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1 // numeric identifiers sort before alphanumeric ones
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// comparator is a single operator/version pair such as ">=1.4.0"
+type comparator struct {
+	op      string
+	version *Version
+}
+
+// check reports whether v satisfies the comparator
+func (c comparator) check(v *Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Constraint is a set of comparator groups; a version matches if it satisfies
+// every comparator of at least one group ("||" separates groups)
+type Constraint struct {
+	groups   [][]comparator
+	original string
+}
+
+// IsConstraint reports whether a ref looks like a version constraint rather than a plain name
+func IsConstraint(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return false
+	}
+	if strings.ContainsAny(ref[:1], "^~<>=!*") || strings.Contains(ref, "||") {
+		return true
+	}
+	// Partial versions and wildcards such as "1.4" or "1.x"
+	_, parts, err := parsePartial(ref)
+	return err == nil && parts != 3
+}
+
+// ParseConstraint parses expressions like "^1.4", "~2.1.0", ">=1.2 <2", "1.x || 2.0.1"
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{original: s}
+
+	for _, group := range strings.Split(s, "||") {
+		fields := strings.FieldsFunc(group, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid constraint: %s", s)
+		}
+
+		var comparators []comparator
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// Allow a space between operator and version: ">= 1.2"
+			if isOperator(field) && i+1 < len(fields) {
+				field += fields[i+1]
+				i++
+			}
+
+			parsed, err := parseComparator(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			comparators = append(comparators, parsed...)
+		}
+		c.groups = append(c.groups, comparators)
+	}
+
+	return c, nil
+}
+
+// isOperator reports whether s consists only of comparison operator characters
+func isOperator(s string) bool {
+	return strings.Trim(s, "<>=!^~") == ""
+}
+
+// parseComparator expands a single constraint term into plain comparators
+func parseComparator(term string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			break
+		}
+	}
+	rest := strings.TrimSpace(term[len(op):])
+
+	if rest == "*" || rest == "x" || rest == "X" {
+		return []comparator{{op: ">=", version: &Version{}}}, nil
+	}
+
+	v, parts, err := parsePartial(rest)
+	if err != nil {
+		return nil, err
+	}
+	wildcard := parts < 0
+	if wildcard {
+		parts = -parts - 1
+	}
+
+	switch op {
+	case "^":
+		upper := &Version{Major: v.Major + 1}
+		switch {
+		case v.Major == 0 && v.Minor == 0 && parts == 3:
+			upper = &Version{Patch: v.Patch + 1}
+		case v.Major == 0 && parts >= 2:
+			upper = &Version{Minor: v.Minor + 1}
+		}
+		return []comparator{{op: ">=", version: v}, {op: "<", version: upper}}, nil
+
+	case "~":
+		upper := &Version{Major: v.Major, Minor: v.Minor + 1}
+		if parts == 1 {
+			upper = &Version{Major: v.Major + 1}
+		}
+		return []comparator{{op: ">=", version: v}, {op: "<", version: upper}}, nil
+
+	case "", "=":
+		// Partial versions match the whole range they leave open
+		switch parts {
+		case 1:
+			return []comparator{{op: ">=", version: v}, {op: "<", version: &Version{Major: v.Major + 1}}}, nil
+		case 2:
+			return []comparator{{op: ">=", version: v}, {op: "<", version: &Version{Major: v.Major, Minor: v.Minor + 1}}}, nil
+		}
+		return []comparator{{op: "=", version: v}}, nil
+
+	default:
+		if wildcard && (op == ">" || op == "<=") {
+			// ">1.x" means ">=2.0.0", "<=1.x" means "<2.0.0"
+			upper := &Version{Major: v.Major + 1}
+			if parts == 2 {
+				upper = &Version{Major: v.Major, Minor: v.Minor + 1}
+			}
+			if op == ">" {
+				return []comparator{{op: ">=", version: upper}}, nil
+			}
+			return []comparator{{op: "<", version: upper}}, nil
+		}
+		return []comparator{{op: op, version: v}}, nil
+	}
+}
+
+// Check reports whether a version satisfies the constraint. Prereleases only
+// match when the constraint names a prerelease of the same major.minor.patch.
+func (c *Constraint) Check(v *Version) bool {
+	for _, group := range c.groups {
+		matched := true
+		for _, cmp := range group {
+			if !cmp.check(v) {
+				matched = false
+				break
+			}
+		}
+		if matched && (v.Prerelease == "" || c.allowsPrerelease(group, v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsPrerelease reports whether a group explicitly opts into prereleases of v's release
+func (c *Constraint) allowsPrerelease(group []comparator, v *Version) bool {
+	for _, cmp := range group {
+		cv := cmp.version
+		if cv.Prerelease != "" && cv.Major == v.Major && cv.Minor == v.Minor && cv.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the original constraint text
+func (c *Constraint) String() string {
+	return c.original
+}
+
+// Sort sorts versions in ascending order
+func Sort(versions []*Version) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Compare(versions[j]) < 0
+	})
+}
+
+// Latest returns the highest version satisfying the constraint, or nil.
+// A nil constraint matches any release version.
+func Latest(versions []*Version, c *Constraint) *Version {
+	var best *Version
+	for _, v := range versions {
+		if c == nil && v.Prerelease != "" {
+			continue
+		}
+		if c != nil && !c.Check(v) {
+			continue
+		}
+		if best == nil || v.Compare(best) > 0 {
+			best = v
+		}
+	}
+	return best
+}
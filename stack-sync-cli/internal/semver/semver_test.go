@@ -0,0 +1,207 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "v1.4.2", want: Version{Major: 1, Minor: 4, Patch: 2}},
+		{in: "2.0.0-rc.1", want: Version{Major: 2, Prerelease: "rc.1"}},
+		{in: "V3", want: Version{Major: 3}},
+		{in: "1.2", want: Version{Major: 1, Minor: 2}},
+		{in: "1.2.3+build.7", want: Version{Major: 1, Minor: 2, Patch: 3}},
+		{in: "1.2.3-beta+build", want: Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "beta"}},
+		{in: "", wantErr: true},
+		{in: "v", wantErr: true},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "1.x", wantErr: true},
+		{in: "1.-2", wantErr: true},
+		{in: "main", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		tt.want.Original = tt.in
+		if *got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"v1.0.0", "1.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.0.0-1", "1.0.0-alpha", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+	}
+
+	for _, tt := range tests {
+		a, b := mustParse(t, tt.a), mustParse(t, tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Compare(a); got != -tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestIsConstraint(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"^1.4", true},
+		{"~2.1.0", true},
+		{">=1.2 <2", true},
+		{"1.x || 2.0.1", true},
+		{"1.4", true},
+		{"1.x", true},
+		{"*", true},
+		{"1.4.2", false},
+		{"v1.4.2", false},
+		{"main", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsConstraint(tt.ref); got != tt.want {
+			t.Errorf("IsConstraint(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}{
+		{"^1.4", []string{"1.4.0", "1.9.3"}, []string{"1.3.9", "2.0.0", "1.5.0-rc.1"}},
+		{"^0.3", []string{"0.3.0", "0.3.9"}, []string{"0.4.0", "0.2.9"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0"}},
+		{"~2.1.0", []string{"2.1.0", "2.1.7"}, []string{"2.2.0", "2.0.9"}},
+		{"~2", []string{"2.0.0", "2.9.0"}, []string{"3.0.0", "1.9.9"}},
+		{">=1.2 <2", []string{"1.2.0", "1.99.0"}, []string{"1.1.9", "2.0.0"}},
+		{">= 1.2, < 2", []string{"1.5.0"}, []string{"2.0.0"}},
+		{"1.x || 2.0.1", []string{"1.0.0", "1.8.2", "2.0.1"}, []string{"2.0.0", "2.0.2", "0.9.0"}},
+		{"1.4", []string{"1.4.0", "1.4.9"}, []string{"1.5.0", "1.3.0"}},
+		{"=1.4.2", []string{"1.4.2", "v1.4.2"}, []string{"1.4.3"}},
+		{"!=1.4.2", []string{"1.4.1"}, []string{"1.4.2"}},
+		{">1.x", []string{"2.0.0"}, []string{"1.9.9"}},
+		{"<=1.4.x", []string{"1.4.9", "1.0.0"}, []string{"1.5.0"}},
+		{"*", []string{"0.0.1", "9.9.9"}, []string{"1.0.0-rc.1"}},
+		{">=1.0.0-rc.1", []string{"1.0.0-rc.2", "1.0.0", "1.2.0"}, []string{"1.0.0-beta", "1.1.0-rc.1"}},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) failed: %v", tt.constraint, err)
+			continue
+		}
+		for _, v := range tt.matches {
+			if !c.Check(mustParse(t, v)) {
+				t.Errorf("%q should match %s", tt.constraint, v)
+			}
+		}
+		for _, v := range tt.rejects {
+			if c.Check(mustParse(t, v)) {
+				t.Errorf("%q should not match %s", tt.constraint, v)
+			}
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, s := range []string{"", "||", "^", ">=main", "1.2.3.4", "1.x-rc.1"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) should fail", s)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	var versions []*Version
+	for _, s := range []string{"v1.0.0", "v1.4.2", "v1.5.0-rc.1", "v2.0.0", "v2.1.0-beta", "v1.4.10"} {
+		versions = append(versions, mustParse(t, s))
+	}
+
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"", "v2.0.0"},
+		{"^1.4", "v1.4.10"},
+		{"~1.4.2", "v1.4.10"},
+		{"<1.4", "v1.0.0"},
+		{">=1.5.0-rc.1 <2", "v1.5.0-rc.1"},
+		{"^3", ""},
+	}
+
+	for _, tt := range tests {
+		var c *Constraint
+		if tt.constraint != "" {
+			var err error
+			if c, err = ParseConstraint(tt.constraint); err != nil {
+				t.Fatalf("ParseConstraint(%q) failed: %v", tt.constraint, err)
+			}
+		}
+
+		got := Latest(versions, c)
+		switch {
+		case got == nil && tt.want != "":
+			t.Errorf("Latest(%q) = nil, want %s", tt.constraint, tt.want)
+		case got != nil && got.String() != tt.want:
+			t.Errorf("Latest(%q) = %s, want %q", tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	var versions []*Version
+	for _, s := range []string{"2.0.0", "1.0.0-rc.1", "1.10.0", "1.0.0", "1.2.0"} {
+		versions = append(versions, mustParse(t, s))
+	}
+	Sort(versions)
+
+	want := []string{"1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0", "2.0.0"}
+	for i, v := range versions {
+		if v.String() != want[i] {
+			t.Fatalf("Sort() = %v, want %v", versions, want)
+		}
+	}
+}
+
+// mustParse parses a version or fails the test
+func mustParse(t *testing.T, s string) *Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", s, err)
+	}
+	return v
+}
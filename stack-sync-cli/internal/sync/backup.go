@@ -0,0 +1,806 @@
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// backupTimeFormat names the backups of a repository
+const backupTimeFormat = "20060102-150405"
+
+// backupBlobDir holds the deduplicated file contents of a repository's backups
+const backupBlobDir = "blobs"
+
+// LatestBackup selects the newest backup of a repository
+const LatestBackup = "latest"
+
+// BackupInfo describes one backup of a repository's target directory
+type BackupInfo struct {
+	Name      string                 // backup name, the timestamp it was taken
+	Path      string                 // manifest file, or directory of a legacy full copy
+	CreatedAt time.Time              // when the backup was taken
+	Size      int64                  // total size of the captured files
+	Files     int                    // number of captured files
+	Manifest  *models.BackupManifest // captured files and the files the sync created
+	legacy    bool                   // a full directory copy made by older versions
+	archive   map[string][]byte      // archived contents by hash, read on first use
+}
+
+// IsBackupName reports whether name can select a backup: a backup's name or "latest"
+func IsBackupName(name string) bool {
+	if name == LatestBackup {
+		return true
+	}
+	_, err := parseBackupName(name)
+	return err == nil
+}
+
+// parseBackupName returns when a backup was taken. Backups taken within the
+// same second get a ".N" suffix.
+func parseBackupName(name string) (time.Time, error) {
+	timestamp, _, _ := strings.Cut(strings.TrimSuffix(name, ".json"), ".")
+	return time.ParseInLocation(backupTimeFormat, timestamp, time.Local)
+}
+
+// GetBackupRoot returns the directory holding all backups of a repository
+func (m *Manager) GetBackupRoot(repoName string) string {
+	return filepath.Join(m.config.GetBackupDir(), repoName)
+}
+
+// backupEnabled reports whether syncs of the repository take backups
+func (m *Manager) backupEnabled(repo *models.Repository) bool {
+	return m.config.Settings.BackupEnabled && repo.BackupConfig != nil && repo.BackupConfig.Enabled
+}
+
+// blobPath returns where the content with the given hash is stored
+func blobPath(root, hash, compression string) string {
+	name := hash
+	if compression == models.BackupCompressionGzip {
+		name += ".gz"
+	}
+	return filepath.Join(root, backupBlobDir, hash[:2], name)
+}
+
+// storeBlob adds a file's content to the blob store unless it is already there
+func storeBlob(root, src, compression string) (string, error) {
+	hash, err := hashFile(src)
+	if err != nil {
+		return "", err
+	}
+
+	dst := blobPath(root, hash, compression)
+	if _, err := os.Stat(dst); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	if compression == models.BackupCompressionGzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
+	}
+
+	// Write next to the blob and rename so a blob is never seen half written
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return hash, nil
+}
+
+// archiveExtension returns the extension of the archive bundling the files of
+// a backup, or "" if their contents are kept in the blob store
+func archiveExtension(compression string) string {
+	switch compression {
+	case models.BackupCompressionTarGz:
+		return ".tar.gz"
+	case models.BackupCompressionZstd:
+		return ".tar.zst"
+	default:
+		return ""
+	}
+}
+
+// archivePath returns the archive of a backup, next to its manifest
+func archivePath(backup *BackupInfo) string {
+	return strings.TrimSuffix(backup.Path, ".json") + archiveExtension(backup.Manifest.Compression)
+}
+
+// writeArchive bundles the files of contents, keyed by content hash, into a
+// compressed tar archive. It is written to a temporary file below root, which
+// is returned and renamed into place once the backup is named.
+func writeArchive(root, compression string, contents map[string]string) (string, error) {
+	f, err := os.CreateTemp(root, ".archive-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	var zw io.WriteCloser
+	written := false
+	defer func() {
+		if !written {
+			if zw != nil {
+				zw.Close()
+			}
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if compression == models.BackupCompressionZstd {
+		enc, err := zstd.NewWriter(f, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		if err != nil {
+			return "", err
+		}
+		zw = enc
+	} else {
+		zw = gzip.NewWriter(f)
+	}
+
+	hashes := make([]string, 0, len(contents))
+	for hash := range contents {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	tw := tar.NewWriter(zw)
+	for _, hash := range hashes {
+		data, err := os.ReadFile(contents[hash])
+		if err != nil {
+			return "", err
+		}
+		header := &tar.Header{Name: hash, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	written = true
+	return f.Name(), nil
+}
+
+// readArchive returns the contents bundled in a backup's archive by hash
+func readArchive(backup *BackupInfo) (map[string][]byte, error) {
+	f, err := os.Open(archivePath(backup))
+	if err != nil {
+		return nil, fmt.Errorf("backup archive of %s is missing: %w", backup.Name, err)
+	}
+	defer f.Close()
+
+	var r io.Reader
+	if backup.Manifest.Compression == models.BackupCompressionZstd {
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("backup archive of %s is corrupt: %w", backup.Name, err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("backup archive of %s is corrupt: %w", backup.Name, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup archive of %s is corrupt: %w", backup.Name, err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("backup archive of %s is corrupt: %w", backup.Name, err)
+		}
+		contents[header.Name] = data
+	}
+	return contents, nil
+}
+
+// readBackupFile returns the captured content of a file
+func readBackupFile(backup *BackupInfo, file models.BackupFile) ([]byte, error) {
+	if backup.legacy {
+		return os.ReadFile(filepath.Join(backup.Path, filepath.FromSlash(file.Path)))
+	}
+
+	if archiveExtension(backup.Manifest.Compression) != "" {
+		if backup.archive == nil {
+			contents, err := readArchive(backup)
+			if err != nil {
+				return nil, err
+			}
+			backup.archive = contents
+		}
+		data, ok := backup.archive[file.Hash]
+		if !ok {
+			return nil, fmt.Errorf("backup content of %s is missing from %s", file.Path, archivePath(backup))
+		}
+		return data, nil
+	}
+
+	compression := backup.Manifest.Compression
+	f, err := os.Open(blobPath(filepath.Dir(backup.Path), file.Hash, compression))
+	if err != nil {
+		return nil, fmt.Errorf("backup content of %s is missing: %w", file.Path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compression == models.BackupCompressionGzip {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("backup content of %s is corrupt: %w", file.Path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return io.ReadAll(r)
+}
+
+// createBackup captures the current content of the target files about to be
+// overwritten or deleted, and records the files about to be created so a
+// restore can remove them again
+func (m *Manager) createBackup(repo *models.Repository, paths []string) (*BackupInfo, error) {
+	root := m.GetBackupRoot(repo.Name)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	manifest := &models.BackupManifest{
+		Repository:      repo.Name,
+		TargetDirectory: repo.TargetDirectory,
+		CreatedAt:       time.Now(),
+		Files:           []models.BackupFile{},
+	}
+	if repo.BackupConfig != nil {
+		switch repo.BackupConfig.Compression {
+		case models.BackupCompressionGzip, models.BackupCompressionTarGz, models.BackupCompressionZstd:
+			manifest.Compression = repo.BackupConfig.Compression
+		}
+	}
+
+	// Archived backups bundle their own contents instead of using the blob store
+	archived := archiveExtension(manifest.Compression) != ""
+	contents := make(map[string]string)
+
+	for _, path := range paths {
+		path = filepath.ToSlash(path)
+		src := filepath.Join(repo.TargetDirectory, filepath.FromSlash(path))
+		info, err := os.Stat(src)
+		if os.IsNotExist(err) {
+			manifest.Created = append(manifest.Created, path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var hash string
+		if archived {
+			hash, err = hashFile(src)
+			contents[hash] = src
+		} else {
+			hash, err = storeBlob(root, src, manifest.Compression)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+		manifest.Files = append(manifest.Files, models.BackupFile{
+			Path: path,
+			Hash: hash,
+			Size: info.Size(),
+			Mode: uint32(info.Mode().Perm()),
+		})
+	}
+
+	var archive string
+	if archived {
+		var err error
+		archive, err = writeArchive(root, manifest.Compression, contents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write backup archive: %w", err)
+		}
+		defer os.Remove(archive) // only still there if the backup failed
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+
+	// Claim a fresh name; backups within the same second get a suffix
+	name := manifest.CreatedAt.Format(backupTimeFormat)
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(filepath.Join(root, name+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s.%d", manifest.CreatedAt.Format(backupTimeFormat), i)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+		}
+		if archive != "" {
+			// The archive goes into place before the manifest refers to it
+			if err := os.Rename(archive, filepath.Join(root, name+archiveExtension(manifest.Compression))); err != nil {
+				f.Close()
+				os.Remove(f.Name())
+				return nil, fmt.Errorf("failed to write backup archive: %w", err)
+			}
+		}
+		_, err = f.Write(append(data, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+		}
+		break
+	}
+
+	return newBackupInfo(name, filepath.Join(root, name+".json"), manifest), nil
+}
+
+// backupChanges backs up what a changeset is about to overwrite or delete
+// and returns the backup's name, or "" if none was taken
+func (m *Manager) backupChanges(repo *models.Repository, fileChanges []models.FileChange) string {
+	if !m.backupEnabled(repo) {
+		return ""
+	}
+
+	var paths []string
+	for _, change := range fileChanges {
+		if change.ChangeType != models.ChangeTypeUnchanged {
+			paths = append(paths, change.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+
+	backup, err := m.createBackup(repo, paths)
+	if err != nil {
+		fmt.Fprintf(m.out, "Warning: backup failed: %v\n", err)
+		return ""
+	}
+	fmt.Fprintf(m.out, "Created backup %s (%d files, %s)\n", backup.Name, backup.Files, backup.Path)
+	return backup.Name
+}
+
+// pruneOldBackups keeps at most max_backups backups of a repository. It runs
+// once the changeset is applied so the backup being restored from is never
+// removed underneath a restore.
+func (m *Manager) pruneOldBackups(repo *models.Repository) {
+	if !m.backupEnabled(repo) {
+		return
+	}
+
+	removed, err := m.PruneBackups(repo.Name, repo.BackupConfig.MaxBackups)
+	if err != nil {
+		fmt.Fprintf(m.out, "Warning: failed to prune backups: %v\n", err)
+	}
+	for _, old := range removed {
+		fmt.Fprintf(m.out, "Removed old backup: %s\n", old.Name)
+	}
+}
+
+// newBackupInfo describes a backup from its manifest
+func newBackupInfo(name, path string, manifest *models.BackupManifest) *BackupInfo {
+	backup := &BackupInfo{Name: name, Path: path, CreatedAt: manifest.CreatedAt, Manifest: manifest}
+	for _, file := range manifest.Files {
+		backup.Size += file.Size
+		backup.Files++
+	}
+	return backup
+}
+
+// loadBackup reads a backup manifest
+func loadBackup(name, path string) (*BackupInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+	var manifest models.BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest %s: %w", name, err)
+	}
+	return newBackupInfo(name, path, &manifest), nil
+}
+
+// loadLegacyBackup describes a full directory copy made by older versions
+func (m *Manager) loadLegacyBackup(name, dir string, createdAt time.Time) (*BackupInfo, error) {
+	files, err := m.scanFiles(context.Background(), dir, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan backup %s: %w", name, err)
+	}
+
+	manifest := &models.BackupManifest{CreatedAt: createdAt, Files: []models.BackupFile{}}
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			continue
+		}
+		manifest.Files = append(manifest.Files, models.BackupFile{
+			Path: filepath.ToSlash(file),
+			Size: info.Size(),
+			Mode: uint32(info.Mode().Perm()),
+		})
+	}
+
+	backup := newBackupInfo(name, dir, manifest)
+	backup.legacy = true
+	return backup, nil
+}
+
+// ListBackups returns the backups of a repository, newest first
+func (m *Manager) ListBackups(repoName string) ([]BackupInfo, error) {
+	root := m.GetBackupRoot(repoName)
+	dirEntries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []BackupInfo
+	for _, dirEntry := range dirEntries {
+		createdAt, err := parseBackupName(dirEntry.Name())
+		if err != nil {
+			continue // blobs and anything else that isn't a backup
+		}
+
+		var backup *BackupInfo
+		path := filepath.Join(root, dirEntry.Name())
+		if dirEntry.IsDir() {
+			backup, err = m.loadLegacyBackup(dirEntry.Name(), path, createdAt)
+		} else if strings.HasSuffix(dirEntry.Name(), ".json") {
+			backup, err = loadBackup(strings.TrimSuffix(dirEntry.Name(), ".json"), path)
+		} else {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, *backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// FindBackup returns the named backup of a repository; an empty name or
+// "latest" selects the newest one
+func (m *Manager) FindBackup(repoName, name string) (*BackupInfo, error) {
+	backups, err := m.ListBackups(repoName)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("no backups of %s in %s", repoName, m.GetBackupRoot(repoName))
+	}
+
+	if name == "" || name == LatestBackup {
+		return &backups[0], nil
+	}
+	for i := range backups {
+		if backups[i].Name == name {
+			return &backups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("backup %s of %s not found", name, repoName)
+}
+
+// DiffBackup compares a backup with the current target directory from the
+// point of view of a restore: added files are captured but missing from the
+// target, modified files differ, and deleted files were created by the sync
+// that took the backup and would be removed
+func (m *Manager) DiffBackup(repo *models.Repository, backup *BackupInfo) ([]models.FileChange, error) {
+	var changes []models.FileChange
+	for _, file := range backup.Manifest.Files {
+		change := models.FileChange{Path: file.Path, ChangeType: models.ChangeTypeAdded, Size: file.Size}
+
+		target := filepath.Join(repo.TargetDirectory, filepath.FromSlash(file.Path))
+		if _, err := os.Stat(target); err == nil {
+			same, err := m.sameAsBackup(backup, file, target)
+			if err != nil {
+				return nil, err
+			}
+			change.ChangeType = models.ChangeTypeModified
+			if same {
+				change.ChangeType = models.ChangeTypeUnchanged
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for _, path := range backup.Manifest.Created {
+		info, err := os.Stat(filepath.Join(repo.TargetDirectory, filepath.FromSlash(path)))
+		if err != nil {
+			continue // already gone
+		}
+		changes = append(changes, models.FileChange{Path: path, ChangeType: models.ChangeTypeDeleted, Size: info.Size()})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// sameAsBackup reports whether a target file still has its captured content
+func (m *Manager) sameAsBackup(backup *BackupInfo, file models.BackupFile, target string) (bool, error) {
+	if backup.legacy {
+		return sameContent(filepath.Join(backup.Path, filepath.FromSlash(file.Path)), target)
+	}
+	hash, err := hashFile(target)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", target, err)
+	}
+	return hash == file.Hash, nil
+}
+
+// backupFile looks up the captured file at path
+func backupFile(backup *BackupInfo, path string) (models.BackupFile, bool) {
+	for _, file := range backup.Manifest.Files {
+		if file.Path == path {
+			return file, true
+		}
+	}
+	return models.BackupFile{}, false
+}
+
+// ShowBackupDiff prints the content diff of one file between the target and a backup
+func (m *Manager) ShowBackupDiff(repo *models.Repository, backup *BackupInfo, change models.FileChange) error {
+	if change.ChangeType == models.ChangeTypeDeleted {
+		return m.showFileDiff(PlanEntry{Path: change.Path, Status: "D"}, os.DevNull, repo.TargetDirectory)
+	}
+
+	file, ok := backupFile(backup, change.Path)
+	if !ok {
+		return fmt.Errorf("%s is not in backup %s", change.Path, backup.Name)
+	}
+	data, err := readBackupFile(backup, file)
+	if err != nil {
+		return err
+	}
+
+	// git diff needs the captured content on disk
+	tmpDir, err := os.MkdirTemp("", "stack-sync-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpFile := filepath.Join(tmpDir, filepath.FromSlash(file.Path))
+	if err := os.MkdirAll(filepath.Dir(tmpFile), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+
+	status := "M"
+	if change.ChangeType == models.ChangeTypeAdded {
+		status = "A"
+	}
+	return m.showFileDiff(PlanEntry{Path: change.Path, Status: status}, tmpDir, repo.TargetDirectory)
+}
+
+// RestoreBackup writes a backup back into the repository's target directory.
+// With paths only those files or directories are restored; otherwise every
+// captured file is restored and files created by the backed up sync are
+// deleted. The current content is backed up first and all changes are
+// applied atomically.
+func (m *Manager) RestoreBackup(repo *models.Repository, backup *BackupInfo, paths []string) ([]models.FileChange, error) {
+	changes, err := m.DiffBackup(repo, backup)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []models.FileChange
+	for _, change := range changes {
+		if change.ChangeType == models.ChangeTypeUnchanged {
+			continue
+		}
+		if len(paths) > 0 && matchRestorePath(change.Path, paths) == "" {
+			continue
+		}
+		selected = append(selected, change)
+	}
+
+	for _, path := range paths {
+		if !m.inBackup(backup, path) {
+			return nil, fmt.Errorf("%s is not in backup %s", path, backup.Name)
+		}
+	}
+
+	if len(selected) == 0 || m.dryRun {
+		return selected, nil
+	}
+
+	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	// Keep the current state so the restore itself can be undone
+	m.backupChanges(repo, selected)
+
+	txn, err := newStagedApply(repo.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range selected {
+		if change.ChangeType == models.ChangeTypeDeleted {
+			txn.stageDelete(change.Path)
+			continue
+		}
+		file, _ := backupFile(backup, change.Path)
+		data, err := readBackupFile(backup, file)
+		if err == nil {
+			err = txn.stageData(filepath.FromSlash(file.Path), data, os.FileMode(file.Mode))
+		}
+		if err != nil {
+			txn.finish()
+			return nil, err
+		}
+	}
+	if err := txn.commit(); err != nil {
+		return nil, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	txn.finish()
+	m.pruneOldBackups(repo)
+
+	// Restored synced files become the base of the next three-way comparison
+	owned, err := m.ownedFiles(repo)
+	if err != nil {
+		return selected, nil
+	}
+	var synced []models.FileChange
+	for _, change := range selected {
+		if owned[change.Path] {
+			synced = append(synced, change)
+		}
+	}
+	if err := m.updateBase(repo, repo.TargetDirectory, synced); err != nil {
+		fmt.Fprintf(m.out, "Warning: failed to store base snapshot: %v\n", err)
+	}
+
+	return selected, nil
+}
+
+// matchRestorePath returns the requested path that selects file, a file itself
+// or a directory containing it, or "" if none does
+func matchRestorePath(file string, paths []string) string {
+	for _, path := range paths {
+		clean := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(path)), "/")
+		if file == clean || strings.HasPrefix(file, clean+"/") {
+			return path
+		}
+	}
+	return ""
+}
+
+// inBackup reports whether a requested path selects anything in the backup
+func (m *Manager) inBackup(backup *BackupInfo, path string) bool {
+	for _, file := range backup.Manifest.Files {
+		if matchRestorePath(file.Path, []string{path}) != "" {
+			return true
+		}
+	}
+	for _, created := range backup.Manifest.Created {
+		if matchRestorePath(created, []string{path}) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PruneBackups deletes the oldest backups of a repository so that at most
+// keep remain, then drops blobs no remaining backup refers to. keep <= 0
+// keeps everything. Returns the removed backups.
+func (m *Manager) PruneBackups(repoName string, keep int) ([]BackupInfo, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	backups, err := m.ListBackups(repoName)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) <= keep {
+		return nil, nil
+	}
+
+	var removed []BackupInfo
+	for _, backup := range backups[keep:] {
+		if err := os.RemoveAll(backup.Path); err != nil {
+			return removed, fmt.Errorf("failed to remove backup %s: %w", backup.Name, err)
+		}
+		if !backup.legacy && archiveExtension(backup.Manifest.Compression) != "" {
+			if err := os.Remove(archivePath(&backup)); err != nil && !os.IsNotExist(err) {
+				return removed, fmt.Errorf("failed to remove backup %s: %w", backup.Name, err)
+			}
+		}
+		removed = append(removed, backup)
+	}
+
+	if err := gcBlobs(m.GetBackupRoot(repoName), backups[:keep]); err != nil {
+		return removed, fmt.Errorf("failed to remove unused backup content: %w", err)
+	}
+	return removed, nil
+}
+
+// gcBlobs removes blobs that none of the remaining backups refer to
+func gcBlobs(root string, remaining []BackupInfo) error {
+	referenced := make(map[string]bool)
+	for _, backup := range remaining {
+		for _, file := range backup.Manifest.Files {
+			referenced[file.Hash] = true
+		}
+	}
+
+	blobDir := filepath.Join(root, backupBlobDir)
+	if _, err := os.Stat(blobDir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(blobDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		hash := strings.TrimSuffix(info.Name(), ".gz")
+		if referenced[hash] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		os.Remove(filepath.Dir(path)) // only succeeds once the directory is empty
+		return nil
+	})
+}
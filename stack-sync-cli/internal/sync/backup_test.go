@@ -0,0 +1,449 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// newBackupRepo creates a repository with backups enabled and a target
+// directory holding files
+func newBackupRepo(t *testing.T, files map[string]string) *models.Repository {
+	t.Helper()
+	repo := &models.Repository{
+		Name:            "proto",
+		TargetDirectory: t.TempDir(),
+		BackupConfig:    &models.BackupConfig{Enabled: true},
+	}
+	writeFiles(t, repo.TargetDirectory, files)
+	return repo
+}
+
+func TestIsBackupName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"latest", true},
+		{"20240102-150405", true},
+		{"20240102-150405.3", true},
+		{"20240102-150405.json", true},
+		{"blobs", false},
+		{"2024-01-02", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsBackupName(tt.name); got != tt.want {
+			t.Errorf("IsBackupName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetBackupRoot(t *testing.T) {
+	m := newTestManager(t)
+	home, _ := os.UserHomeDir()
+
+	tests := []struct {
+		backupDir string
+		want      string
+	}{
+		{"~/backups", filepath.Join(home, "backups", "proto")},
+		{"/srv/backups", filepath.Join("/srv/backups", "proto")},
+		{"", filepath.Join(home, ".stack-sync", "backups", "proto")},
+	}
+
+	for _, tt := range tests {
+		m.config.Settings.BackupDir = tt.backupDir
+		if got := m.GetBackupRoot("proto"); got != tt.want {
+			t.Errorf("GetBackupRoot() with backup_dir %q = %s, want %s", tt.backupDir, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRestorePath(t *testing.T) {
+	tests := []struct {
+		file  string
+		paths []string
+		want  string
+	}{
+		{"api/a.proto", []string{"api/a.proto"}, "api/a.proto"},
+		{"api/a.proto", []string{"api"}, "api"},
+		{"api/a.proto", []string{"api/"}, "api/"},
+		{"api/a.proto", []string{"./api"}, "./api"},
+		{"api/a.proto", []string{"ap"}, ""},
+		{"api/a.proto", []string{"other", "api"}, "api"},
+		{"api/a.proto", nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := matchRestorePath(tt.file, tt.paths); got != tt.want {
+			t.Errorf("matchRestorePath(%q, %v) = %q, want %q", tt.file, tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	tests := []struct {
+		keep        int
+		wantRemoved int
+	}{
+		{keep: 0, wantRemoved: 0},
+		{keep: 1, wantRemoved: 3},
+		{keep: 3, wantRemoved: 1},
+		{keep: 4, wantRemoved: 0},
+		{keep: 10, wantRemoved: 0},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		repo := newBackupRepo(t, map[string]string{"a.proto": "v0"})
+
+		var names []string
+		for _, content := range []string{"v1", "v2", "v3", "v4"} {
+			backup, err := m.createBackup(repo, []string{"a.proto"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, backup.Name)
+			writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": content})
+		}
+
+		removed, err := m.PruneBackups(repo.Name, tt.keep)
+		if err != nil {
+			t.Fatalf("keep %d: PruneBackups() failed: %v", tt.keep, err)
+		}
+		if len(removed) != tt.wantRemoved {
+			t.Errorf("keep %d: removed %d backups, want %d", tt.keep, len(removed), tt.wantRemoved)
+		}
+
+		backups, err := m.ListBackups(repo.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := len(names) - tt.wantRemoved; len(backups) != want {
+			t.Fatalf("keep %d: %d backups left, want %d", tt.keep, len(backups), want)
+		}
+		// The newest backups are the ones kept
+		for i, backup := range backups {
+			if want := names[len(names)-1-i]; backup.Name != want {
+				t.Errorf("keep %d: backup %d is %s, want %s", tt.keep, i, backup.Name, want)
+			}
+		}
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  map[string]string
+	}{
+		{
+			name:  "everything",
+			paths: nil,
+			want:  map[string]string{"a.proto": "a1", "sub/b.proto": "b1", "new.proto": "<missing>"},
+		},
+		{
+			name:  "one file",
+			paths: []string{"a.proto"},
+			want:  map[string]string{"a.proto": "a1", "sub/b.proto": "b2", "new.proto": "new"},
+		},
+		{
+			name:  "directory",
+			paths: []string{"sub"},
+			want:  map[string]string{"a.proto": "a2", "sub/b.proto": "b1", "new.proto": "new"},
+		},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		repo := newBackupRepo(t, map[string]string{"a.proto": "a1", "sub/b.proto": "b1"})
+
+		// A sync that modifies both files and creates one
+		backup, err := m.createBackup(repo, []string{"a.proto", "sub/b.proto", "new.proto"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "a2", "sub/b.proto": "b2", "new.proto": "new"})
+
+		if _, err := m.RestoreBackup(repo, backup, tt.paths); err != nil {
+			t.Errorf("%s: RestoreBackup() failed: %v", tt.name, err)
+			continue
+		}
+		for path, want := range tt.want {
+			if got := readTarget(t, repo, path); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, path, got, want)
+			}
+		}
+
+		// The restore took a backup of its own
+		if backups, _ := m.ListBackups(repo.Name); len(backups) != 2 {
+			t.Errorf("%s: %d backups after restore, want 2", tt.name, len(backups))
+		}
+	}
+
+	m := newTestManager(t)
+	repo := newBackupRepo(t, map[string]string{"a.proto": "a1"})
+	backup, err := m.createBackup(repo, []string{"a.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.RestoreBackup(repo, backup, []string{"missing.proto"}); err == nil {
+		t.Error("RestoreBackup() of a path not in the backup should fail")
+	}
+}
+
+func TestStoreBlob(t *testing.T) {
+	for _, compression := range []string{"", models.BackupCompressionNone, models.BackupCompressionGzip} {
+		root := t.TempDir()
+		src := filepath.Join(t.TempDir(), "a.proto")
+		content := strings.Repeat("message A {}\n", 100)
+		writeFiles(t, filepath.Dir(src), map[string]string{"a.proto": content})
+
+		hash, err := storeBlob(root, src, compression)
+		if err != nil {
+			t.Fatalf("%q: storeBlob() failed: %v", compression, err)
+		}
+		if hash != sha256Hex(content) {
+			t.Errorf("%q: storeBlob() = %s, want the content hash", compression, hash)
+		}
+
+		path := blobPath(root, hash, compression)
+		stored, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%q: blob not stored: %v", compression, err)
+		}
+		gzipped := bytes.HasPrefix(stored, []byte{0x1f, 0x8b})
+		if want := compression == models.BackupCompressionGzip; gzipped != want {
+			t.Errorf("%q: blob gzipped = %v, want %v", compression, gzipped, want)
+		}
+
+		// Storing the same content again reuses the blob
+		before, _ := os.Stat(path)
+		if again, err := storeBlob(root, src, compression); err != nil || again != hash {
+			t.Errorf("%q: storeBlob() again = %s, %v", compression, again, err)
+		}
+		if after, _ := os.Stat(path); !after.ModTime().Equal(before.ModTime()) {
+			t.Errorf("%q: blob was rewritten", compression)
+		}
+
+		backup := &BackupInfo{Path: filepath.Join(root, "20240102-150405.json"), Manifest: &models.BackupManifest{Compression: compression}}
+		data, err := readBackupFile(backup, models.BackupFile{Path: "a.proto", Hash: hash})
+		if err != nil || string(data) != content {
+			t.Errorf("%q: readBackupFile() = %d bytes, %v, want the original content", compression, len(data), err)
+		}
+	}
+}
+
+func TestBackupsShareBlobs(t *testing.T) {
+	m := newTestManager(t)
+	repo := newBackupRepo(t, map[string]string{"a.proto": "same", "b.proto": "same", "c.proto": "other"})
+
+	first, err := m.createBackup(repo, []string{"a.proto", "b.proto", "c.proto", "new.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.createBackup(repo, []string{"a.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := countBlobs(t, m.GetBackupRoot(repo.Name)); got != 2 {
+		t.Errorf("%d blobs stored, want 2", got)
+	}
+	if first.Files != 3 || len(first.Manifest.Created) != 1 || first.Manifest.Created[0] != "new.proto" {
+		t.Errorf("first backup = %d files, created %v", first.Files, first.Manifest.Created)
+	}
+	if second.Manifest.Files[0].Hash != first.Manifest.Files[0].Hash {
+		t.Error("identical content got different blobs")
+	}
+}
+
+func TestGCBlobs(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining []string // contents referenced by the remaining backups
+		want      int
+	}{
+		{name: "all referenced", remaining: []string{"a", "b", "c"}, want: 3},
+		{name: "some referenced", remaining: []string{"b"}, want: 1},
+		{name: "none left", remaining: nil, want: 0},
+	}
+
+	for _, tt := range tests {
+		root := t.TempDir()
+		src := t.TempDir()
+		hashes := map[string]string{}
+		for _, content := range []string{"a", "b", "c"} {
+			writeFiles(t, src, map[string]string{content: content})
+			hash, err := storeBlob(root, filepath.Join(src, content), models.BackupCompressionGzip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hashes[content] = hash
+		}
+
+		manifest := &models.BackupManifest{}
+		for _, content := range tt.remaining {
+			manifest.Files = append(manifest.Files, models.BackupFile{Path: content, Hash: hashes[content]})
+		}
+		if err := gcBlobs(root, []BackupInfo{{Manifest: manifest}}); err != nil {
+			t.Fatalf("%s: gcBlobs() failed: %v", tt.name, err)
+		}
+
+		if got := countBlobs(t, root); got != tt.want {
+			t.Errorf("%s: %d blobs left, want %d", tt.name, got, tt.want)
+		}
+		for _, content := range tt.remaining {
+			if _, err := os.Stat(blobPath(root, hashes[content], models.BackupCompressionGzip)); err != nil {
+				t.Errorf("%s: referenced blob %s was removed", tt.name, content)
+			}
+		}
+	}
+
+	if err := gcBlobs(t.TempDir(), nil); err != nil {
+		t.Errorf("gcBlobs() without a blob store failed: %v", err)
+	}
+}
+
+func TestPruneBackupsRemovesUnusedBlobs(t *testing.T) {
+	m := newTestManager(t)
+	repo := newBackupRepo(t, map[string]string{"a.proto": "v1", "b.proto": "kept"})
+
+	if _, err := m.createBackup(repo, []string{"a.proto", "b.proto"}); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "v2"})
+	if _, err := m.createBackup(repo, []string{"a.proto", "b.proto"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.PruneBackups(repo.Name, 1); err != nil {
+		t.Fatalf("PruneBackups() failed: %v", err)
+	}
+	// v1 was only referenced by the pruned backup
+	if got := countBlobs(t, m.GetBackupRoot(repo.Name)); got != 2 {
+		t.Errorf("%d blobs left, want 2", got)
+	}
+}
+
+func TestArchivedBackups(t *testing.T) {
+	tests := []struct {
+		compression string
+		extension   string
+		magic       []byte
+	}{
+		{compression: models.BackupCompressionZstd, extension: ".tar.zst", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{compression: models.BackupCompressionTarGz, extension: ".tar.gz", magic: []byte{0x1f, 0x8b}},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		similar := strings.Repeat("message User { string name = 1; }\n", 50)
+		repo := newBackupRepo(t, map[string]string{"a.proto": similar, "b.proto": similar, "sub/c.proto": similar + "// c\n"})
+		repo.BackupConfig.Compression = tt.compression
+
+		backup, err := m.createBackup(repo, []string{"a.proto", "b.proto", "sub/c.proto", "new.proto"})
+		if err != nil {
+			t.Fatalf("%s: createBackup() failed: %v", tt.compression, err)
+		}
+		if backup.Manifest.Compression != tt.compression || backup.Files != 3 {
+			t.Errorf("%s: backup = %+v", tt.compression, backup.Manifest)
+		}
+
+		// One archive next to the manifest, no blobs, nothing temporary left
+		root := m.GetBackupRoot(repo.Name)
+		archive, err := os.ReadFile(filepath.Join(root, backup.Name+tt.extension))
+		if err != nil {
+			t.Fatalf("%s: archive not written: %v", tt.compression, err)
+		}
+		if !bytes.HasPrefix(archive, tt.magic) {
+			t.Errorf("%s: archive starts with % x", tt.compression, archive[:4])
+		}
+		if len(archive) >= len(similar) {
+			t.Errorf("%s: archive of %d bytes for %d bytes of repeated content", tt.compression, len(archive), 3*len(similar))
+		}
+		if got := countBlobs(t, root); got != 0 {
+			t.Errorf("%s: %d blobs stored for an archived backup", tt.compression, got)
+		}
+		entries, _ := os.ReadDir(root)
+		if len(entries) != 2 {
+			t.Errorf("%s: backup root holds %d entries, want the manifest and the archive", tt.compression, len(entries))
+		}
+
+		// Listed like any other backup, and restored from the archive
+		found, err := m.FindBackup(repo.Name, LatestBackup)
+		if err != nil || found.Name != backup.Name {
+			t.Fatalf("%s: FindBackup() = %v, %v", tt.compression, found, err)
+		}
+		writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "changed", "sub/c.proto": "changed", "new.proto": "new"})
+		os.Remove(filepath.Join(repo.TargetDirectory, "b.proto"))
+		if _, err := m.RestoreBackup(repo, found, nil); err != nil {
+			t.Fatalf("%s: RestoreBackup() failed: %v", tt.compression, err)
+		}
+		want := map[string]string{"a.proto": similar, "b.proto": similar, "sub/c.proto": similar + "// c\n"}
+		if got := snapshot(t, repo.TargetDirectory); !sameFiles(got, want) {
+			t.Errorf("%s: target after restore = %v", tt.compression, keys(got))
+		}
+
+		// Pruning removes the archive with its manifest
+		if _, err := m.PruneBackups(repo.Name, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(root, backup.Name+tt.extension)); !os.IsNotExist(err) {
+			t.Errorf("%s: archive of a pruned backup was kept: %v", tt.compression, err)
+		}
+	}
+}
+
+func TestReadArchivedBackupErrors(t *testing.T) {
+	m := newTestManager(t)
+	repo := newBackupRepo(t, map[string]string{"a.proto": "a"})
+	repo.BackupConfig.Compression = models.BackupCompressionZstd
+	backup, err := m.createBackup(repo, []string{"a.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readBackupFile(backup, models.BackupFile{Path: "b.proto", Hash: sha256Hex("b")}); err == nil || !strings.Contains(err.Error(), "missing from") {
+		t.Errorf("readBackupFile() of content not in the archive = %v", err)
+	}
+
+	archive := archivePath(backup)
+	if err := os.WriteFile(archive, []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fresh := *backup
+	fresh.archive = nil
+	if _, err := readBackupFile(&fresh, backup.Manifest.Files[0]); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("readBackupFile() of a corrupt archive = %v", err)
+	}
+	os.Remove(archive)
+	if _, err := readBackupFile(&fresh, backup.Manifest.Files[0]); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("readBackupFile() without the archive = %v", err)
+	}
+}
+
+// countBlobs returns the number of blobs stored below a backup root
+func countBlobs(t *testing.T, root string) int {
+	t.Helper()
+	count := 0
+	err := filepath.Walk(filepath.Join(root, backupBlobDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return count
+}
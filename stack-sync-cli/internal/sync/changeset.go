@@ -0,0 +1,184 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// applyChangeset stages every write, merge and deletion next to the target and
+// swaps them in with renames. A failure while applying, a failing verify, or a
+// failing post-sync command with rollback_on_hook_failure restores the previous
+// files; the rollback is recorded in history. Cancelling ctx stops the sync
+// until the changes are swapped in, and aborts running post-sync commands.
+func (m *Manager) applyChangeset(ctx context.Context, repo *models.Repository, source *syncSource, entries []PlanEntry, result *SyncResult, startTime time.Time, verify func() error) (*SyncResult, error) {
+	var fileChanges []models.FileChange
+	outcome := syncOutcome{previousCommit: m.lockedCommit(repo)}
+
+	// fail records a failed sync and returns its error
+	fail := func(err error, rolledBack bool) (*SyncResult, error) {
+		repo.Status = models.StatusError
+		if rolledBack {
+			fmt.Fprintf(m.out, "Rolled back all changes to %s\n", repo.TargetDirectory)
+		}
+		outcome.rolledBack = rolledBack
+		outcome.cancelled = ctx.Err() != nil
+		outcome.err = err.Error()
+		m.recordSyncHistory(repo, source, fileChanges, startTime, outcome)
+		if outcome.cancelled {
+			return nil, fmt.Errorf("%w: %w", ErrCancelled, err)
+		}
+		return nil, err
+	}
+
+	txn, err := newStagedApply(repo.TargetDirectory)
+	if err != nil {
+		return fail(err, false)
+	}
+
+	// Stage everything first; the target is untouched until commit
+	written := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			txn.finish()
+			return fail(err, false)
+		}
+
+		srcPath := filepath.Join(source.path, entry.Path)
+		change := models.FileChange{Path: entry.Path}
+
+		switch entry.Status {
+		case "=":
+			change.ChangeType = models.ChangeTypeUnchanged
+		case "D":
+			change.ChangeType = models.ChangeTypeDeleted
+			txn.stageDelete(entry.Path)
+		default:
+			change.ChangeType = models.ChangeTypeModified
+			if entry.Status == "A" {
+				change.ChangeType = models.ChangeTypeAdded
+			}
+			if err := txn.stageFile(entry.Path, srcPath, m.copyFile); err != nil {
+				txn.finish()
+				return fail(err, false)
+			}
+			written++
+		}
+
+		// Size of the new content, or of the file being deleted
+		sizePath := srcPath
+		if change.ChangeType == models.ChangeTypeDeleted {
+			sizePath = filepath.Join(repo.TargetDirectory, entry.Path)
+		}
+		if info, err := os.Stat(sizePath); err == nil {
+			change.Size = info.Size()
+		}
+
+		fileChanges = append(fileChanges, change)
+	}
+
+	// Merge files edited on both sides into the staging directory
+	merged, err := m.stageMerges(repo, source.path, result.LocalEdits, txn)
+	fileChanges = append(fileChanges, merged...)
+	if err != nil {
+		txn.finish()
+		return fail(err, false)
+	}
+	written += len(merged)
+
+	// Back up only what is about to be overwritten or deleted
+	outcome.backup = m.backupChanges(repo, fileChanges)
+
+	// Last chance to cancel before the target changes
+	if err := ctx.Err(); err != nil {
+		txn.finish()
+		return fail(err, false)
+	}
+
+	fmt.Fprintf(m.out, "Syncing %d files from %s to %s...\n", written+countDeleted(fileChanges), source.path, repo.TargetDirectory)
+	if err := txn.commit(); err != nil {
+		return fail(fmt.Errorf("failed to apply changes: %w", err), true)
+	}
+
+	if verify != nil {
+		if err := verify(); err != nil {
+			if rbErr := txn.rollback(); rbErr != nil {
+				return fail(fmt.Errorf("%w (rollback failed: %v)", err, rbErr), false)
+			}
+			return fail(err, true)
+		}
+	}
+
+	result.Changes = fileChanges
+
+	// Execute post-sync commands, only when files actually changed
+	if len(repo.PostSyncCommands) > 0 && result.HasChanges() {
+		if err := m.executePostSyncCommands(ctx, repo); err != nil {
+			if !repo.RollbackOnHookFailure {
+				fmt.Fprintf(m.out, "Warning: post-sync command failed: %v\n", err)
+			} else if rbErr := txn.rollback(); rbErr != nil {
+				result.Changes = nil
+				return fail(fmt.Errorf("post-sync command failed: %w (rollback failed: %v)", err, rbErr), false)
+			} else {
+				result.Changes = nil
+				return fail(fmt.Errorf("post-sync command failed: %w", err), true)
+			}
+		}
+	} else if len(repo.PostSyncCommands) > 0 {
+		fmt.Fprintln(m.out, "No files changed, skipping post-sync commands")
+	}
+
+	txn.finish()
+	fmt.Fprintf(m.out, "Synced %d files\n", written)
+	m.pruneOldBackups(repo)
+
+	// Update status
+	repo.Status = models.StatusUpToDate
+	now := time.Now()
+	repo.LastSync = &now
+	repo.FilesTracked = len(fileChanges) - countDeleted(fileChanges)
+
+	// Record sync history, with what was written for undo
+	hashWritten(repo.TargetDirectory, fileChanges)
+	outcome.success = true
+	m.recordSyncHistory(repo, source, fileChanges, startTime, outcome)
+
+	// Record the synced commit and file hashes in the target's lockfile
+	if !source.locked {
+		if err := m.updateLock(repo, source, source.path, fileChanges, result.LocalEdits); err != nil {
+			fmt.Fprintf(m.out, "Warning: failed to update lockfile: %v\n", err)
+		}
+	}
+
+	// Record the files this repository now owns
+	if err := m.updateManifest(repo, fileChanges); err != nil {
+		fmt.Fprintf(m.out, "Warning: failed to update ownership manifest: %v\n", err)
+	}
+
+	// Remember the synced content as the base of the next three-way comparison
+	if err := m.updateBase(repo, source.path, fileChanges); err != nil {
+		fmt.Fprintf(m.out, "Warning: failed to store base snapshot: %v\n", err)
+	}
+
+	if result.HasConflicts() {
+		m.reportConflicts(repo, result)
+		repo.Status = models.StatusConflict
+	}
+
+	return result, nil
+}
+
+// countDeleted returns how many changes are deletions
+func countDeleted(fileChanges []models.FileChange) int {
+	count := 0
+	for _, change := range fileChanges {
+		if change.ChangeType == models.ChangeTypeDeleted {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// DriftReport lists how a target directory differs from its remote source.
+// Paths are relative to the target directory and use forward slashes.
+type DriftReport struct {
+	Repository      string   `json:"repository"`
+	Revision        string   `json:"revision"`
+	Commit          string   `json:"commit,omitempty"`
+	TargetDirectory string   `json:"target_directory"`
+	Added           []string `json:"added"`    // only on the remote, a sync would create them
+	Modified        []string `json:"modified"` // content differs from the remote
+	Deleted         []string `json:"deleted"`  // owned by the repository, only in the target
+	Error           string   `json:"error,omitempty"`
+}
+
+// HasDrift reports whether the target differs from the remote
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Added)+len(r.Modified)+len(r.Deleted) > 0
+}
+
+// NewDriftReport creates an empty report for a repository
+func NewDriftReport(repo *models.Repository) *DriftReport {
+	return &DriftReport{
+		Repository:      repo.Name,
+		Revision:        repo.GetRevision(),
+		TargetDirectory: repo.TargetDirectory,
+		Added:           []string{},
+		Modified:        []string{},
+		Deleted:         []string{},
+	}
+}
+
+// CheckDrift compares the target directory against the configured branch or
+// ref, using the same comparison as the diff preview, without writing anything
+func (m *Manager) CheckDrift(ctx context.Context, repo *models.Repository) (*DriftReport, error) {
+	report := NewDriftReport(repo)
+
+	source, cleanup, err := m.prepareSource(ctx, repo)
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+	report.Commit = source.commit
+
+	entries, err := m.getDiffEntries(ctx, source.path, repo.TargetDirectory, repo.FilePatterns, repo.ExcludePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff: %w", err)
+	}
+
+	// Like sync, leave files the repository doesn't own alone
+	owned, err := m.ownedFiles(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		switch entry.Status {
+		case "A":
+			report.Added = append(report.Added, entry.Path)
+		case "D":
+			if owned[filepath.ToSlash(entry.Path)] {
+				report.Deleted = append(report.Deleted, entry.Path)
+			}
+		default:
+			report.Modified = append(report.Modified, entry.Path)
+		}
+	}
+	sort.Strings(report.Added)
+	sort.Strings(report.Modified)
+	sort.Strings(report.Deleted)
+
+	return report, nil
+}
@@ -0,0 +1,95 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDrift(t *testing.T) {
+	tests := []struct {
+		name         string
+		upstream     map[string]string
+		removed      []string
+		local        map[string]string
+		localRemoved []string
+		wantAdded    string
+		wantModified string
+		wantDeleted  string
+	}{
+		{name: "in sync"},
+		{
+			name:         "edited locally",
+			local:        map[string]string{"a.proto": "edited"},
+			wantModified: "a.proto",
+		},
+		{
+			name:         "deleted locally",
+			localRemoved: []string{"sub/c.proto"},
+			wantAdded:    "sub/c.proto",
+		},
+		{
+			name:         "changed upstream",
+			upstream:     map[string]string{"api/a.proto": "a2", "api/d.proto": "d1", "api/notes.txt": "ignored"},
+			wantAdded:    "d.proto",
+			wantModified: "a.proto",
+		},
+		{
+			name:        "removed upstream",
+			removed:     []string{"api/b.proto"},
+			wantDeleted: "b.proto",
+		},
+		{
+			name:  "unowned target files are not drift",
+			local: map[string]string{"hand.proto": "hand written", "sub/hand.proto": "hand written"},
+		},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1", "api/sub/c.proto": "c1", "README.md": "readme"})
+		repo := syncedRepo(t, u)
+		syncAll(t, m, repo)
+
+		if tt.upstream != nil || tt.removed != nil {
+			u.commit(tt.upstream, tt.removed...)
+		}
+		writeFiles(t, repo.TargetDirectory, tt.local)
+		for _, path := range tt.localRemoved {
+			if err := os.Remove(filepath.Join(repo.TargetDirectory, filepath.FromSlash(path))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		before := readTarget(t, repo, "a.proto")
+		report, err := m.CheckDrift(context.Background(), repo)
+		if err != nil {
+			t.Errorf("%s: CheckDrift() failed: %v", tt.name, err)
+			continue
+		}
+
+		got := []string{strings.Join(report.Added, " "), strings.Join(report.Modified, " "), strings.Join(report.Deleted, " ")}
+		want := []string{tt.wantAdded, tt.wantModified, tt.wantDeleted}
+		for i, kind := range []string{"added", "modified", "deleted"} {
+			if filepath.ToSlash(got[i]) != want[i] {
+				t.Errorf("%s: %s = %q, want %q", tt.name, kind, got[i], want[i])
+			}
+		}
+		if wantDrift := tt.wantAdded+tt.wantModified+tt.wantDeleted != ""; report.HasDrift() != wantDrift {
+			t.Errorf("%s: HasDrift() = %v, want %v", tt.name, report.HasDrift(), wantDrift)
+		}
+		if len(report.Commit) != 40 || report.Repository != repo.Name || report.Revision != "main" {
+			t.Errorf("%s: report = %s %s @ %s", tt.name, report.Repository, report.Revision, report.Commit)
+		}
+
+		// Checking writes nothing
+		if after := readTarget(t, repo, "a.proto"); after != before {
+			t.Errorf("%s: a.proto changed from %q to %q", tt.name, before, after)
+		}
+		if histories, _ := GetHistoryForRepository(repo.Name, 0); len(histories) != 1 {
+			t.Errorf("%s: %d history entries, want only the sync's", tt.name, len(histories))
+		}
+	}
+}
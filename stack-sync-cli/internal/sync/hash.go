@@ -0,0 +1,181 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// hashFile returns the hex encoded SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashWritten records the hash of every file a sync wrote into targetDir in
+// its change, so undo can tell whether the file was edited since
+func hashWritten(targetDir string, fileChanges []models.FileChange) {
+	for i := range fileChanges {
+		change := &fileChanges[i]
+		if change.ChangeType != models.ChangeTypeAdded && change.ChangeType != models.ChangeTypeModified {
+			continue
+		}
+		if hash, err := hashFile(filepath.Join(targetDir, change.Path)); err == nil {
+			change.Hash = hash
+		}
+	}
+}
+
+// hashCacheEntry remembers the hash of a file for a given size and modification time
+type hashCacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"` // UnixNano
+	Hash    string `json:"hash"`
+}
+
+// hashCache skips re-hashing target files whose size and mtime haven't changed
+type hashCache struct {
+	entries map[string]hashCacheEntry
+	dirty   bool
+}
+
+// racyWindow is how recent a modification must be for its hash not to be cached,
+// since a second write within the same mtime tick would go unnoticed
+const racyWindow = 2 * time.Second
+
+// GetHashCachePath returns the path of the file hash cache
+func GetHashCachePath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".stack-sync/hash-cache.json"
+	}
+	return filepath.Join(homeDir, ".stack-sync", "hash-cache.json")
+}
+
+// loadHashCache loads the hash cache; a missing or corrupt cache starts empty
+func loadHashCache() *hashCache {
+	cache := &hashCache{entries: make(map[string]hashCacheEntry)}
+
+	data, err := os.ReadFile(GetHashCachePath())
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		cache.entries = make(map[string]hashCacheEntry)
+	}
+	return cache
+}
+
+// hash returns the SHA-256 of a file, reusing the cached value when size and mtime match
+func (c *hashCache) hash(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+
+	if entry, ok := c.entries[abs]; ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() {
+		return entry.Hash, nil
+	}
+
+	sum, err := hashFile(abs)
+	if err != nil {
+		return "", err
+	}
+
+	if time.Since(info.ModTime()) > racyWindow {
+		c.entries[abs] = hashCacheEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Hash: sum}
+		c.dirty = true
+	}
+	return sum, nil
+}
+
+// hashCacheMu serializes cache saves of syncs running in parallel
+var hashCacheMu gosync.Mutex
+
+// save writes the cache back if it changed, dropping entries for files that no
+// longer exist. Entries saved meanwhile by other syncs are kept.
+func (c *hashCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+
+	hashCacheMu.Lock()
+	defer hashCacheMu.Unlock()
+
+	for path, entry := range loadHashCache().entries {
+		if _, ok := c.entries[path]; !ok {
+			c.entries[path] = entry
+		}
+	}
+
+	for path := range c.entries {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(c.entries, path)
+		}
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hash cache: %w", err)
+	}
+
+	cachePath := GetHashCachePath()
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create hash cache directory: %w", err)
+	}
+	if err := os.WriteFile(cachePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// sameHash reports whether a source file and a target file have the same content.
+// Only the target goes through the cache; sources live in a fresh checkout.
+func sameHash(cache *hashCache, srcPath, dstPath string) (bool, error) {
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return false, err
+	}
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		return false, err
+	}
+	if srcInfo.Size() != dstInfo.Size() {
+		return false, nil
+	}
+
+	srcHash, err := hashFile(srcPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", srcPath, err)
+	}
+	dstHash, err := cache.hash(dstPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", dstPath, err)
+	}
+	return srcHash == dstHash, nil
+}
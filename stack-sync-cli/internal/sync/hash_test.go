@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeAt writes a file and sets its modification time
+func writeAt(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashCacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	hourAgo := time.Now().Add(-time.Hour)
+	original := "syntax = \"proto3\";\n"
+	originalHash := sha256Hex(original)
+
+	tests := []struct {
+		name string
+		// rewrite changes the file after its hash was cached
+		rewrite func(path string)
+		want    string
+	}{
+		{
+			name:    "same size and mtime reuses the cached hash",
+			rewrite: func(path string) { writeAt(t, path, "syntax = \"proto2\";\n", hourAgo) },
+			want:    originalHash,
+		},
+		{
+			name:    "new mtime",
+			rewrite: func(path string) { writeAt(t, path, "syntax = \"proto2\";\n", hourAgo.Add(time.Second)) },
+			want:    sha256Hex("syntax = \"proto2\";\n"),
+		},
+		{
+			name:    "new size",
+			rewrite: func(path string) { writeAt(t, path, "package foo;\n", hourAgo) },
+			want:    sha256Hex("package foo;\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, "a.proto")
+		writeAt(t, path, original, hourAgo)
+
+		cache := &hashCache{entries: make(map[string]hashCacheEntry)}
+		sum, err := cache.hash(path)
+		if err != nil {
+			t.Fatalf("%s: hash() failed: %v", tt.name, err)
+		}
+		if sum != originalHash || !cache.dirty {
+			t.Fatalf("%s: hash() = %s (dirty %v), want %s cached", tt.name, sum, cache.dirty, originalHash)
+		}
+
+		tt.rewrite(path)
+		if sum, err = cache.hash(path); err != nil {
+			t.Fatalf("%s: hash() failed: %v", tt.name, err)
+		}
+		if sum != tt.want {
+			t.Errorf("%s: hash() = %s, want %s", tt.name, sum, tt.want)
+		}
+	}
+}
+
+func TestHashCacheSkipsRacyFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.proto")
+	if err := os.WriteFile(path, []byte("fresh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := &hashCache{entries: make(map[string]hashCacheEntry)}
+	if _, err := cache.hash(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.entries) != 0 || cache.dirty {
+		t.Errorf("a file modified within the racy window was cached: %v", cache.entries)
+	}
+}
+
+func TestHashCacheSave(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	kept, removed, other := filepath.Join(dir, "kept"), filepath.Join(dir, "removed"), filepath.Join(dir, "other")
+	for _, path := range []string{kept, removed, other} {
+		writeAt(t, path, path, time.Now().Add(-time.Hour))
+	}
+
+	// Another sync saved its entry first
+	first := loadHashCache()
+	if _, err := first.hash(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.save(); err != nil {
+		t.Fatalf("save() failed: %v", err)
+	}
+
+	cache := loadHashCache()
+	cache.entries = make(map[string]hashCacheEntry)
+	for _, path := range []string{kept, removed} {
+		if _, err := cache.hash(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() failed: %v", err)
+	}
+
+	loaded := loadHashCache()
+	for path, want := range map[string]bool{kept: true, other: true, removed: false} {
+		if _, ok := loaded.entries[path]; ok != want {
+			t.Errorf("cache entry for %s present = %v, want %v", filepath.Base(path), ok, want)
+		}
+	}
+
+	// A corrupt cache starts over
+	if err := os.WriteFile(GetHashCachePath(), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if entries := loadHashCache().entries; len(entries) != 0 {
+		t.Errorf("corrupt cache loaded %d entries", len(entries))
+	}
+}
+
+func TestSameHash(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.proto")
+	dst := filepath.Join(dir, "dst.proto")
+
+	tests := []struct {
+		name     string
+		src, dst string
+		want     bool
+	}{
+		{name: "identical", src: "message A {}", dst: "message A {}", want: true},
+		{name: "different size", src: "message A {}", dst: "message AB {}", want: false},
+		{name: "same size, different content", src: "message A {}", dst: "message B {}", want: false},
+		{name: "empty", src: "", dst: "", want: true},
+	}
+
+	for _, tt := range tests {
+		writeAt(t, src, tt.src, time.Now().Add(-time.Hour))
+		writeAt(t, dst, tt.dst, time.Now().Add(-time.Hour))
+
+		cache := &hashCache{entries: make(map[string]hashCacheEntry)}
+		got, err := sameHash(cache, src, dst)
+		if err != nil {
+			t.Errorf("%s: sameHash() failed: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: sameHash() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	cache := &hashCache{entries: make(map[string]hashCacheEntry)}
+	if _, err := sameHash(cache, src, filepath.Join(dir, "missing.proto")); err == nil {
+		t.Error("sameHash() with a missing target should fail")
+	}
+}
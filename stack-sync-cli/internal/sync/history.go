@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	gosync "sync"
 
 	"github.com/google/uuid"
 	"github.com/stackfilesync/stack-sync-cli/pkg/models"
@@ -65,8 +66,14 @@ func SaveHistory(store *models.SyncHistoryStore) error {
 	return nil
 }
 
+// historyMu serializes history updates of syncs running in parallel
+var historyMu gosync.Mutex
+
 // AddHistory adds a new sync history entry
 func AddHistory(history models.SyncHistory) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
 	store, err := LoadHistory()
 	if err != nil {
 		return err
@@ -124,4 +131,3 @@ func GetAllHistory(limit int) ([]models.SyncHistory, error) {
 
 	return store.Histories, nil
 }
-
@@ -0,0 +1,235 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// LockFileName is the name of the lockfile written into each target directory
+const LockFileName = ".stack-sync.lock"
+
+// lockFileVersion is the current lockfile format version
+const lockFileVersion = 1
+
+// ErrLockDrift is returned when the remote or target no longer matches the lockfile
+var ErrLockDrift = errors.New("drift detected")
+
+// GetLockPath returns the path of the lockfile for a target directory
+func GetLockPath(targetDir string) string {
+	return filepath.Join(targetDir, LockFileName)
+}
+
+// LoadLock loads the lockfile of a target directory
+func LoadLock(targetDir string) (*models.LockFile, error) {
+	lockPath := GetLockPath(targetDir)
+
+	// If file doesn't exist, return empty lock
+	if _, err := os.Stat(lockPath); os.IsNotExist(err) {
+		return &models.LockFile{
+			Version:      lockFileVersion,
+			Repositories: []models.LockEntry{},
+		}, nil
+	}
+
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	var lock models.LockFile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile: %w", err)
+	}
+
+	return &lock, nil
+}
+
+// SaveLock writes the lockfile of a target directory
+func SaveLock(targetDir string, lock *models.LockFile) error {
+	// Keep entries in a stable order so the file diffs cleanly
+	sort.Slice(lock.Repositories, func(i, j int) bool {
+		return lock.Repositories[i].Name < lock.Repositories[j].Name
+	})
+	lock.Version = lockFileVersion
+
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+
+	if err := os.WriteFile(GetLockPath(targetDir), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+
+	return nil
+}
+
+// updateLock records the synced commit in the target's lockfile, with the
+// hashes of the changed files and of files kept with local edits as they are
+// in root. Syncs pass the checkout, so merged and kept files are locked at
+// their upstream content and --locked reproduces the commit anywhere.
+func (m *Manager) updateLock(repo *models.Repository, source *syncSource, root string, fileChanges []models.FileChange, localEdits []LocalEdit) error {
+	lock, err := LoadLock(repo.TargetDirectory)
+	if err != nil {
+		return err
+	}
+
+	entry := lock.GetEntry(repo.Name)
+	if entry == nil {
+		lock.Repositories = append(lock.Repositories, models.LockEntry{Name: repo.Name})
+		entry = &lock.Repositories[len(lock.Repositories)-1]
+	}
+
+	entry.URL = repo.URL
+	entry.Branch = repo.Branch
+	entry.Ref = repo.Ref
+	entry.Commit = source.commit
+	entry.SourceDirectory = repo.SourceDirectory
+	if entry.Files == nil {
+		entry.Files = make(map[string]string)
+	}
+
+	paths := make(map[string]bool)
+	for _, change := range fileChanges {
+		path := filepath.ToSlash(change.Path)
+		if change.ChangeType == models.ChangeTypeDeleted {
+			delete(entry.Files, path)
+			continue
+		}
+		paths[path] = true
+	}
+	for _, edit := range localEdits {
+		if edit.Resolution == models.OnConflictKeepLocal {
+			paths[edit.Path] = true
+		}
+	}
+
+	for path := range paths {
+		hash, err := hashFile(filepath.Join(root, filepath.FromSlash(path)))
+		if os.IsNotExist(err) {
+			// Kept locally but gone upstream
+			delete(entry.Files, path)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+		entry.Files[path] = hash
+	}
+
+	return SaveLock(repo.TargetDirectory, lock)
+}
+
+// removeLockEntry drops a repository from the target's lockfile, and removes
+// the lockfile once no repository is left in it
+func removeLockEntry(targetDir, name string) error {
+	lock, err := LoadLock(targetDir)
+	if err != nil {
+		return err
+	}
+
+	var kept []models.LockEntry
+	for _, entry := range lock.Repositories {
+		if entry.Name != name {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == 0 {
+		if err := os.Remove(GetLockPath(targetDir)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove lockfile: %w", err)
+		}
+		return nil
+	}
+
+	lock.Repositories = kept
+	return SaveLock(targetDir, lock)
+}
+
+// lockedCommit returns the commit the target's lockfile records for a repository, or ""
+func (m *Manager) lockedCommit(repo *models.Repository) string {
+	lock, err := LoadLock(repo.TargetDirectory)
+	if err != nil {
+		return ""
+	}
+	if entry := lock.GetEntry(repo.Name); entry != nil {
+		return entry.Commit
+	}
+	return ""
+}
+
+// SyncRepositoryLocked reproduces the state recorded in the target's lockfile:
+// the locked commit is checked out and every locked file must match its hash
+func (m *Manager) SyncRepositoryLocked(ctx context.Context, repo *models.Repository) (*SyncResult, error) {
+	lock, err := LoadLock(repo.TargetDirectory)
+	if err != nil {
+		repo.Status = models.StatusError
+		return nil, err
+	}
+
+	entry := lock.GetEntry(repo.Name)
+	if entry == nil || entry.Commit == "" {
+		repo.Status = models.StatusError
+		return nil, fmt.Errorf("no lock entry for %s in %s, run a normal sync first", repo.Name, GetLockPath(repo.TargetDirectory))
+	}
+
+	if entry.SourceDirectory != repo.SourceDirectory {
+		repo.Status = models.StatusError
+		return nil, fmt.Errorf("lockfile was created from source directory %q but config uses %q", entry.SourceDirectory, repo.SourceDirectory)
+	}
+
+	// Check out exactly the locked commit
+	fmt.Fprintf(m.out, "Using locked commit %s\n", entry.Commit)
+
+	// Double check the result is byte-identical to the lock before keeping it
+	verify := func() error {
+		for path, want := range entry.Files {
+			got, err := hashFile(filepath.Join(repo.TargetDirectory, filepath.FromSlash(path)))
+			if err != nil || got != want {
+				return fmt.Errorf("hash mismatch after copy: %s", path)
+			}
+		}
+		return nil
+	}
+
+	return m.runPipeline(ctx, repo, syncPipeline{
+		selector: lockSelector{entry: entry},
+		ref:      entry.Commit,
+		locked:   true,
+		verify:   verify,
+	})
+}
+
+// lockSelector selects exactly the files of a lock entry, after verifying
+// every one of them against the checked out commit
+type lockSelector struct {
+	entry *models.LockEntry
+}
+
+// Select implements Selector
+func (s lockSelector) Select(m *Manager, plan *Plan) ([]PlanEntry, error) {
+	var files []string
+	for path, want := range s.entry.Files {
+		got, err := hashFile(filepath.Join(plan.SourcePath, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: locked file %s missing at commit %s", ErrLockDrift, path, shortHash(s.entry.Commit))
+		}
+		if got != want {
+			return nil, fmt.Errorf("%w: locked file %s does not match commit %s (lock %s, remote %s)", ErrLockDrift, path, shortHash(s.entry.Commit), shortHash(want), shortHash(got))
+		}
+		files = append(files, filepath.FromSlash(path))
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		fmt.Fprintln(m.out, "Lock entry has no files. Nothing to sync.")
+		return nil, nil
+	}
+	return m.plannedEntries(plan.SourcePath, plan.Repository.TargetDirectory, files), nil
+}
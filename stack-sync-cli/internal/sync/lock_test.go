@@ -0,0 +1,202 @@
+package sync
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+func TestLoadSaveLock(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := LoadLock(dir)
+	if err != nil {
+		t.Fatalf("LoadLock() without a lockfile failed: %v", err)
+	}
+	if len(lock.Repositories) != 0 {
+		t.Fatalf("LoadLock() without a lockfile = %+v, want empty", lock)
+	}
+
+	lock.Repositories = []models.LockEntry{
+		{Name: "web", Commit: "bbbb", Files: map[string]string{"b.proto": "2"}},
+		{Name: "api", Commit: "aaaa", Files: map[string]string{"a.proto": "1"}},
+	}
+	if err := SaveLock(dir, lock); err != nil {
+		t.Fatalf("SaveLock() failed: %v", err)
+	}
+
+	loaded, err := LoadLock(dir)
+	if err != nil {
+		t.Fatalf("LoadLock() failed: %v", err)
+	}
+	if loaded.Version != lockFileVersion {
+		t.Errorf("lockfile version = %d, want %d", loaded.Version, lockFileVersion)
+	}
+	if len(loaded.Repositories) != 2 || loaded.Repositories[0].Name != "api" || loaded.Repositories[1].Name != "web" {
+		t.Errorf("lockfile entries = %+v, want api and web sorted by name", loaded.Repositories)
+	}
+	if entry := loaded.GetEntry("web"); entry == nil || entry.Commit != "bbbb" || entry.Files["b.proto"] != "2" {
+		t.Errorf("GetEntry(web) = %+v", entry)
+	}
+	if entry := loaded.GetEntry("missing"); entry != nil {
+		t.Errorf("GetEntry(missing) = %+v, want nil", entry)
+	}
+}
+
+func TestUpdateLock(t *testing.T) {
+	checkout := t.TempDir()
+	writeFiles(t, checkout, map[string]string{
+		"added.proto":      "added upstream",
+		"modified.proto":   "modified upstream",
+		"kept.proto":       "changed upstream",
+		"sub/nested.proto": "nested",
+	})
+
+	tests := []struct {
+		name       string
+		locked     map[string]string
+		changes    []models.FileChange
+		localEdits []LocalEdit
+		want       map[string]string
+	}{
+		{
+			name: "added, modified and deleted files",
+			locked: map[string]string{
+				"modified.proto":  "old",
+				"deleted.proto":   "old",
+				"untouched.proto": "old",
+			},
+			changes: []models.FileChange{
+				{Path: "added.proto", ChangeType: models.ChangeTypeAdded},
+				{Path: "modified.proto", ChangeType: models.ChangeTypeModified},
+				{Path: filepath.Join("sub", "nested.proto"), ChangeType: models.ChangeTypeAdded},
+				{Path: "deleted.proto", ChangeType: models.ChangeTypeDeleted},
+			},
+			want: map[string]string{
+				"added.proto":      sha256Hex("added upstream"),
+				"modified.proto":   sha256Hex("modified upstream"),
+				"sub/nested.proto": sha256Hex("nested"),
+				"untouched.proto":  "old",
+			},
+		},
+		{
+			name:   "kept local edits are locked at their upstream content",
+			locked: map[string]string{"kept.proto": "old", "gone.proto": "old"},
+			localEdits: []LocalEdit{
+				{Path: "kept.proto", Resolution: models.OnConflictKeepLocal},
+				{Path: "gone.proto", Resolution: models.OnConflictKeepLocal},
+				{Path: "modified.proto", Resolution: models.OnConflictTakeRemote},
+			},
+			want: map[string]string{"kept.proto": sha256Hex("changed upstream")},
+		},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		repo := &models.Repository{Name: "proto", URL: "https://example.com/proto.git", TargetDirectory: t.TempDir()}
+		if err := SaveLock(repo.TargetDirectory, &models.LockFile{Repositories: []models.LockEntry{{Name: repo.Name, Commit: "old", Files: tt.locked}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		source := &syncSource{commit: strings.Repeat("c", 40)}
+		if err := m.updateLock(repo, source, checkout, tt.changes, tt.localEdits); err != nil {
+			t.Fatalf("%s: updateLock() failed: %v", tt.name, err)
+		}
+
+		lock, err := LoadLock(repo.TargetDirectory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := lock.GetEntry(repo.Name)
+		if entry.Commit != source.commit || entry.URL != repo.URL {
+			t.Errorf("%s: entry = %s @ %s, want %s @ %s", tt.name, entry.URL, entry.Commit, repo.URL, source.commit)
+		}
+		if len(entry.Files) != len(tt.want) {
+			t.Errorf("%s: locked files = %v, want %v", tt.name, entry.Files, tt.want)
+		}
+		for path, want := range tt.want {
+			if entry.Files[path] != want {
+				t.Errorf("%s: %s locked at %q, want %q", tt.name, path, entry.Files[path], want)
+			}
+		}
+	}
+}
+
+func TestLockSelector(t *testing.T) {
+	source := t.TempDir()
+	writeFiles(t, source, map[string]string{"a.proto": "a", "sub/b.proto": "b", "unlocked.proto": "x"})
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "matching files",
+			files: map[string]string{"a.proto": sha256Hex("a"), "sub/b.proto": sha256Hex("b")},
+			want:  "a.proto " + filepath.Join("sub", "b.proto"),
+		},
+		{
+			name:  "no files",
+			files: map[string]string{},
+		},
+		{
+			name:    "content differs",
+			files:   map[string]string{"a.proto": sha256Hex("other")},
+			wantErr: "does not match commit 12345678 (lock " + sha256Hex("other")[:8] + ", remote " + sha256Hex("a")[:8] + ")",
+		},
+		{
+			name:    "short lock hash",
+			files:   map[string]string{"a.proto": "abc"},
+			wantErr: "(lock abc, remote",
+		},
+		{
+			name:    "missing upstream",
+			files:   map[string]string{"gone.proto": sha256Hex("gone")},
+			wantErr: "locked file gone.proto missing at commit 12345678",
+		},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		repo := &models.Repository{Name: "proto", TargetDirectory: t.TempDir()}
+		selector := lockSelector{entry: &models.LockEntry{Commit: "1234567890abcdef", Files: tt.files}}
+
+		entries, err := selector.Select(m, &Plan{Repository: repo, SourcePath: source})
+		if tt.wantErr != "" {
+			if !errors.Is(err, ErrLockDrift) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: Select() error = %v, want ErrLockDrift containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Select() failed: %v", tt.name, err)
+			continue
+		}
+		if got := entryPaths(entries); got != filepath.ToSlash(tt.want) {
+			t.Errorf("%s: Select() = %q, want %q", tt.name, got, filepath.ToSlash(tt.want))
+		}
+	}
+}
+
+func TestShortHash(t *testing.T) {
+	tests := []struct {
+		hash string
+		want string
+	}{
+		{"1234567890abcdef", "12345678"},
+		{"12345678", "12345678"},
+		{"abc", "abc"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := shortHash(tt.hash); got != tt.want {
+			t.Errorf("shortHash(%q) = %q, want %q", tt.hash, got, tt.want)
+		}
+	}
+}
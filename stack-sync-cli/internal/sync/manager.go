@@ -2,6 +2,8 @@ package sync
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -16,15 +18,22 @@ import (
 
 	"github.com/eiannone/keyboard"
 	"github.com/stackfilesync/stack-sync-cli/internal/config"
-	"github.com/stackfilesync/stack-sync-cli/internal/git"
 	"github.com/stackfilesync/stack-sync-cli/internal/i18n"
 	"github.com/stackfilesync/stack-sync-cli/pkg/models"
 )
 
 // Manager handles repository synchronization (matches IntelliJ plugin)
 type Manager struct {
-	config *config.Config
-	i18n   *i18n.I18n
+	config         *config.Config
+	i18n           *i18n.I18n
+	nonInteractive bool         // select every matching file instead of prompting
+	dryRun         bool         // print the planned changes instead of applying them
+	prune          bool         // delete synced files removed upstream, even if the repository doesn't enable it
+	force          bool         // take ownership of unowned files instead of reporting conflicts
+	onConflict     string       // resolution for files edited locally and upstream, overrides the repository's on_conflict
+	offline        bool         // status checks read the cached mirror instead of the remote
+	out            io.Writer    // progress and report output, stdout by default
+	targets        *targetLocks // serializes applies to overlapping targets in a parallel sync
 }
 
 // NewManager creates a new sync manager
@@ -32,22 +41,96 @@ func NewManager(cfg *config.Config, i18nInstance *i18n.I18n) *Manager {
 	return &Manager{
 		config: cfg,
 		i18n:   i18nInstance,
+		out:    os.Stdout,
 	}
 }
 
-// diffEntry represents a file diff entry for preview mode
-type diffEntry struct {
+// SetOutput sends progress messages, reports and hook output to w instead of stdout
+func (m *Manager) SetOutput(w io.Writer) {
+	m.out = w
+}
+
+// errOut returns where command errors go: stderr, unless output was redirected
+func (m *Manager) errOut() io.Writer {
+	if m.out == io.Writer(os.Stdout) {
+		return os.Stderr
+	}
+	return m.out
+}
+
+// SetNonInteractive disables all prompts; every file matching the configured patterns is synced
+func (m *Manager) SetNonInteractive(nonInteractive bool) {
+	m.nonInteractive = nonInteractive
+}
+
+// IsNonInteractive reports whether prompts are disabled
+func (m *Manager) IsNonInteractive() bool {
+	return m.nonInteractive
+}
+
+// SetDryRun makes every sync mode print its plan without touching the target, history or lockfile
+func (m *Manager) SetDryRun(dryRun bool) {
+	m.dryRun = dryRun
+}
+
+// SetPrune enables pruning for every repository, as if each had prune: true
+func (m *Manager) SetPrune(prune bool) {
+	m.prune = prune
+}
+
+// SetForce lets syncs overwrite and delete files the repository doesn't own yet
+func (m *Manager) SetForce(force bool) {
+	m.force = force
+}
+
+// SetOnConflict sets how files edited both locally and upstream are resolved for every repository
+func (m *Manager) SetOnConflict(strategy string) {
+	m.onConflict = strategy
+}
+
+// SetOffline makes status checks compare against the cached mirror instead of asking the remote
+func (m *Manager) SetOffline(offline bool) {
+	m.offline = offline
+}
+
+// PlanEntry is one planned change to a target file
+type PlanEntry struct {
 	Path   string
-	Status string // A, M, D
+	Status string // A added, M modified, D deleted, = unchanged
+}
+
+// ChangeType returns the history change type of the entry's status
+func (e PlanEntry) ChangeType() models.FileChangeType {
+	switch e.Status {
+	case "A":
+		return models.ChangeTypeAdded
+	case "D":
+		return models.ChangeTypeDeleted
+	case "=":
+		return models.ChangeTypeUnchanged
+	}
+	return models.ChangeTypeModified
+}
+
+// syncOutcome is how a sync ended, as recorded in its history entry
+type syncOutcome struct {
+	success        bool
+	rolledBack     bool
+	cancelled      bool // interrupted by a signal or cancelled by the caller
+	err            string
+	backup         string // backup taken right before the changes were applied
+	previousCommit string // commit the lockfile recorded before the sync
+	undoOf         string // ID of the history entry this sync reverted
 }
 
 // recordSyncHistory records sync history and displays change summary
-func (m *Manager) recordSyncHistory(repo *models.Repository, fileChanges []models.FileChange, startTime time.Time, success bool, errMsg string) {
+func (m *Manager) recordSyncHistory(repo *models.Repository, source *syncSource, fileChanges []models.FileChange, startTime time.Time, outcome syncOutcome) {
 	// Calculate statistics
 	addedCount := 0
 	modifiedCount := 0
 	deletedCount := 0
-	
+	unchangedCount := 0
+
 	for _, change := range fileChanges {
 		switch change.ChangeType {
 		case models.ChangeTypeAdded:
@@ -56,23 +139,34 @@ func (m *Manager) recordSyncHistory(repo *models.Repository, fileChanges []model
 			modifiedCount++
 		case models.ChangeTypeDeleted:
 			deletedCount++
+		case models.ChangeTypeUnchanged:
+			unchangedCount++
 		}
 	}
 
 	// Display change summary
-	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Println("📊 同步变更摘要 (Sync Change Summary)")
-	fmt.Println(strings.Repeat("=", 60))
-	fmt.Printf("总文件数: %d\n", len(fileChanges))
-	fmt.Printf("  ✅ 新增: %d 个文件\n", addedCount)
-	fmt.Printf("  🔄 修改: %d 个文件\n", modifiedCount)
-	fmt.Printf("  ❌ 删除: %d 个文件\n", deletedCount)
-	fmt.Println(strings.Repeat("-", 60))
+	fmt.Fprintln(m.out, "\n"+strings.Repeat("=", 60))
+	fmt.Fprintln(m.out, "📊 同步变更摘要 (Sync Change Summary)")
+	fmt.Fprintln(m.out, strings.Repeat("=", 60))
+	if source.commit != "" {
+		fmt.Fprintf(m.out, "远程提交 (Commit): %s @ %s\n", source.commit, source.resolved)
+	}
+	fmt.Fprintf(m.out, "总文件数: %d\n", len(fileChanges))
+	fmt.Fprintf(m.out, "  ✅ 新增: %d 个文件\n", addedCount)
+	fmt.Fprintf(m.out, "  🔄 修改: %d 个文件\n", modifiedCount)
+	fmt.Fprintf(m.out, "  ❌ 删除: %d 个文件\n", deletedCount)
+	if unchangedCount > 0 {
+		fmt.Fprintf(m.out, "  ⏸  未变更: %d 个文件\n", unchangedCount)
+	}
+	fmt.Fprintln(m.out, strings.Repeat("-", 60))
 
 	// Show detailed file changes
-	if len(fileChanges) > 0 {
-		fmt.Println("\n详细变更列表 (Detailed Changes):")
+	if len(fileChanges) > unchangedCount {
+		fmt.Fprintln(m.out, "\n详细变更列表 (Detailed Changes):")
 		for _, change := range fileChanges {
+			if change.ChangeType == models.ChangeTypeUnchanged {
+				continue
+			}
 			var icon string
 			switch change.ChangeType {
 			case models.ChangeTypeAdded:
@@ -82,405 +176,61 @@ func (m *Manager) recordSyncHistory(repo *models.Repository, fileChanges []model
 			case models.ChangeTypeDeleted:
 				icon = "❌"
 			}
-			fmt.Printf("  %s %s\n", icon, change.Path)
+			fmt.Fprintf(m.out, "  %s %s\n", icon, change.Path)
 		}
 	}
-	fmt.Println(strings.Repeat("=", 60) + "\n")
+	fmt.Fprintln(m.out, strings.Repeat("=", 60)+"\n")
 
 	// Create history entry
 	duration := time.Since(startTime).Milliseconds()
 	history := models.SyncHistory{
-		Repository:    repo.Name,
-		Branch:        repo.Branch,
-		Timestamp:     time.Now(),
-		Success:       success,
-		Error:         errMsg,
-		FileChanges:   fileChanges,
-		TotalFiles:    len(fileChanges),
-		AddedCount:    addedCount,
-		ModifiedCount: modifiedCount,
-		DeletedCount:  deletedCount,
-		Duration:      duration,
+		Repository:     repo.Name,
+		Branch:         repo.Branch,
+		Ref:            repo.Ref,
+		Commit:         source.commit,
+		CloneStrategy:  source.strategy,
+		Timestamp:      time.Now(),
+		Success:        outcome.success,
+		Error:          outcome.err,
+		RolledBack:     outcome.rolledBack,
+		Cancelled:      outcome.cancelled,
+		Backup:         outcome.backup,
+		PreviousCommit: outcome.previousCommit,
+		UndoOf:         outcome.undoOf,
+		FileChanges:    fileChanges,
+		TotalFiles:     len(fileChanges),
+		AddedCount:     addedCount,
+		ModifiedCount:  modifiedCount,
+		DeletedCount:   deletedCount,
+		UnchangedCount: unchangedCount,
+		Duration:       duration,
 	}
 
 	// Save history
 	if err := AddHistory(history); err != nil {
-		fmt.Printf("Warning: failed to save sync history: %v\n", err)
+		fmt.Fprintf(m.out, "Warning: failed to save sync history: %v\n", err)
 	}
 }
 
 // SyncRepository synchronizes a repository (following IntelliJ plugin logic)
-// 1. Clone remote repository to temp directory
+// 1. Clone remote repository (or extract from the mirror cache) to temp directory
 // 2. Checkout specified branch
 // 3. Scan files and show interactive selection
 // 4. Copy selected files from sourceDirectory to targetDirectory
 // 5. Apply file patterns filtering
 // 6. Execute post-sync commands
-func (m *Manager) SyncRepository(repo *models.Repository) error {
-	repo.Status = models.StatusSyncing
-
-	// Create temp directory for cloning
-	tempDir, err := os.MkdirTemp("", "stack-sync-*")
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Clone repository to temp directory
-	fmt.Printf("Cloning %s @ %s to temp directory...\n", repo.URL, repo.Branch)
-	ops, err := git.Clone(repo, tempDir)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to clone repository: %w", err)
-	}
-
-	// Checkout specified branch
-	if repo.Branch != "" && repo.Branch != "main" && repo.Branch != "master" {
-		fmt.Printf("Checking out branch: %s\n", repo.Branch)
-		if err := ops.CheckoutBranch(repo.Branch); err != nil {
-			repo.Status = models.StatusError
-			return fmt.Errorf("failed to checkout branch %s: %w", repo.Branch, err)
-		}
-	}
-
-	// Backup if enabled
-	if repo.BackupConfig != nil && repo.BackupConfig.Enabled && m.directoryExists(repo.TargetDirectory) {
-		if err := m.BackupRepository(repo); err != nil {
-			fmt.Printf("Warning: backup failed: %v\n", err)
-		}
-	}
-
-	// Determine source path
-	sourcePath := tempDir
-	if repo.SourceDirectory != "" {
-		sourcePath = filepath.Join(tempDir, repo.SourceDirectory)
-	}
-
-	// Check if source directory exists
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		repo.Status = models.StatusError
-		return fmt.Errorf("source directory does not exist: %s", repo.SourceDirectory)
-	}
-
-	// Ensure target directory exists
-	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create target directory: %w", err)
-	}
-
-	// Scan files and show interactive selection
-	fmt.Printf("Scanning files in %s...\n", sourcePath)
-	availableFiles, err := m.scanFiles(sourcePath, repo.FilePatterns, repo.ExcludePatterns)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to scan files: %w", err)
-	}
-
-	if len(availableFiles) == 0 {
-		fmt.Printf("No files found matching patterns: %v\n", repo.FilePatterns)
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Show interactive file selection
-	fmt.Printf("Found %d files to sync:\n", len(availableFiles))
-	selectedFiles, err := m.selectFilesToSync(availableFiles, sourcePath)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("file selection cancelled: %w", err)
-	}
-
-	if len(selectedFiles) == 0 {
-		fmt.Printf("No files selected for sync\n")
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Copy selected files from source to target
-	fmt.Printf("Syncing %d selected files from %s to %s...\n", len(selectedFiles), sourcePath, repo.TargetDirectory)
-	startTime := time.Now()
-	copiedFiles, fileChanges, err := m.copySelectedFiles(sourcePath, repo.TargetDirectory, selectedFiles)
-	if err != nil {
-		repo.Status = models.StatusError
-		// Record failed sync
-		m.recordSyncHistory(repo, []models.FileChange{}, startTime, false, err.Error())
-		return fmt.Errorf("failed to copy files: %w", err)
-	}
-
-	fmt.Printf("Synced %d files\n", copiedFiles)
-
-	// Update status
-	repo.Status = models.StatusUpToDate
-	now := time.Now()
-	repo.LastSync = &now
-	repo.FilesTracked = copiedFiles
-
-	// Record sync history
-	m.recordSyncHistory(repo, fileChanges, startTime, true, "")
-
-	// Execute post-sync commands
-	if len(repo.PostSyncCommands) > 0 {
-		if err := m.executePostSyncCommands(repo); err != nil {
-			fmt.Printf("Warning: post-sync command failed: %v\n", err)
-		}
-	}
-
-	return nil
+func (m *Manager) SyncRepository(ctx context.Context, repo *models.Repository) (*SyncResult, error) {
+	return m.SyncRepositoryWith(ctx, repo, InteractiveSelector{})
 }
 
 // SyncRepositoryWithFilter synchronizes a repository with a pre-filter keyword
-func (m *Manager) SyncRepositoryWithFilter(repo *models.Repository, filterKeyword string) error {
-	repo.Status = models.StatusSyncing
-
-	// Create temp directory for cloning
-	tempDir, err := os.MkdirTemp("", "stack-sync-*")
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Clone repository to temp directory
-	fmt.Printf("Cloning %s @ %s to temp directory...\n", repo.URL, repo.Branch)
-	ops, err := git.Clone(repo, tempDir)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to clone repository: %w", err)
-	}
-
-	// Checkout specified branch
-	if repo.Branch != "" && repo.Branch != "main" && repo.Branch != "master" {
-		fmt.Printf("Checking out branch: %s\n", repo.Branch)
-		if err := ops.CheckoutBranch(repo.Branch); err != nil {
-			repo.Status = models.StatusError
-			return fmt.Errorf("failed to checkout branch %s: %w", repo.Branch, err)
-		}
-	}
-
-	// Backup if enabled
-	if repo.BackupConfig != nil && repo.BackupConfig.Enabled && m.directoryExists(repo.TargetDirectory) {
-		if err := m.BackupRepository(repo); err != nil {
-			fmt.Printf("Warning: backup failed: %v\n", err)
-		}
-	}
-
-	// Determine source path
-	sourcePath := tempDir
-	if repo.SourceDirectory != "" {
-		sourcePath = filepath.Join(tempDir, repo.SourceDirectory)
-	}
-
-	// Check if source directory exists
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		repo.Status = models.StatusError
-		return fmt.Errorf("source directory does not exist: %s", repo.SourceDirectory)
-	}
-
-	// Ensure target directory exists
-	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create target directory: %w", err)
-	}
-
-	// Scan files and show interactive selection
-	fmt.Printf("Scanning files in %s...\n", sourcePath)
-	availableFiles, err := m.scanFiles(sourcePath, repo.FilePatterns, repo.ExcludePatterns)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to scan files: %w", err)
-	}
-
-	if len(availableFiles) == 0 {
-		fmt.Printf("No files found matching patterns: %v\n", repo.FilePatterns)
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Show interactive file selection
-	fmt.Printf("Found %d files to sync:\n", len(availableFiles))
-
-	// Apply pre-filter if provided, but still allow full interactive selection
-	if filterKeyword != "" {
-		filteredFiles := m.preFilterFilesByKeyword(availableFiles, filterKeyword)
-		if len(filteredFiles) == 0 {
-			fmt.Printf("No files found matching filter keyword: %s\n", filterKeyword)
-			repo.Status = models.StatusUpToDate
-			return nil
-		}
-		fmt.Printf("Pre-filtered to %d files matching '%s'\n", len(filteredFiles), filterKeyword)
-		fmt.Println("You can still use interactive selection modes (keyboard, number, etc.)")
-		availableFiles = filteredFiles
-	}
-
-	selectedFiles, err := m.selectFilesToSync(availableFiles, sourcePath)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("file selection cancelled: %w", err)
-	}
-
-	if len(selectedFiles) == 0 {
-		fmt.Printf("No files selected for sync\n")
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Copy selected files from source to target
-	fmt.Printf("Syncing %d selected files from %s to %s...\n", len(selectedFiles), sourcePath, repo.TargetDirectory)
-	startTime := time.Now()
-	copiedFiles, fileChanges, err := m.copySelectedFiles(sourcePath, repo.TargetDirectory, selectedFiles)
-	if err != nil {
-		repo.Status = models.StatusError
-		// Record failed sync
-		m.recordSyncHistory(repo, []models.FileChange{}, startTime, false, err.Error())
-		return fmt.Errorf("failed to copy files: %w", err)
-	}
-
-	fmt.Printf("Synced %d files\n", copiedFiles)
-
-	// Update status
-	repo.Status = models.StatusUpToDate
-	now := time.Now()
-	repo.LastSync = &now
-	repo.FilesTracked = copiedFiles
-
-	// Record sync history
-	m.recordSyncHistory(repo, fileChanges, startTime, true, "")
-
-	// Execute post-sync commands
-	if len(repo.PostSyncCommands) > 0 {
-		if err := m.executePostSyncCommands(repo); err != nil {
-			fmt.Printf("Warning: post-sync command failed: %v\n", err)
-		}
-	}
-
-	return nil
+func (m *Manager) SyncRepositoryWithFilter(ctx context.Context, repo *models.Repository, filterKeyword string) (*SyncResult, error) {
+	return m.SyncRepositoryWith(ctx, repo, InteractiveSelector{Keyword: filterKeyword})
 }
 
 // SyncRepositoryWithNumberSelection synchronizes a repository with pre-selected file numbers
-func (m *Manager) SyncRepositoryWithNumberSelection(repo *models.Repository, filterKeyword, numberSelection string) error {
-	repo.Status = models.StatusSyncing
-
-	// Create temp directory for cloning
-	tempDir, err := os.MkdirTemp("", "stack-sync-*")
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Clone repository to temp directory
-	fmt.Printf("Cloning %s @ %s to temp directory...\n", repo.URL, repo.Branch)
-	ops, err := git.Clone(repo, tempDir)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to clone repository: %w", err)
-	}
-
-	// Checkout specified branch
-	if repo.Branch != "" && repo.Branch != "main" && repo.Branch != "master" {
-		fmt.Printf("Checking out branch: %s\n", repo.Branch)
-		if err := ops.CheckoutBranch(repo.Branch); err != nil {
-			repo.Status = models.StatusError
-			return fmt.Errorf("failed to checkout branch %s: %w", repo.Branch, err)
-		}
-	}
-
-	// Backup if enabled
-	if repo.BackupConfig != nil && repo.BackupConfig.Enabled && m.directoryExists(repo.TargetDirectory) {
-		if err := m.BackupRepository(repo); err != nil {
-			fmt.Printf("Warning: backup failed: %v\n", err)
-		}
-	}
-
-	// Determine source path
-	sourcePath := tempDir
-	if repo.SourceDirectory != "" {
-		sourcePath = filepath.Join(tempDir, repo.SourceDirectory)
-	}
-
-	// Check if source directory exists
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		repo.Status = models.StatusError
-		return fmt.Errorf("source directory does not exist: %s", repo.SourceDirectory)
-	}
-
-	// Ensure target directory exists
-	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create target directory: %w", err)
-	}
-
-	// Scan files
-	fmt.Printf("Scanning files in %s...\n", sourcePath)
-	availableFiles, err := m.scanFiles(sourcePath, repo.FilePatterns, repo.ExcludePatterns)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to scan files: %w", err)
-	}
-
-	if len(availableFiles) == 0 {
-		fmt.Printf("No files found matching patterns: %v\n", repo.FilePatterns)
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Apply pre-filter if provided
-	if filterKeyword != "" {
-		filteredFiles := m.preFilterFilesByKeyword(availableFiles, filterKeyword)
-		if len(filteredFiles) == 0 {
-			fmt.Printf("No files found matching filter keyword: %s\n", filterKeyword)
-			repo.Status = models.StatusUpToDate
-			return nil
-		}
-		fmt.Printf("Pre-filtered to %d files matching '%s'\n", len(filteredFiles), filterKeyword)
-		availableFiles = filteredFiles
-	}
-
-	// Show files and auto-select using number selection
-	fmt.Printf("Found %d files to sync:\n", len(availableFiles))
-	selectedFiles, err := m.selectFilesWithNumberSelection(availableFiles, sourcePath, numberSelection)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("file selection failed: %w", err)
-	}
-
-	if len(selectedFiles) == 0 {
-		fmt.Printf("No files selected for sync\n")
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Copy selected files from source to target
-	fmt.Printf("Syncing %d selected files from %s to %s...\n", len(selectedFiles), sourcePath, repo.TargetDirectory)
-	startTime := time.Now()
-	copiedFiles, fileChanges, err := m.copySelectedFiles(sourcePath, repo.TargetDirectory, selectedFiles)
-	if err != nil {
-		repo.Status = models.StatusError
-		// Record failed sync
-		m.recordSyncHistory(repo, []models.FileChange{}, startTime, false, err.Error())
-		return fmt.Errorf("failed to copy files: %w", err)
-	}
-
-	fmt.Printf("Synced %d files\n", copiedFiles)
-
-	// Update status
-	repo.Status = models.StatusUpToDate
-	now := time.Now()
-	repo.LastSync = &now
-	repo.FilesTracked = copiedFiles
-
-	// Record sync history
-	m.recordSyncHistory(repo, fileChanges, startTime, true, "")
-
-	// Execute post-sync commands
-	if len(repo.PostSyncCommands) > 0 {
-		if err := m.executePostSyncCommands(repo); err != nil {
-			fmt.Printf("Warning: post-sync command failed: %v\n", err)
-		}
-	}
-
-	return nil
+func (m *Manager) SyncRepositoryWithNumberSelection(ctx context.Context, repo *models.Repository, filterKeyword, numberSelection string) (*SyncResult, error) {
+	return m.SyncRepositoryWith(ctx, repo, NumberSelector{Keyword: filterKeyword, Selection: numberSelection})
 }
 
 // selectFilesWithNumberSelection shows files and automatically selects using number selection
@@ -489,15 +239,15 @@ func (m *Manager) selectFilesWithNumberSelection(availableFiles []string, source
 		return []string{}, nil
 	}
 
-	fmt.Printf("\n📁 %s\n", m.i18n.T(i18n.MsgAvailableFilesToSync))
-	fmt.Println("────────────────────────────────────────")
+	fmt.Fprintf(m.out, "\n📁 %s\n", m.i18n.T(i18n.MsgAvailableFilesToSync))
+	fmt.Fprintln(m.out, "────────────────────────────────────────")
 
 	// Show all files
 	for i, file := range availableFiles {
-		fmt.Printf("  %d. %s\n", i+1, file)
+		fmt.Fprintf(m.out, "  %d. %s\n", i+1, file)
 	}
 
-	fmt.Printf("\n🔢 Auto-selecting files using: %s\n", numberSelection)
+	fmt.Fprintf(m.out, "\n🔢 Auto-selecting files using: %s\n", numberSelection)
 
 	// Parse the number selection
 	selectedFiles, err := m.parseFileSelection(numberSelection, availableFiles)
@@ -505,9 +255,9 @@ func (m *Manager) selectFilesWithNumberSelection(availableFiles []string, source
 		return nil, fmt.Errorf("invalid number selection '%s': %w", numberSelection, err)
 	}
 
-	fmt.Printf("Selected %d files:\n", len(selectedFiles))
+	fmt.Fprintf(m.out, "Selected %d files:\n", len(selectedFiles))
 	for _, file := range selectedFiles {
-		fmt.Printf("  ✓ %s\n", file)
+		fmt.Fprintf(m.out, "  ✓ %s\n", file)
 	}
 
 	return selectedFiles, nil
@@ -663,8 +413,12 @@ func (m *Manager) shouldExclude(path string, excludes []string) bool {
 	return false
 }
 
+// hookWaitDelay is how long a killed post-sync command may keep its output
+// open, e.g. through background children, before it is abandoned
+const hookWaitDelay = 5 * time.Second
+
 // executePostSyncCommands executes post-sync commands in order
-func (m *Manager) executePostSyncCommands(repo *models.Repository) error {
+func (m *Manager) executePostSyncCommands(ctx context.Context, repo *models.Repository) error {
 	// Sort commands by order
 	commands := make([]models.PostSyncCommand, len(repo.PostSyncCommands))
 	copy(commands, repo.PostSyncCommands)
@@ -672,85 +426,70 @@ func (m *Manager) executePostSyncCommands(repo *models.Repository) error {
 		return commands[i].Order < commands[j].Order
 	})
 
-	fmt.Printf("Executing %d post-sync commands...\n", len(commands))
+	fmt.Fprintf(m.out, "Executing %d post-sync commands...\n", len(commands))
 
 	for i, cmd := range commands {
-		fmt.Printf("[%d/%d] Running: cd %s && %s\n", i+1, len(commands), cmd.Directory, cmd.Command)
+		fmt.Fprintf(m.out, "[%d/%d] Running: cd %s && %s\n", i+1, len(commands), cmd.Directory, cmd.Command)
 
-		// Create command - use shell to properly handle complex commands
-		execCmd := exec.Command("sh", "-c", cmd.Command)
+		// Create command - use shell to properly handle complex commands.
+		// It is killed when the sync is cancelled or the hook timeout expires.
+		hookCtx, cancel := withTimeout(ctx, repo.HookTimeout)
+		execCmd := exec.CommandContext(hookCtx, "sh", "-c", cmd.Command)
 		execCmd.Dir = cmd.Directory
-		execCmd.Stdout = os.Stdout
-		execCmd.Stderr = os.Stderr
+		execCmd.Stdout = m.out
+		execCmd.Stderr = m.errOut()
+		execCmd.WaitDelay = hookWaitDelay
 
 		// Execute command
-		if err := execCmd.Run(); err != nil {
+		err := execCmd.Run()
+		timedOut := errors.Is(hookCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if err != nil {
+			if timedOut && ctx.Err() == nil {
+				return fmt.Errorf("command timed out after %s: %s", repo.HookTimeout, cmd.Command)
+			}
 			return fmt.Errorf("command failed: %s: %w", cmd.Command, err)
 		}
 
-		fmt.Printf("[%d/%d] Completed: cd %s && %s\n", i+1, len(commands), cmd.Directory, cmd.Command)
+		fmt.Fprintf(m.out, "[%d/%d] Completed: cd %s && %s\n", i+1, len(commands), cmd.Directory, cmd.Command)
 	}
 
 	return nil
 }
 
-// BackupRepository creates a backup of the target directory
-func (m *Manager) BackupRepository(repo *models.Repository) error {
-	if !m.config.Settings.BackupEnabled {
+// prepareTarget makes sure the target directory exists. Backups are taken
+// later, once the changeset knows which files it will overwrite or delete.
+// In dry-run mode nothing is touched.
+func (m *Manager) prepareTarget(repo *models.Repository) error {
+	if m.dryRun {
 		return nil
 	}
 
-	// Create backup directory
-	backupDir := filepath.Join(
-		m.config.Settings.BackupDir,
-		repo.Name,
-		time.Now().Format("20060102-150405"),
-	)
-
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %w", err)
+	// Ensure target directory exists
+	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
-	fmt.Printf("Creating backup: %s\n", backupDir)
-
-	// Copy target directory to backup
-	_, err := m.copyFiles(repo.TargetDirectory, backupDir, []string{"*"}, []string{})
-	return err
+	return nil
 }
 
-// UpdateRepositoryStatus updates the status of a repository
-func (m *Manager) UpdateRepositoryStatus(repo *models.Repository) error {
-	// Check if target directory exists
-	if _, err := os.Stat(repo.TargetDirectory); os.IsNotExist(err) {
-		repo.Status = models.StatusNotCloned
+// BackupRepository captures every file currently in the target directory
+func (m *Manager) BackupRepository(repo *models.Repository) error {
+	if !m.config.Settings.BackupEnabled || !m.directoryExists(repo.TargetDirectory) {
 		return nil
 	}
 
-	// For now, assume up to date if target exists
-	// TODO: Compare with remote to detect changes
-	repo.Status = models.StatusUpToDate
-
-	// Count files in target directory
-	fileCount := 0
-	filepath.Walk(repo.TargetDirectory, func(path string, info os.FileInfo, err error) error {
-		if err == nil && !info.IsDir() {
-			fileCount++
-		}
-		return nil
-	})
-	repo.FilesTracked = fileCount
-
-	return nil
-}
+	files, err := m.scanFiles(context.Background(), repo.TargetDirectory, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to scan target directory: %w", err)
+	}
 
-// UpdateAllStatuses updates the status of all repositories
-func (m *Manager) UpdateAllStatuses() error {
-	for i := range m.config.Repositories {
-		if err := m.UpdateRepositoryStatus(&m.config.Repositories[i]); err != nil {
-			fmt.Printf("Warning: failed to update status for %s: %v\n",
-				m.config.Repositories[i].Name, err)
-		}
+	backup, err := m.createBackup(repo, files)
+	if err != nil {
+		return err
 	}
+
+	fmt.Fprintf(m.out, "Created backup %s (%d files, %s)\n", backup.Name, backup.Files, backup.Path)
 	return nil
 }
 
@@ -767,6 +506,19 @@ func (m *Manager) GetRepositoryInfo(repo *models.Repository) (map[string]interfa
 		"exclude_patterns": repo.ExcludePatterns,
 		"last_sync":        repo.LastSync,
 		"files_tracked":    repo.FilesTracked,
+		"files_modified":   repo.FilesModified,
+	}
+
+	if repo.SyncedCommit != "" {
+		info["synced_commit"] = shortHash(repo.SyncedCommit)
+	}
+	switch {
+	case repo.RemoteCommit != "" && repo.RemoteSource == RemoteSourceCache:
+		info["remote_commit"] = shortHash(repo.RemoteCommit) + " (cached mirror)"
+	case repo.RemoteCommit != "":
+		info["remote_commit"] = shortHash(repo.RemoteCommit)
+	case m.offline && repo.SyncedCommit != "":
+		info["remote_commit"] = "unknown (offline, no cached mirror)"
 	}
 
 	if repo.AutoSync != nil && repo.AutoSync.Enabled {
@@ -789,14 +541,18 @@ func (m *Manager) directoryExists(path string) bool {
 	return info.IsDir()
 }
 
-// scanFiles scans the source directory and returns all files matching the patterns
-func (m *Manager) scanFiles(sourcePath string, patterns, excludes []string) ([]string, error) {
+// scanFiles scans the source directory and returns all files matching the patterns.
+// The walk stops early when ctx is cancelled.
+func (m *Manager) scanFiles(ctx context.Context, sourcePath string, patterns, excludes []string) ([]string, error) {
 	var files []string
 
 	err := filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// Skip .git directory
 		if info.IsDir() && info.Name() == ".git" {
@@ -814,6 +570,14 @@ func (m *Manager) scanFiles(sourcePath string, patterns, excludes []string) ([]s
 			return nil
 		}
 
+		// Skip staging directories of an apply in progress or interrupted
+		if isStageDir(relPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// Check if file should be excluded
 		if m.shouldExclude(relPath, excludes) {
 			if info.IsDir() {
@@ -839,23 +603,28 @@ func (m *Manager) selectFilesToSync(availableFiles []string, sourcePath string)
 		return []string{}, nil
 	}
 
-	fmt.Printf("\n📁 %s\n", m.i18n.T(i18n.MsgAvailableFilesToSync))
-	fmt.Println("────────────────────────────────────────")
+	if m.nonInteractive {
+		fmt.Fprintf(m.out, "Non-interactive mode: selecting all %d files\n", len(availableFiles))
+		return availableFiles, nil
+	}
+
+	fmt.Fprintf(m.out, "\n📁 %s\n", m.i18n.T(i18n.MsgAvailableFilesToSync))
+	fmt.Fprintln(m.out, "────────────────────────────────────────")
 
 	// Show all files - no limit for better user experience
 	for i, file := range availableFiles {
-		fmt.Printf("  %d. %s\n", i+1, file)
+		fmt.Fprintf(m.out, "  %d. %s\n", i+1, file)
 	}
 
-	fmt.Printf("\n%s\n", m.i18n.T(i18n.MsgSelectionModes))
-	fmt.Printf("  %s\n", m.i18n.T(i18n.MsgKeyboardMode))
-	fmt.Printf("  %s\n", m.i18n.T(i18n.MsgNumberMode))
-	fmt.Printf("  %s\n", m.i18n.T(i18n.MsgSelectAllFiles))
-	fmt.Printf("  %s\n", m.i18n.T(i18n.MsgFilterByKeyword))
-	fmt.Printf("  %s\n", m.i18n.T(i18n.MsgCancel))
-	fmt.Println("  [Enter] - Select all files")
+	fmt.Fprintf(m.out, "\n%s\n", m.i18n.T(i18n.MsgSelectionModes))
+	fmt.Fprintf(m.out, "  %s\n", m.i18n.T(i18n.MsgKeyboardMode))
+	fmt.Fprintf(m.out, "  %s\n", m.i18n.T(i18n.MsgNumberMode))
+	fmt.Fprintf(m.out, "  %s\n", m.i18n.T(i18n.MsgSelectAllFiles))
+	fmt.Fprintf(m.out, "  %s\n", m.i18n.T(i18n.MsgFilterByKeyword))
+	fmt.Fprintf(m.out, "  %s\n", m.i18n.T(i18n.MsgCancel))
+	fmt.Fprintln(m.out, "  [Enter] - Select all files")
 
-	fmt.Printf("\n%s ", m.i18n.T(i18n.MsgChooseSelectionMode))
+	fmt.Fprintf(m.out, "\n%s ", m.i18n.T(i18n.MsgChooseSelectionMode))
 	var input string
 	fmt.Scanln(&input)
 
@@ -887,22 +656,22 @@ func (m *Manager) selectFilesToSync(availableFiles []string, sourcePath string)
 			return selectedFiles, nil
 		}
 		// Invalid input, select all by default
-		fmt.Printf("Invalid input '%s', selecting all files by default\n", input)
+		fmt.Fprintf(m.out, "Invalid input '%s', selecting all files by default\n", input)
 		return availableFiles, nil
 	}
 }
 
 // selectFilesWithNumbers handles number-based file selection
 func (m *Manager) selectFilesWithNumbers(availableFiles []string) ([]string, error) {
-	fmt.Println("\nNumber selection options:")
-	fmt.Println("  [1-9] - Select specific file by number")
-	fmt.Println("  [1,3,5] - Select multiple files (comma-separated)")
-	fmt.Println("  [1-5] - Select range of files")
-	fmt.Println("  [a] - Select all files")
-	fmt.Println("  [n] - Select none (cancel)")
-	fmt.Println("  [Enter] - Select all files")
-
-	fmt.Print("\nEnter your choice: ")
+	fmt.Fprintln(m.out, "\nNumber selection options:")
+	fmt.Fprintln(m.out, "  [1-9] - Select specific file by number")
+	fmt.Fprintln(m.out, "  [1,3,5] - Select multiple files (comma-separated)")
+	fmt.Fprintln(m.out, "  [1-5] - Select range of files")
+	fmt.Fprintln(m.out, "  [a] - Select all files")
+	fmt.Fprintln(m.out, "  [n] - Select none (cancel)")
+	fmt.Fprintln(m.out, "  [Enter] - Select all files")
+
+	fmt.Fprint(m.out, "\nEnter your choice: ")
 	var input string
 	fmt.Scanln(&input)
 
@@ -926,7 +695,7 @@ func (m *Manager) selectFilesWithNumbers(availableFiles []string) ([]string, err
 		return []string{}, nil
 	default:
 		// Invalid input, select all by default
-		fmt.Printf("Invalid input '%s', selecting all files by default\n", input)
+		fmt.Fprintf(m.out, "Invalid input '%s', selecting all files by default\n", input)
 		return availableFiles, nil
 	}
 }
@@ -1011,7 +780,7 @@ func (m *Manager) parseFileSelection(input string, availableFiles []string) ([]s
 
 // filterFilesByKeyword allows user to filter files by keyword
 func (m *Manager) filterFilesByKeyword(availableFiles []string) ([]string, error) {
-	fmt.Print("Enter keyword to filter files: ")
+	fmt.Fprint(m.out, "Enter keyword to filter files: ")
 	var keyword string
 	fmt.Scanln(&keyword)
 
@@ -1028,17 +797,17 @@ func (m *Manager) filterFilesByKeyword(availableFiles []string) ([]string, error
 		}
 	}
 
-	fmt.Printf("Found %d files matching '%s':\n", len(filteredFiles), keyword)
+	fmt.Fprintf(m.out, "Found %d files matching '%s':\n", len(filteredFiles), keyword)
 	for i, file := range filteredFiles {
-		fmt.Printf("  %d. %s\n", i+1, file)
+		fmt.Fprintf(m.out, "  %d. %s\n", i+1, file)
 	}
 
 	if len(filteredFiles) == 0 {
-		fmt.Println("No files match the keyword. Returning to main selection.")
+		fmt.Fprintln(m.out, "No files match the keyword. Returning to main selection.")
 		return m.selectFilesToSync(availableFiles, "")
 	}
 
-	fmt.Print("Sync these filtered files? [y/N]: ")
+	fmt.Fprint(m.out, "Sync these filtered files? [y/N]: ")
 	var confirm string
 	fmt.Scanln(&confirm)
 
@@ -1050,121 +819,6 @@ func (m *Manager) filterFilesByKeyword(availableFiles []string) ([]string, error
 	return m.selectFilesToSync(availableFiles, "")
 }
 
-// copySelectedFiles copies only the selected files from source to target
-// Returns the number of files copied and a list of file changes
-func (m *Manager) copySelectedFiles(sourcePath, targetPath string, selectedFiles []string) (int, []models.FileChange, error) {
-	var fileChanges []models.FileChange
-
-	for _, relPath := range selectedFiles {
-		srcPath := filepath.Join(sourcePath, relPath)
-		dstPath := filepath.Join(targetPath, relPath)
-
-		// Check if destination file exists to determine change type
-		var changeType models.FileChangeType
-		dstInfo, err := os.Stat(dstPath)
-		if os.IsNotExist(err) {
-			changeType = models.ChangeTypeAdded
-		} else {
-			// File exists, check if it's modified by comparing modification time or size
-			srcInfo, err := os.Stat(srcPath)
-			if err != nil {
-				return len(fileChanges), fileChanges, fmt.Errorf("failed to stat source file %s: %w", relPath, err)
-			}
-			
-			// Compare modification time and size to determine if modified
-			if srcInfo.ModTime().After(dstInfo.ModTime()) || srcInfo.Size() != dstInfo.Size() {
-				changeType = models.ChangeTypeModified
-			} else {
-				changeType = models.ChangeTypeModified // Still mark as modified even if same, since we're syncing
-			}
-		}
-
-		// Create destination directory
-		dstDir := filepath.Dir(dstPath)
-		if err := os.MkdirAll(dstDir, 0755); err != nil {
-			return len(fileChanges), fileChanges, fmt.Errorf("failed to create directory %s: %w", dstDir, err)
-		}
-
-		// Get source file size
-		srcInfo, err := os.Stat(srcPath)
-		if err != nil {
-			return len(fileChanges), fileChanges, fmt.Errorf("failed to stat source file %s: %w", relPath, err)
-		}
-
-		// Copy file
-		if err := m.copyFile(srcPath, dstPath); err != nil {
-			return len(fileChanges), fileChanges, fmt.Errorf("failed to copy %s: %w", relPath, err)
-		}
-
-		// Record file change
-		fileChanges = append(fileChanges, models.FileChange{
-			Path:      relPath,
-			ChangeType: changeType,
-			Size:      srcInfo.Size(),
-		})
-	}
-
-	return len(fileChanges), fileChanges, nil
-}
-
-// applyDiffSelections applies selected diff entries (including deletions) to target
-func (m *Manager) applyDiffSelections(sourcePath, targetPath string, entries []diffEntry) ([]models.FileChange, error) {
-	var changes []models.FileChange
-
-	for _, entry := range entries {
-		srcPath := filepath.Join(sourcePath, entry.Path)
-		dstPath := filepath.Join(targetPath, entry.Path)
-
-		switch entry.Status {
-		case "D":
-			// Delete target file
-			info, err := os.Stat(dstPath)
-			if err != nil && !os.IsNotExist(err) {
-				return changes, fmt.Errorf("failed to stat target file %s: %w", entry.Path, err)
-			}
-			if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
-				return changes, fmt.Errorf("failed to delete %s: %w", entry.Path, err)
-			}
-			var size int64
-			if info != nil {
-				size = info.Size()
-			}
-			changes = append(changes, models.FileChange{
-				Path:       entry.Path,
-				ChangeType: models.ChangeTypeDeleted,
-				Size:       size,
-			})
-		default:
-			// Added or Modified -> copy from source
-			srcInfo, err := os.Stat(srcPath)
-			if err != nil {
-				return changes, fmt.Errorf("failed to stat source file %s: %w", entry.Path, err)
-			}
-
-			if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-				return changes, fmt.Errorf("failed to create directory %s: %w", filepath.Dir(dstPath), err)
-			}
-
-			if err := m.copyFile(srcPath, dstPath); err != nil {
-				return changes, fmt.Errorf("failed to copy %s: %w", entry.Path, err)
-			}
-
-			changeType := models.ChangeTypeModified
-			if entry.Status == "A" {
-				changeType = models.ChangeTypeAdded
-			}
-
-			changes = append(changes, models.FileChange{
-				Path:       entry.Path,
-				ChangeType: changeType,
-				Size:       srcInfo.Size(),
-			})
-		}
-	}
-
-	return changes, nil
-}
-
 // selectFilesWithKeyboard provides an interactive keyboard-based file selection
 func (m *Manager) selectFilesWithKeyboard(availableFiles []string) ([]string, error) {
 	if len(availableFiles) == 0 {
@@ -1249,10 +903,10 @@ func (m *Manager) selectFilesWithKeyboard(availableFiles []string) ([]string, er
 // renderFileSelection renders the file selection interface with viewport
 func (m *Manager) renderFileSelection(availableFiles []string, selectedFiles map[int]bool, currentIndex int) {
 	// Clear screen
-	fmt.Print("\033[2J\033[H")
+	fmt.Fprint(m.out, "\033[2J\033[H")
 
-	fmt.Printf("📁 %s\n", m.i18n.T(i18n.MsgSelectFilesToSync))
-	fmt.Println("─────────────────────────────────────────────────────────────────────────────")
+	fmt.Fprintf(m.out, "📁 %s\n", m.i18n.T(i18n.MsgSelectFilesToSync))
+	fmt.Fprintln(m.out, "─────────────────────────────────────────────────────────────────────────────")
 
 	// Get terminal height (default to 24 if unable to detect)
 	terminalHeight := m.getTerminalHeight()
@@ -1293,21 +947,21 @@ func (m *Manager) renderFileSelection(availableFiles []string, selectedFiles map
 			status = "✓" // Show selected items
 		}
 
-		fmt.Printf("%s%s %s\n", prefix, status, availableFiles[i])
+		fmt.Fprintf(m.out, "%s%s %s\n", prefix, status, availableFiles[i])
 	}
 
 	// Show scroll indicator if there are more items
 	if len(availableFiles) > maxVisibleItems {
 		if startIndex > 0 {
-			fmt.Println("... ↑ more files above ↑ ...")
+			fmt.Fprintln(m.out, "... ↑ more files above ↑ ...")
 		}
 		if endIndex < len(availableFiles) {
-			fmt.Println("... ↓ more files below ↓ ...")
+			fmt.Fprintln(m.out, "... ↓ more files below ↓ ...")
 		}
 	}
 
-	fmt.Println("─────────────────────────────────────────────────────────────────────────────")
-	fmt.Println(m.i18n.T(i18n.MsgControls))
+	fmt.Fprintln(m.out, "─────────────────────────────────────────────────────────────────────────────")
+	fmt.Fprintln(m.out, m.i18n.T(i18n.MsgControls))
 
 	// Show selection count
 	selectedCount := 0
@@ -1316,7 +970,7 @@ func (m *Manager) renderFileSelection(availableFiles []string, selectedFiles map
 			selectedCount++
 		}
 	}
-	fmt.Printf("%s\n", m.i18n.T(i18n.MsgSelectedFiles, selectedCount, len(availableFiles)))
+	fmt.Fprintf(m.out, "%s\n", m.i18n.T(i18n.MsgSelectedFiles, selectedCount, len(availableFiles)))
 }
 
 // getTerminalHeight returns the terminal height, defaulting to 24 if unable to detect
@@ -1343,126 +997,32 @@ func (m *Manager) getTerminalHeight() int {
 }
 
 // SyncRepositoryWithDiff provides a visual diff preview before syncing
-func (m *Manager) SyncRepositoryWithDiff(repo *models.Repository) error {
-	repo.Status = models.StatusSyncing
-	startTime := time.Now()
-
-	// Create temp directory for cloning
-	tempDir, err := os.MkdirTemp("", "stack-sync-*")
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Clone repository to temp directory
-	fmt.Printf("Cloning %s @ %s to temp directory...\n", repo.URL, repo.Branch)
-	ops, err := git.Clone(repo, tempDir)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to clone repository: %w", err)
-	}
-
-	// Checkout specified branch
-	if repo.Branch != "" && repo.Branch != "main" && repo.Branch != "master" {
-		fmt.Printf("Checking out branch: %s\n", repo.Branch)
-		if err := ops.CheckoutBranch(repo.Branch); err != nil {
-			repo.Status = models.StatusError
-			return fmt.Errorf("failed to checkout branch %s: %w", repo.Branch, err)
-		}
-	}
+func (m *Manager) SyncRepositoryWithDiff(ctx context.Context, repo *models.Repository) (*SyncResult, error) {
+	return m.SyncRepositoryWith(ctx, repo, DiffSelector{})
+}
 
-	// Backup if enabled
-	if repo.BackupConfig != nil && repo.BackupConfig.Enabled && m.directoryExists(repo.TargetDirectory) {
-		if err := m.BackupRepository(repo); err != nil {
-			fmt.Printf("Warning: backup failed: %v\n", err)
+// getDiffEntries runs git diff --no-index to collect change list
+func (m *Manager) getDiffEntries(ctx context.Context, sourcePath, targetPath string, patterns, excludes []string) ([]PlanEntry, error) {
+	// git diff --no-index needs both sides; a missing target means every file is added
+	if !m.directoryExists(targetPath) {
+		files, err := m.scanFiles(ctx, sourcePath, patterns, excludes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan files: %w", err)
 		}
-	}
-
-	// Determine source path
-	sourcePath := tempDir
-	if repo.SourceDirectory != "" {
-		sourcePath = filepath.Join(tempDir, repo.SourceDirectory)
-	}
-
-	// Check if source directory exists
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		repo.Status = models.StatusError
-		return fmt.Errorf("source directory does not exist: %s", repo.SourceDirectory)
-	}
-
-	// Ensure target directory exists
-	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to create target directory: %w", err)
-	}
-
-	// Get diff entries
-	entries, err := m.getDiffEntries(sourcePath, repo.TargetDirectory, repo.FilePatterns, repo.ExcludePatterns)
-	if err != nil {
-		repo.Status = models.StatusError
-		return fmt.Errorf("failed to get diff: %w", err)
-	}
-
-	if len(entries) == 0 {
-		fmt.Println("No changes detected between remote and local. Up to date.")
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Interactive preview & selection
-	selectedEntries, cancelled, err := m.previewDiffAndSelect(entries, sourcePath, repo.TargetDirectory)
-	if err != nil {
-		repo.Status = models.StatusError
-		return err
-	}
-	if cancelled {
-		fmt.Println("Diff preview cancelled. No files were synced.")
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-	if len(selectedEntries) == 0 {
-		fmt.Println("No files selected after diff preview. Nothing to sync.")
-		repo.Status = models.StatusUpToDate
-		return nil
-	}
-
-	// Apply selections (copy / delete)
-	fileChanges, err := m.applyDiffSelections(sourcePath, repo.TargetDirectory, selectedEntries)
-	if err != nil {
-		repo.Status = models.StatusError
-		m.recordSyncHistory(repo, []models.FileChange{}, startTime, false, err.Error())
-		return fmt.Errorf("failed to apply selected changes: %w", err)
-	}
-
-	// Update status
-	repo.Status = models.StatusUpToDate
-	now := time.Now()
-	repo.LastSync = &now
-	repo.FilesTracked = len(fileChanges)
-
-	// Record sync history
-	m.recordSyncHistory(repo, fileChanges, startTime, true, "")
-
-	// Execute post-sync commands
-	if len(repo.PostSyncCommands) > 0 {
-		if err := m.executePostSyncCommands(repo); err != nil {
-			fmt.Printf("Warning: post-sync command failed: %v\n", err)
+		entries := make([]PlanEntry, 0, len(files))
+		for _, file := range files {
+			entries = append(entries, PlanEntry{Path: filepath.ToSlash(file), Status: "A"})
 		}
+		return entries, nil
 	}
 
-	return nil
-}
-
-// getDiffEntries runs git diff --no-index to collect change list
-func (m *Manager) getDiffEntries(sourcePath, targetPath string, patterns, excludes []string) ([]diffEntry, error) {
-	cmd := exec.Command("git", "diff", "--no-index", "--name-status", "--", targetPath, sourcePath)
+	cmd := exec.CommandContext(ctx, "git", "diff", "--no-index", "--name-status", "--", targetPath, sourcePath)
 	output, err := cmd.Output()
 	if err != nil && !strings.Contains(err.Error(), "exit status 1") { // exit 1 means diff found
 		return nil, fmt.Errorf("git diff failed: %w", err)
 	}
 
-	var entries []diffEntry
+	var entries []PlanEntry
 	seen := make(map[string]bool)
 	scanner := bufio.NewScanner(strings.NewReader(string(output)))
 	reTab := regexp.MustCompile(`\s+`)
@@ -1495,6 +1055,16 @@ func (m *Manager) getDiffEntries(sourcePath, targetPath string, patterns, exclud
 
 		relPath = filepath.ToSlash(relPath)
 
+		// The lockfile belongs to the target, never to the remote
+		if relPath == LockFileName {
+			continue
+		}
+
+		// Leftovers of an interrupted staged apply aren't synced files
+		if isStageDir(relPath) {
+			continue
+		}
+
 		// Filter by patterns/excludes
 		if m.shouldExclude(relPath, excludes) {
 			continue
@@ -1516,7 +1086,7 @@ func (m *Manager) getDiffEntries(sourcePath, targetPath string, patterns, exclud
 		}
 		seen[relPath] = true
 
-		entries = append(entries, diffEntry{
+		entries = append(entries, PlanEntry{
 			Path:   relPath,
 			Status: status,
 		})
@@ -1526,7 +1096,15 @@ func (m *Manager) getDiffEntries(sourcePath, targetPath string, patterns, exclud
 }
 
 // previewDiffAndSelect lets user browse diffs and choose files to sync
-func (m *Manager) previewDiffAndSelect(entries []diffEntry, sourcePath, targetPath string) ([]diffEntry, bool, error) {
+func (m *Manager) previewDiffAndSelect(entries []PlanEntry, sourcePath, targetPath string) ([]PlanEntry, bool, error) {
+	if m.nonInteractive {
+		for _, entry := range entries {
+			fmt.Fprintf(m.out, "  [%s] %s\n", entry.Status, entry.Path)
+		}
+		fmt.Fprintf(m.out, "Non-interactive mode: applying all %d changes\n", len(entries))
+		return entries, false, nil
+	}
+
 	selected := make(map[int]bool)
 	for i := range entries {
 		selected[i] = true // default select all
@@ -1535,10 +1113,10 @@ func (m *Manager) previewDiffAndSelect(entries []diffEntry, sourcePath, targetPa
 	reader := bufio.NewScanner(os.Stdin)
 
 	for {
-		fmt.Println()
-		fmt.Println(strings.Repeat("=", 80))
-		fmt.Println("📄  Diff Preview (v <n> 查看diff, t <n> 切换选择, a 全选, n 全不选, c 确认同步, q 取消)")
-		fmt.Println(strings.Repeat("-", 80))
+		fmt.Fprintln(m.out)
+		fmt.Fprintln(m.out, strings.Repeat("=", 80))
+		fmt.Fprintln(m.out, "📄  Diff Preview (v <n> 查看diff, t <n> 切换选择, a 全选, n 全不选, c 确认同步, q 取消)")
+		fmt.Fprintln(m.out, strings.Repeat("-", 80))
 
 		for i, entry := range entries {
 			mark := "[ ]"
@@ -1554,10 +1132,10 @@ func (m *Manager) previewDiffAndSelect(entries []diffEntry, sourcePath, targetPa
 				icon = "D"
 			}
 
-			fmt.Printf("%2d. %s %s %s\n", i+1, mark, icon, entry.Path)
+			fmt.Fprintf(m.out, "%2d. %s %s %s\n", i+1, mark, icon, entry.Path)
 		}
 
-		fmt.Print("\n指令 (v <编号> / t <编号> / a / n / c / q): ")
+		fmt.Fprint(m.out, "\n指令 (v <编号> / t <编号> / a / n / c / q): ")
 		if !reader.Scan() {
 			return nil, true, fmt.Errorf("failed to read input")
 		}
@@ -1572,26 +1150,26 @@ func (m *Manager) previewDiffAndSelect(entries []diffEntry, sourcePath, targetPa
 		switch cmd {
 		case "v":
 			if len(parts) < 2 {
-				fmt.Println("请输入要查看的编号，例如: v 3")
+				fmt.Fprintln(m.out, "请输入要查看的编号，例如: v 3")
 				continue
 			}
 			idx, err := strconv.Atoi(parts[1])
 			if err != nil || idx < 1 || idx > len(entries) {
-				fmt.Println("编号无效")
+				fmt.Fprintln(m.out, "编号无效")
 				continue
 			}
 			entry := entries[idx-1]
 			if err := m.showFileDiff(entry, sourcePath, targetPath); err != nil {
-				fmt.Printf("显示 diff 失败: %v\n", err)
+				fmt.Fprintf(m.out, "显示 diff 失败: %v\n", err)
 			}
 		case "t":
 			if len(parts) < 2 {
-				fmt.Println("请输入要切换的编号，例如: t 3")
+				fmt.Fprintln(m.out, "请输入要切换的编号，例如: t 3")
 				continue
 			}
 			idx, err := strconv.Atoi(parts[1])
 			if err != nil || idx < 1 || idx > len(entries) {
-				fmt.Println("编号无效")
+				fmt.Fprintln(m.out, "编号无效")
 				continue
 			}
 			selected[idx-1] = !selected[idx-1]
@@ -1604,7 +1182,7 @@ func (m *Manager) previewDiffAndSelect(entries []diffEntry, sourcePath, targetPa
 				selected[i] = false
 			}
 		case "c":
-			var result []diffEntry
+			var result []PlanEntry
 			for i, entry := range entries {
 				if selected[i] {
 					result = append(result, entry)
@@ -1614,13 +1192,13 @@ func (m *Manager) previewDiffAndSelect(entries []diffEntry, sourcePath, targetPa
 		case "q":
 			return nil, true, nil
 		default:
-			fmt.Println("未知指令，请使用 v/t/a/n/c/q")
+			fmt.Fprintln(m.out, "未知指令，请使用 v/t/a/n/c/q")
 		}
 	}
 }
 
 // showFileDiff renders a unified diff for a single file
-func (m *Manager) showFileDiff(entry diffEntry, sourcePath, targetPath string) error {
+func (m *Manager) showFileDiff(entry PlanEntry, sourcePath, targetPath string) error {
 	var left, right string
 
 	switch entry.Status {
@@ -1636,8 +1214,8 @@ func (m *Manager) showFileDiff(entry diffEntry, sourcePath, targetPath string) e
 	}
 
 	cmd := exec.Command("git", "diff", "--no-index", "--color=always", "--", left, right)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = m.out
+	cmd.Stderr = m.errOut()
 
 	// Ignore exit status 1 which indicates differences
 	if err := cmd.Run(); err != nil {
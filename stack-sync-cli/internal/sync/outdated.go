@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/git"
+	"github.com/stackfilesync/stack-sync-cli/internal/semver"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// OutdatedInfo compares a pinned repository against the tags on its remote
+type OutdatedInfo struct {
+	Repository string
+	Ref        string
+	Current    string // tag or commit of the last successful sync, "-" if never synced
+	Wanted     string // newest tag (or commit) the ref allows
+	Latest     string // newest release tag on the remote
+	Outdated   bool
+}
+
+// CheckOutdated reports whether the last sync of a pinned repository lags
+// behind the newest tags matching its ref
+func (m *Manager) CheckOutdated(ctx context.Context, repo *models.Repository) (*OutdatedInfo, error) {
+	if repo.Ref == "" {
+		return nil, fmt.Errorf("repository %s is not pinned to a ref", repo.Name)
+	}
+
+	tr, err := m.transport(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, repo.NetworkTimeout)
+	defer cancel()
+	refs, err := git.ListRemoteRefs(ctx, repo, tr)
+	if err != nil {
+		return nil, err
+	}
+
+	pin, err := git.ResolvePinFrom(repo.Ref, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve ref %s: %w", repo.Ref, err)
+	}
+
+	info := &OutdatedInfo{
+		Repository: repo.Name,
+		Ref:        repo.Ref,
+		Current:    "-",
+		Wanted:     pin.Name.Short(),
+		Latest:     "-",
+	}
+	if pin.Name == "" {
+		info.Wanted = pin.Ref
+	}
+
+	latest := semver.Latest(git.TagVersions(refs), nil)
+	if latest != nil {
+		info.Latest = latest.Original
+	}
+
+	// Find what the last successful sync actually used
+	var currentCommit string
+	histories, err := GetHistoryForRepository(repo.Name, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, history := range histories {
+		if history.Success && history.Commit != "" {
+			currentCommit = history.Commit
+			break
+		}
+	}
+
+	if currentCommit == "" {
+		info.Outdated = true
+		return info, nil
+	}
+
+	info.Current = currentCommit[:8]
+	currentTags := git.TagsForCommit(refs, currentCommit)
+	var currentVersion *semver.Version
+	for _, tag := range currentTags {
+		if v, err := semver.Parse(tag); err == nil && (currentVersion == nil || v.Compare(currentVersion) > 0) {
+			v.Original = tag
+			currentVersion = v
+		}
+	}
+	if currentVersion != nil {
+		info.Current = currentVersion.Original
+	} else if len(currentTags) > 0 {
+		info.Current = currentTags[0]
+	}
+
+	// Behind the pin itself: the ref now resolves to a different commit
+	if !pin.Hash.IsZero() && pin.Hash.String() != currentCommit {
+		info.Outdated = true
+	}
+
+	// Behind newer releases than the pin allows
+	if latest != nil {
+		if wanted, err := semver.Parse(info.Wanted); err == nil && wanted.Compare(latest) < 0 {
+			info.Outdated = true
+		} else if currentVersion != nil && currentVersion.Compare(latest) < 0 {
+			info.Outdated = true
+		}
+	}
+
+	return info, nil
+}
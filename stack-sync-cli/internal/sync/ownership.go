@@ -0,0 +1,194 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+var unsafeManifestChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// GetManifestPath returns the path of a repository's ownership manifest
+func GetManifestPath(repoName string) string {
+	name := unsafeManifestChars.ReplaceAllString(repoName, "_") + ".json"
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".stack-sync", "manifests", name)
+	}
+	return filepath.Join(homeDir, ".stack-sync", "manifests", name)
+}
+
+// LoadManifest loads a repository's ownership manifest. A missing manifest
+// is returned empty, without a target directory.
+func LoadManifest(repoName string) (*models.OwnershipManifest, error) {
+	manifestPath := GetManifestPath(repoName)
+
+	// If file doesn't exist, return empty manifest
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		return &models.OwnershipManifest{
+			Repository: repoName,
+			Files:      []string{},
+		}, nil
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest models.OwnershipManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+// SaveManifest writes a repository's ownership manifest
+func SaveManifest(manifest *models.OwnershipManifest) error {
+	manifestPath := GetManifestPath(manifest.Repository)
+
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	sort.Strings(manifest.Files)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// ownedFiles returns the target paths the repository owns. Without a manifest
+// for the current target directory, ownership is bootstrapped from the
+// lockfile and sync history.
+func (m *Manager) ownedFiles(repo *models.Repository) (map[string]bool, error) {
+	manifest, err := LoadManifest(repo.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.TargetDirectory != repo.TargetDirectory {
+		return m.syncedFiles(repo)
+	}
+
+	owned := make(map[string]bool, len(manifest.Files))
+	for _, path := range manifest.Files {
+		owned[path] = true
+	}
+	return owned, nil
+}
+
+// filterOwned drops entries that would clobber files the repository doesn't
+// own. Overwriting an unowned file with different content is a conflict;
+// identical files are adopted and unowned deletions are skipped.
+func (m *Manager) filterOwned(repo *models.Repository, sourcePath string, entries []PlanEntry) ([]PlanEntry, []string, error) {
+	if m.force {
+		return entries, nil, nil
+	}
+
+	owned, err := m.ownedFiles(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var allowed []PlanEntry
+	var conflicts []string
+	for _, entry := range entries {
+		path := filepath.ToSlash(entry.Path)
+		if entry.Status == "A" || entry.Status == "=" || owned[path] {
+			allowed = append(allowed, entry)
+			continue
+		}
+
+		if entry.Status == "D" {
+			fmt.Fprintf(m.out, "Keeping %s: not owned by %s\n", path, repo.Name)
+			continue
+		}
+
+		same, err := sameContent(filepath.Join(sourcePath, entry.Path), filepath.Join(repo.TargetDirectory, entry.Path))
+		if err != nil {
+			return nil, nil, err
+		}
+		if same {
+			allowed = append(allowed, entry)
+			continue
+		}
+		conflicts = append(conflicts, path)
+	}
+
+	return allowed, conflicts, nil
+}
+
+// updateManifest records the files a sync wrote and forgets the ones it deleted
+func (m *Manager) updateManifest(repo *models.Repository, fileChanges []models.FileChange) error {
+	owned, err := m.ownedFiles(repo)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range fileChanges {
+		path := filepath.ToSlash(change.Path)
+		if change.ChangeType == models.ChangeTypeDeleted {
+			delete(owned, path)
+		} else {
+			owned[path] = true
+		}
+	}
+
+	manifest := &models.OwnershipManifest{
+		Repository:      repo.Name,
+		TargetDirectory: repo.TargetDirectory,
+		Files:           make([]string, 0, len(owned)),
+		UpdatedAt:       time.Now(),
+	}
+	for path := range owned {
+		manifest.Files = append(manifest.Files, path)
+	}
+
+	return SaveManifest(manifest)
+}
+
+// reportConflicts prints the unowned files a sync left alone and the merges
+// that need manual resolution
+func (m *Manager) reportConflicts(repo *models.Repository, result *SyncResult) {
+	if len(result.Conflicts) > 0 {
+		fmt.Fprintf(m.out, "⚠ %d files in %s are not owned by %s and were not overwritten:\n", len(result.Conflicts), repo.TargetDirectory, repo.Name)
+		for _, path := range result.Conflicts {
+			fmt.Fprintf(m.out, "    [!] %s\n", path)
+		}
+		fmt.Fprintln(m.out, "  Use --force to take ownership of them")
+	}
+
+	for _, edit := range result.LocalEdits {
+		if edit.Conflicted {
+			fmt.Fprintf(m.out, "⚠ %s has merge conflicts, resolve the markers by hand\n", filepath.Join(repo.TargetDirectory, edit.Path))
+		}
+	}
+}
+
+// sameContent reports whether two files have identical content
+func sameContent(a, b string) (bool, error) {
+	dataA, err := os.ReadFile(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", a, err)
+	}
+	dataB, err := os.ReadFile(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", b, err)
+	}
+	return bytes.Equal(dataA, dataB), nil
+}
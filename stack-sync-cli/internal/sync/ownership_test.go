@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+func TestFilterOwned(t *testing.T) {
+	source, target := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"owned.proto":        "new",
+		"nested/owned.proto": "new",
+		"same.proto":         "shared",
+		"theirs.proto":       "upstream",
+		"added.proto":        "new",
+		"unchanged.proto":    "same",
+	})
+	writeFiles(t, target, map[string]string{
+		"owned.proto":        "old",
+		"nested/owned.proto": "old",
+		"same.proto":         "shared",
+		"theirs.proto":       "hand written",
+		"unchanged.proto":    "same",
+		"gone.proto":         "owned",
+		"hand.proto":         "hand written",
+	})
+	entries := []PlanEntry{
+		{Path: "owned.proto", Status: "M"},
+		{Path: filepath.Join("nested", "owned.proto"), Status: "M"},
+		{Path: "same.proto", Status: "M"},
+		{Path: "theirs.proto", Status: "M"},
+		{Path: "added.proto", Status: "A"},
+		{Path: "unchanged.proto", Status: "="},
+		{Path: "gone.proto", Status: "D"},
+		{Path: "hand.proto", Status: "D"},
+	}
+
+	tests := []struct {
+		name          string
+		force         bool
+		manifest      []string // nil bootstraps ownership from the lockfile
+		locked        []string
+		wantAllowed   string
+		wantConflicts string
+	}{
+		{
+			name:          "manifest",
+			manifest:      []string{"owned.proto", "nested/owned.proto", "gone.proto"},
+			wantAllowed:   "added.proto gone.proto nested/owned.proto owned.proto same.proto unchanged.proto",
+			wantConflicts: "theirs.proto",
+		},
+		{
+			name:          "empty manifest",
+			manifest:      []string{},
+			wantAllowed:   "added.proto same.proto unchanged.proto",
+			wantConflicts: "nested/owned.proto owned.proto theirs.proto",
+		},
+		{
+			name:          "bootstrapped from the lockfile",
+			locked:        []string{"owned.proto", "theirs.proto"},
+			wantAllowed:   "added.proto owned.proto same.proto theirs.proto unchanged.proto",
+			wantConflicts: "nested/owned.proto",
+		},
+		{
+			name:        "force",
+			force:       true,
+			manifest:    []string{},
+			wantAllowed: "added.proto gone.proto hand.proto nested/owned.proto owned.proto same.proto theirs.proto unchanged.proto",
+		},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		m.SetForce(tt.force)
+		repo := &models.Repository{Name: "proto", TargetDirectory: target}
+
+		os.Remove(GetLockPath(target))
+		if tt.manifest != nil {
+			if err := SaveManifest(&models.OwnershipManifest{Repository: repo.Name, TargetDirectory: target, Files: tt.manifest}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.locked != nil {
+			files := map[string]string{}
+			for _, path := range tt.locked {
+				files[path] = "hash"
+			}
+			lock := &models.LockFile{Repositories: []models.LockEntry{{Name: repo.Name, Files: files}}}
+			if err := SaveLock(target, lock); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		allowed, conflicts, err := m.filterOwned(repo, source, entries)
+		if err != nil {
+			t.Errorf("%s: filterOwned() failed: %v", tt.name, err)
+			continue
+		}
+		if got := entryPaths(allowed); got != tt.wantAllowed {
+			t.Errorf("%s: allowed = %q, want %q", tt.name, got, tt.wantAllowed)
+		}
+		sort.Strings(conflicts)
+		if got := strings.Join(conflicts, " "); got != tt.wantConflicts {
+			t.Errorf("%s: conflicts = %q, want %q", tt.name, got, tt.wantConflicts)
+		}
+	}
+}
+
+func TestUpdateManifest(t *testing.T) {
+	m := newTestManager(t)
+	target := t.TempDir()
+	repo := &models.Repository{Name: "proto", TargetDirectory: target}
+
+	if err := SaveManifest(&models.OwnershipManifest{Repository: repo.Name, TargetDirectory: target, Files: []string{"a.proto", "b.proto"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []models.FileChange{
+		{Path: "b.proto", ChangeType: models.ChangeTypeDeleted},
+		{Path: filepath.Join("sub", "c.proto"), ChangeType: models.ChangeTypeAdded},
+		{Path: "a.proto", ChangeType: models.ChangeTypeModified},
+	}
+	if err := m.updateManifest(repo, changes); err != nil {
+		t.Fatalf("updateManifest() failed: %v", err)
+	}
+
+	manifest, err := LoadManifest(repo.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(manifest.Files, " "); got != "a.proto sub/c.proto" {
+		t.Errorf("manifest files = %q, want %q", got, "a.proto sub/c.proto")
+	}
+	if manifest.TargetDirectory != target {
+		t.Errorf("manifest target = %q, want %q", manifest.TargetDirectory, target)
+	}
+}
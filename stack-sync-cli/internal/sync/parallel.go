@@ -0,0 +1,241 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// ErrDependencyFailed is wrapped by errors of repositories skipped because a
+// repository they depend on failed to sync or was left with conflicts
+var ErrDependencyFailed = errors.New("dependency failed to sync")
+
+// CheckDependencies returns an error wrapping ErrDependencyFailed if repo
+// depends on one of the failed repositories
+func CheckDependencies(repo *models.Repository, failed map[string]bool) error {
+	for _, dep := range repo.DependsOn {
+		if failed[dep] {
+			return fmt.Errorf("%w: %s", ErrDependencyFailed, dep)
+		}
+	}
+	return nil
+}
+
+// RepoResult is how one repository of a parallel sync ended
+type RepoResult struct {
+	Repository *models.Repository
+	Result     *SyncResult
+	Err        error
+	Duration   time.Duration
+}
+
+// Failed reports whether the sync failed or left conflicts, either of which
+// skips the repositories depending on it
+func (r RepoResult) Failed() bool {
+	return r.Err != nil || r.Result.HasConflicts()
+}
+
+// SyncFunc syncs one repository, like (*Manager).SyncRepository
+type SyncFunc func(m *Manager, ctx context.Context, repo *models.Repository) (*SyncResult, error)
+
+// SyncParallel syncs repositories with up to jobs of them at a time. Fetching
+// and planning overlap freely; applies to overlapping target directories run
+// one at a time. Prompts are disabled and every line of output is prefixed with
+// the repository's name. Results are in the order of repos; once ctx is
+// cancelled, repositories not started yet fail with ErrCancelled.
+//
+// repos must be in sync order (see config.SyncOrder): a repository starts only
+// after the earlier repositories it depends on finished, and is skipped with
+// ErrDependencyFailed if one of them failed or was left with conflicts.
+func (m *Manager) SyncParallel(ctx context.Context, repos []*models.Repository, jobs int, syncFn SyncFunc) []RepoResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]RepoResult, len(repos))
+	done := make([]chan struct{}, len(repos))
+	index := make(map[string]int, len(repos))
+	for i, repo := range repos {
+		done[i] = make(chan struct{})
+		index[repo.Name] = i
+	}
+	targets := newTargetLocks()
+	var outMu gosync.Mutex
+
+	queue := make(chan int)
+	var workers gosync.WaitGroup
+	for w := 0; w < jobs && w < len(repos); w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range queue {
+				repo := repos[i]
+
+				failed := make(map[string]bool)
+				for _, dep := range repo.DependsOn {
+					if j, ok := index[dep]; ok && j < i {
+						<-done[j]
+						failed[dep] = results[j].Failed()
+					}
+				}
+				if err := CheckDependencies(repo, failed); err != nil {
+					results[i] = RepoResult{Repository: repo, Err: err}
+					close(done[i])
+					continue
+				}
+
+				out := newPrefixWriter(m.out, fmt.Sprintf("[%s] ", repo.Name), &outMu)
+
+				worker := *m
+				worker.out = out
+				worker.nonInteractive = true
+				worker.targets = targets
+
+				start := time.Now()
+				result, err := syncFn(&worker, ctx, repo)
+				out.Flush()
+				results[i] = RepoResult{Repository: repo, Result: result, Err: err, Duration: time.Since(start)}
+				close(done[i])
+			}
+		}()
+	}
+
+	for i, repo := range repos {
+		if ctx.Err() != nil {
+			results[i] = RepoResult{Repository: repo, Err: fmt.Errorf("%w: not started", ErrCancelled)}
+			close(done[i])
+			continue
+		}
+		queue <- i
+	}
+	close(queue)
+	workers.Wait()
+
+	return results
+}
+
+// targetLocks serializes applies to overlapping target directories during a
+// parallel sync. A nil *targetLocks never blocks.
+type targetLocks struct {
+	mu     gosync.Mutex
+	cond   *gosync.Cond
+	active map[string]bool
+}
+
+// newTargetLocks creates an empty set of target locks
+func newTargetLocks() *targetLocks {
+	l := &targetLocks{active: make(map[string]bool)}
+	l.cond = gosync.NewCond(&l.mu)
+	return l
+}
+
+// lock waits until no other apply writes to dir, a parent or a child of it,
+// then claims dir. The returned function releases it.
+func (l *targetLocks) lock(m *Manager, dir string) func() {
+	if l == nil {
+		return func() {}
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for waited := false; l.overlaps(dir); waited = true {
+		if !waited {
+			fmt.Fprintf(m.out, "Waiting for another sync writing to %s...\n", dir)
+		}
+		l.cond.Wait()
+	}
+	l.active[dir] = true
+
+	return func() {
+		l.mu.Lock()
+		delete(l.active, dir)
+		l.mu.Unlock()
+		l.cond.Broadcast()
+	}
+}
+
+// overlaps reports whether dir is, contains or is inside a claimed directory
+func (l *targetLocks) overlaps(dir string) bool {
+	for active := range l.active {
+		if dir == active || isWithin(dir, active) || isWithin(active, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin reports whether path is inside dir
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// prefixWriter writes whole lines, each prefixed, to a writer shared with
+// other repositories. Lines ending in a carriage return are progress updates
+// that would interleave unreadably, so they are dropped.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *gosync.Mutex // shared by every writer of w
+	buf    []byte
+}
+
+// newPrefixWriter creates a prefixWriter
+func newPrefixWriter(w io.Writer, prefix string, mu *gosync.Mutex) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix, mu: mu}
+}
+
+// Write implements io.Writer
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 || (p.buf[i] == '\r' && i == len(p.buf)-1) {
+			// Wait for the rest of the line, or whether \r starts a \r\n
+			return len(data), nil
+		}
+
+		line := p.buf[:i]
+		end := i + 1
+		if p.buf[i] == '\r' && p.buf[end] == '\n' {
+			end++
+		}
+		progress := end == i+1 && p.buf[i] == '\r'
+		p.buf = p.buf[end:]
+
+		if !progress {
+			if err := p.writeLine(line); err != nil {
+				return len(data), err
+			}
+		}
+	}
+}
+
+// Flush writes a trailing partial line, unless it is a progress update
+func (p *prefixWriter) Flush() error {
+	line := p.buf
+	p.buf = nil
+	if len(line) == 0 || line[len(line)-1] == '\r' {
+		return nil
+	}
+	return p.writeLine(line)
+}
+
+// writeLine writes one prefixed line
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s\n", p.prefix, line)
+	return err
+}
@@ -0,0 +1,252 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/config"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	tests := []struct {
+		dependsOn []string
+		failed    map[string]bool
+		wantErr   bool
+	}{
+		{dependsOn: nil, failed: map[string]bool{"a": true}},
+		{dependsOn: []string{"a"}, failed: map[string]bool{}},
+		{dependsOn: []string{"a"}, failed: map[string]bool{"a": false}},
+		{dependsOn: []string{"a", "b"}, failed: map[string]bool{"b": true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := CheckDependencies(&models.Repository{Name: "app", DependsOn: tt.dependsOn}, tt.failed)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("CheckDependencies(%v, %v) = %v, want error %v", tt.dependsOn, tt.failed, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrDependencyFailed) {
+			t.Errorf("CheckDependencies() error %v does not wrap ErrDependencyFailed", err)
+		}
+	}
+}
+
+func TestRepoResultFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		result RepoResult
+		want   bool
+	}{
+		{name: "synced", result: RepoResult{Result: &SyncResult{}}, want: false},
+		{name: "no result", result: RepoResult{}, want: false},
+		{name: "error", result: RepoResult{Err: errors.New("boom")}, want: true},
+		{name: "unowned conflict", result: RepoResult{Result: &SyncResult{Conflicts: []string{"a.proto"}}}, want: true},
+		{name: "merge conflict", result: RepoResult{Result: &SyncResult{LocalEdits: []LocalEdit{{Path: "a.proto", Resolution: "merge", Conflicted: true}}}}, want: true},
+		{name: "clean merge", result: RepoResult{Result: &SyncResult{LocalEdits: []LocalEdit{{Path: "a.proto", Resolution: "merge"}}}}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.result.Failed(); got != tt.want {
+			t.Errorf("%s: Failed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSyncParallelSkipsDependents(t *testing.T) {
+	repos := []*models.Repository{
+		{Name: "conflicted"},
+		{Name: "broken"},
+		{Name: "clean"},
+		{Name: "on-conflicted", DependsOn: []string{"conflicted"}},
+		{Name: "on-broken", DependsOn: []string{"broken"}},
+		{Name: "on-clean", DependsOn: []string{"clean"}},
+		{Name: "transitive", DependsOn: []string{"on-broken"}},
+	}
+
+	syncFn := func(m *Manager, ctx context.Context, repo *models.Repository) (*SyncResult, error) {
+		switch repo.Name {
+		case "conflicted":
+			return &SyncResult{Repository: repo.Name, Conflicts: []string{"a.proto"}}, nil
+		case "broken":
+			return nil, errors.New("clone failed")
+		}
+		return &SyncResult{Repository: repo.Name}, nil
+	}
+
+	for _, jobs := range []int{1, 4} {
+		m := NewManager(&config.Config{}, nil)
+		m.SetOutput(&bytes.Buffer{})
+		results := m.SyncParallel(context.Background(), repos, jobs, syncFn)
+
+		skipped := map[string]bool{}
+		for _, r := range results {
+			skipped[r.Repository.Name] = errors.Is(r.Err, ErrDependencyFailed)
+		}
+		want := map[string]bool{
+			"conflicted":    false,
+			"broken":        false,
+			"clean":         false,
+			"on-conflicted": true,
+			"on-broken":     true,
+			"on-clean":      false,
+			"transitive":    true,
+		}
+		for name, wantSkipped := range want {
+			if skipped[name] != wantSkipped {
+				t.Errorf("jobs=%d: %s skipped = %v, want %v", jobs, name, skipped[name], wantSkipped)
+			}
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		flush  bool
+		want   string
+	}{
+		{name: "whole lines", writes: []string{"one\ntwo\n"}, want: "[r] one\n[r] two\n"},
+		{name: "line split across writes", writes: []string{"Fetch", "ing...", "\n"}, want: "[r] Fetching...\n"},
+		{name: "partial line waits", writes: []string{"done\npart"}, want: "[r] done\n"},
+		{name: "partial line flushed", writes: []string{"done\npart"}, flush: true, want: "[r] done\n[r] part\n"},
+		{name: "CRLF is one line", writes: []string{"a\r\nb\r\n"}, want: "[r] a\n[r] b\n"},
+		{name: "CRLF split across writes", writes: []string{"a\r", "\nb\n"}, want: "[r] a\n[r] b\n"},
+		{name: "progress updates are dropped", writes: []string{"Counting 1%\rCounting 50%\rCounting 100%, done.\n"}, want: "[r] Counting 100%, done.\n"},
+		{name: "trailing progress dropped", writes: []string{"done\nCounting 1%\r"}, flush: true, want: "[r] done\n"},
+		{name: "empty lines kept", writes: []string{"\n\n"}, want: "[r] \n[r] \n"},
+		{name: "nothing to flush", writes: nil, flush: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		var mu gosync.Mutex
+		w := newPrefixWriter(&buf, "[r] ", &mu)
+		for _, data := range tt.writes {
+			if n, err := w.Write([]byte(data)); err != nil || n != len(data) {
+				t.Fatalf("%s: Write(%q) = %d, %v", tt.name, data, n, err)
+			}
+		}
+		if tt.flush {
+			if err := w.Flush(); err != nil {
+				t.Fatalf("%s: Flush() failed: %v", tt.name, err)
+			}
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	var mu gosync.Mutex
+	var wg gosync.WaitGroup
+	for _, prefix := range []string{"[a] ", "[b] ", "[c] "} {
+		wg.Add(1)
+		go func(w *prefixWriter) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.Write([]byte("line "))
+				w.Write([]byte("of output\n"))
+			}
+		}(newPrefixWriter(&buf, prefix, &mu))
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 300 {
+		t.Fatalf("got %d lines, want 300", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) != len("[a] line of output") || !strings.HasSuffix(line, "] line of output") {
+			t.Fatalf("interleaved line: %q", line)
+		}
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{"/srv/app/proto", "/srv/app", true},
+		{"/srv/app/a/b", "/srv/app", true},
+		{"/srv/app", "/srv/app", false},
+		{"/srv/application", "/srv/app", false},
+		{"/srv", "/srv/app", false},
+		{"/srv/other", "/srv/app", false},
+		{"/srv/app/..data", "/srv/app", true},
+	}
+
+	for _, tt := range tests {
+		path, dir := filepath.FromSlash(tt.path), filepath.FromSlash(tt.dir)
+		if got := isWithin(path, dir); got != tt.want {
+			t.Errorf("isWithin(%s, %s) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestTargetLocksOverlap(t *testing.T) {
+	tests := []struct {
+		active []string
+		dir    string
+		want   bool
+	}{
+		{nil, "/srv/app", false},
+		{[]string{"/srv/app"}, "/srv/app", true},
+		{[]string{"/srv/app"}, "/srv/app/proto", true},
+		{[]string{"/srv/app/proto"}, "/srv/app", true},
+		{[]string{"/srv/app"}, "/srv/api", false},
+		{[]string{"/srv/app", "/srv/web"}, "/srv/web/gen", true},
+	}
+
+	for _, tt := range tests {
+		l := newTargetLocks()
+		for _, dir := range tt.active {
+			l.active[filepath.FromSlash(dir)] = true
+		}
+		if got := l.overlaps(filepath.FromSlash(tt.dir)); got != tt.want {
+			t.Errorf("overlaps(%s) with %v active = %v, want %v", tt.dir, tt.active, got, tt.want)
+		}
+	}
+}
+
+func TestTargetLocksSerialize(t *testing.T) {
+	m := NewManager(&config.Config{}, nil)
+	m.SetOutput(&bytes.Buffer{})
+	l := newTargetLocks()
+	parent := t.TempDir()
+	child := filepath.Join(parent, "proto")
+
+	unlock := l.lock(m, parent)
+	acquired := make(chan struct{})
+	go func() {
+		release := l.lock(m, child)
+		close(acquired)
+		release()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("a nested target was locked while its parent was")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the nested target was never locked after its parent was released")
+	}
+
+	// Unrelated targets don't wait, and a nil set never blocks
+	l.lock(m, t.TempDir())()
+	(*targetLocks)(nil).lock(m, parent)()
+}
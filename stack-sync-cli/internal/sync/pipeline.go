@@ -0,0 +1,254 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// ErrCancelled is returned when a sync is interrupted before it changed the target
+var ErrCancelled = errors.New("sync cancelled")
+
+// Plan is what a sync could do: every source file matching the repository's
+// patterns, classified against the target, plus the target files that no
+// longer exist upstream. Selectors choose from it. A plan holds a checkout of
+// the source until it is applied or closed.
+type Plan struct {
+	Repository *models.Repository
+	Commit     string      // commit the source was checked out at
+	SourcePath string      // checkout of the source directory
+	Files      []string    // source files matching the patterns, relative to SourcePath
+	Entries    []PlanEntry // one A, M or = entry per file, in the same order
+	Stale      []PlanEntry // D entries for target files gone upstream, owned or not
+
+	pipeline  syncPipeline
+	source    *syncSource
+	cleanup   func()
+	startTime time.Time
+}
+
+// Close removes the plan's checkout of the source
+func (p *Plan) Close() {
+	if p.cleanup != nil {
+		p.cleanup()
+	}
+	p.cleanup = nil
+	p.source = nil
+}
+
+// EntriesFor returns the planned entries of the given source files
+func (p *Plan) EntriesFor(files []string) []PlanEntry {
+	byPath := make(map[string]PlanEntry, len(p.Entries))
+	for _, entry := range p.Entries {
+		byPath[entry.Path] = entry
+	}
+
+	entries := make([]PlanEntry, 0, len(files))
+	for _, file := range files {
+		if entry, ok := byPath[file]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Selector decides which planned entries a sync applies. An empty selection
+// ends the sync without changes; the selector explains why.
+type Selector interface {
+	Select(m *Manager, plan *Plan) ([]PlanEntry, error)
+}
+
+// syncPipeline configures one sync. Every mode runs the same stages (fetch,
+// resolve, plan, select, apply, record, hooks) and differs only in its selector
+// and these options.
+type syncPipeline struct {
+	selector Selector
+	ref      string       // check out this commit instead of the configured branch or ref
+	locked   bool         // reproducing the lockfile: it stays untouched and unowned files fail the sync
+	verify   func() error // checked after apply, a failure rolls the sync back
+}
+
+// SyncRepositoryWith synchronizes a repository, letting selector choose the changes
+func (m *Manager) SyncRepositoryWith(ctx context.Context, repo *models.Repository, selector Selector) (*SyncResult, error) {
+	return m.runPipeline(ctx, repo, syncPipeline{selector: selector})
+}
+
+// PlanSync fetches a repository and plans a sync without touching the target.
+// Apply the plan with ApplyPlan, or Close it.
+func (m *Manager) PlanSync(ctx context.Context, repo *models.Repository) (*Plan, error) {
+	return m.preparePlan(ctx, repo, syncPipeline{})
+}
+
+// runPipeline runs a sync through its stages. Cancelling ctx stops it at the
+// next stage or file; once the changes were applied, the sync completes.
+func (m *Manager) runPipeline(ctx context.Context, repo *models.Repository, p syncPipeline) (*SyncResult, error) {
+	plan, err := m.preparePlan(ctx, repo, p)
+	if err != nil {
+		return nil, err
+	}
+	defer plan.Close()
+	return m.ApplyPlan(ctx, plan, p.selector)
+}
+
+// preparePlan runs the fetch, resolve and plan stages
+func (m *Manager) preparePlan(ctx context.Context, repo *models.Repository, p syncPipeline) (*Plan, error) {
+	repo.Status = models.StatusSyncing
+	startTime := time.Now()
+
+	// Fetch and resolve: check out the configured branch or ref, or the pinned commit
+	fetched := repo
+	if p.ref != "" {
+		pinned := *repo
+		pinned.Ref = p.ref
+		fetched = &pinned
+	}
+	source, cleanup, err := m.prepareSource(ctx, fetched)
+	if err != nil {
+		cleanup()
+		repo.Status = models.StatusError
+		return nil, m.recordCancelled(ctx, repo, nil, startTime, err)
+	}
+	source.locked = p.locked
+
+	// Plan: classify every matching source file against the target
+	plan, err := m.planChanges(ctx, repo, source.path)
+	if err != nil {
+		cleanup()
+		repo.Status = models.StatusError
+		return nil, m.recordCancelled(ctx, repo, source, startTime, err)
+	}
+	plan.Commit = source.commit
+	plan.pipeline = p
+	plan.source = source
+	plan.cleanup = cleanup
+	plan.startTime = startTime
+	return plan, nil
+}
+
+// ApplyPlan runs the select, apply, record and hooks stages of a plan, letting
+// selector choose the changes. The plan's checkout is removed afterwards.
+func (m *Manager) ApplyPlan(ctx context.Context, plan *Plan, selector Selector) (*SyncResult, error) {
+	defer plan.Close()
+	if plan.source == nil {
+		return nil, fmt.Errorf("plan for %s was already applied or closed", plan.Repository.Name)
+	}
+	repo, source, p := plan.Repository, plan.source, plan.pipeline
+	result := &SyncResult{Repository: repo.Name, Commit: source.commit}
+
+	// Only one parallel sync at a time may write to a target directory
+	unlock := m.targets.lock(m, repo.TargetDirectory)
+	defer unlock()
+
+	// Select: let the mode choose what to apply
+	entries, err := selector.Select(m, plan)
+	if err != nil {
+		repo.Status = models.StatusError
+		return nil, err
+	}
+	if len(entries) == 0 {
+		repo.Status = models.StatusUpToDate
+		return result, nil
+	}
+
+	// Never overwrite or delete files this repository doesn't own
+	entries, result.Conflicts, err = m.filterOwned(repo, source.path, entries)
+	if err != nil {
+		repo.Status = models.StatusError
+		return nil, err
+	}
+	if p.locked && len(result.Conflicts) > 0 {
+		m.reportConflicts(repo, result)
+		repo.Status = models.StatusConflict
+		return nil, fmt.Errorf("%d locked files are not owned by %s", len(result.Conflicts), repo.Name)
+	}
+
+	// Don't silently overwrite files edited locally since the last sync;
+	// a locked sync reproduces the lockfile exactly instead. Every prompt of
+	// this apply shares one reader, so buffered answers aren't lost.
+	if !p.locked {
+		entries, result.LocalEdits, err = m.resolveLocalEdits(repo, source.path, entries, bufio.NewReader(os.Stdin))
+		if err != nil {
+			repo.Status = models.StatusError
+			return nil, err
+		}
+	}
+
+	if m.dryRun {
+		return m.planSync(repo, source.path, entries, result), nil
+	}
+
+	// Stop here if the sync was cancelled while choosing what to apply
+	if err := ctx.Err(); err != nil {
+		repo.Status = models.StatusError
+		return nil, m.recordCancelled(ctx, repo, source, plan.startTime, err)
+	}
+
+	// Apply, hooks and record: stage the changes and swap them into the target
+	if err := m.prepareTarget(repo); err != nil {
+		repo.Status = models.StatusError
+		return nil, err
+	}
+	return m.applyChangeset(ctx, repo, source, entries, result, plan.startTime, p.verify)
+}
+
+// recordCancelled records a sync cancelled before it changed the target and
+// marks err as a cancellation. Other errors are returned unchanged.
+func (m *Manager) recordCancelled(ctx context.Context, repo *models.Repository, source *syncSource, startTime time.Time, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	if !m.dryRun {
+		if source == nil {
+			source = &syncSource{strategy: repo.CloneStrategy, resolved: repo.Branch}
+		}
+		m.recordSyncHistory(repo, source, nil, startTime, syncOutcome{cancelled: true, err: err.Error()})
+	}
+	return fmt.Errorf("%w: %w", ErrCancelled, err)
+}
+
+// planChanges scans the source and classifies each file against the target
+func (m *Manager) planChanges(ctx context.Context, repo *models.Repository, sourcePath string) (*Plan, error) {
+	fmt.Fprintf(m.out, "Scanning files in %s...\n", sourcePath)
+	files, err := m.scanFiles(ctx, sourcePath, repo.FilePatterns, repo.ExcludePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan files: %w", err)
+	}
+
+	stale, err := m.staleEntries(ctx, repo, files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plan{
+		Repository: repo,
+		SourcePath: sourcePath,
+		Files:      files,
+		Entries:    m.plannedEntries(sourcePath, repo.TargetDirectory, files),
+		Stale:      stale,
+	}, nil
+}
+
+// PrunableEntries returns the stale entries of a plan that pruning may delete
+func (m *Manager) PrunableEntries(plan *Plan) ([]PlanEntry, error) {
+	return m.pruneEntries(plan.Repository, plan.Stale)
+}
+
+// selectFiles turns chosen source files into entries and adds the deletions
+// pruning asks for, which apply even when no files are selected
+func (m *Manager) selectFiles(plan *Plan, files []string) ([]PlanEntry, error) {
+	prune, err := m.PrunableEntries(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 && len(prune) == 0 {
+		fmt.Fprintln(m.out, "No files selected for sync")
+		return nil, nil
+	}
+	return append(plan.EntriesFor(files), prune...), nil
+}
@@ -0,0 +1,247 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// lastHistory returns the newest history entry of a repository
+func lastHistory(t *testing.T, repo *models.Repository) models.SyncHistory {
+	t.Helper()
+	histories, err := GetHistoryForRepository(repo.Name, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) == 0 {
+		t.Fatalf("no history recorded for %s", repo.Name)
+	}
+	return histories[0]
+}
+
+// cancelWhenCreated cancels once path exists
+func cancelWhenCreated(t *testing.T, path string, cancel context.CancelFunc) {
+	go func() {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if _, err := os.Stat(path); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Error("post-sync command never started")
+		cancel()
+	}()
+}
+
+func TestCancelledSyncIsRecorded(t *testing.T) {
+	m := newTestManager(t)
+	m.SetNonInteractive(true)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1"})
+	repo := syncedRepo(t, u)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := m.SyncRepositoryWith(ctx, repo, AllSelector{})
+	if !errors.Is(err, ErrCancelled) || result != nil {
+		t.Fatalf("SyncRepositoryWith() with a cancelled context = %v, %v, want ErrCancelled", result, err)
+	}
+	if _, err := os.Stat(repo.TargetDirectory); !os.IsNotExist(err) {
+		t.Error("cancelled sync created the target directory")
+	}
+
+	history := lastHistory(t, repo)
+	if !history.Cancelled || history.Success || history.RolledBack || history.Error == "" {
+		t.Errorf("history of the cancelled sync = %+v, want cancelled with an error", history)
+	}
+}
+
+func TestCancelDuringPostSyncCommand(t *testing.T) {
+	for _, rollback := range []bool{true, false} {
+		m := newTestManager(t)
+		m.SetNonInteractive(true)
+		u := newUpstream(t, map[string]string{"api/a.proto": "a1"})
+		repo := syncedRepo(t, u)
+		syncAll(t, m, repo)
+
+		u.commit(map[string]string{"api/a.proto": "a2"})
+		started := filepath.Join(t.TempDir(), "started")
+		repo.RollbackOnHookFailure = rollback
+		repo.PostSyncCommands = []models.PostSyncCommand{{Command: "touch " + started + " && exec sleep 10", Directory: t.TempDir()}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelWhenCreated(t, started, cancel)
+		begin := time.Now()
+		_, err := m.SyncRepositoryWith(ctx, repo, AllSelector{})
+		cancel()
+		if time.Since(begin) > 8*time.Second {
+			t.Errorf("rollback %v: the post-sync command was not stopped", rollback)
+		}
+
+		history := lastHistory(t, repo)
+		if rollback {
+			// The changes were rolled back, so the sync was cancelled as a whole
+			if !errors.Is(err, ErrCancelled) {
+				t.Errorf("rollback: error = %v, want ErrCancelled", err)
+			}
+			if got := readTarget(t, repo, "a.proto"); got != "a1" {
+				t.Errorf("rollback: a.proto = %q, want the content from before the sync", got)
+			}
+			if !history.Cancelled || !history.RolledBack || history.Success {
+				t.Errorf("rollback: history = %+v, want cancelled and rolled back", history)
+			}
+			continue
+		}
+
+		// Without rollback the applied changes stay and the sync completes
+		if err != nil {
+			t.Errorf("no rollback: error = %v, want the sync to complete", err)
+		}
+		if got := readTarget(t, repo, "a.proto"); got != "a2" {
+			t.Errorf("no rollback: a.proto = %q, want a2", got)
+		}
+		if history.Cancelled || !history.Success {
+			t.Errorf("no rollback: history = %+v, want a successful sync", history)
+		}
+	}
+}
+
+// recordingSelector selects everything and records whether the target was
+// locked while selecting
+type recordingSelector struct {
+	calls  *int
+	locked *bool
+}
+
+// Select implements Selector
+func (s recordingSelector) Select(m *Manager, plan *Plan) ([]PlanEntry, error) {
+	*s.calls++
+	m.targets.mu.Lock()
+	*s.locked = m.targets.overlaps(plan.Repository.TargetDirectory)
+	m.targets.mu.Unlock()
+	return AllSelector{}.Select(m, plan)
+}
+
+func TestApplyPlanStages(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		m := newTestManager(t)
+		m.targets = newTargetLocks()
+		u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"})
+		repo := syncedRepo(t, u)
+		syncAll(t, m, repo)
+
+		// a.proto is edited on both sides; hand.proto is locked but not owned,
+		// so it must be reported as a conflict before local edits are resolved
+		writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "a local", "hand.proto": "hand written"})
+		lock, err := LoadLock(repo.TargetDirectory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lock.GetEntry(repo.Name).Files["hand.proto"] = sha256Hex("synced once")
+		if err := SaveLock(repo.TargetDirectory, lock); err != nil {
+			t.Fatal(err)
+		}
+		u.commit(map[string]string{"api/a.proto": "a2", "api/b.proto": "b2", "api/hand.proto": "upstream"})
+
+		m.SetOnConflict(models.OnConflictTakeRemote)
+		m.SetDryRun(dryRun)
+		plan, err := m.PlanSync(context.Background(), repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Another apply holds the target, so selecting waits for it
+		release := m.targets.lock(m, repo.TargetDirectory)
+		var calls int
+		var locked bool
+		done := make(chan struct{})
+		var result *SyncResult
+		go func() {
+			defer close(done)
+			result, err = m.ApplyPlan(context.Background(), plan, recordingSelector{calls: &calls, locked: &locked})
+		}()
+		select {
+		case <-done:
+			t.Fatalf("dry run %v: ApplyPlan() didn't wait for the target lock", dryRun)
+		case <-time.After(50 * time.Millisecond):
+		}
+		release()
+		<-done
+
+		if err != nil {
+			t.Fatalf("dry run %v: ApplyPlan() failed: %v", dryRun, err)
+		}
+		if calls != 1 || !locked {
+			t.Errorf("dry run %v: selector called %d times, target locked while selecting: %v", dryRun, calls, locked)
+		}
+		if strings.Join(result.Conflicts, " ") != "hand.proto" {
+			t.Errorf("dry run %v: conflicts = %v, want hand.proto", dryRun, result.Conflicts)
+		}
+		if len(result.LocalEdits) != 1 || result.LocalEdits[0].Path != "a.proto" || result.LocalEdits[0].Resolution != models.OnConflictTakeRemote {
+			t.Errorf("dry run %v: local edits = %+v, want a.proto taken from the remote", dryRun, result.LocalEdits)
+		}
+		if result.DryRun != dryRun {
+			t.Errorf("dry run %v: result.DryRun = %v", dryRun, result.DryRun)
+		}
+
+		// Only a real apply changes the target, and never the unowned file
+		want := map[string]string{"a.proto": "a2", "b.proto": "b2", "hand.proto": "hand written"}
+		if dryRun {
+			want = map[string]string{"a.proto": "a local", "b.proto": "b1", "hand.proto": "hand written"}
+		}
+		for path, content := range want {
+			if got := readTarget(t, repo, path); got != content {
+				t.Errorf("dry run %v: %s = %q, want %q", dryRun, path, got, content)
+			}
+		}
+		if _, err := os.Stat(plan.SourcePath); !os.IsNotExist(err) {
+			t.Errorf("dry run %v: checkout of the plan was kept after applying it", dryRun)
+		}
+	}
+}
+
+func TestApplyClosedPlan(t *testing.T) {
+	m := newTestManager(t)
+	m.SetNonInteractive(true)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1"})
+	repo := syncedRepo(t, u)
+
+	plan, err := m.PlanSync(context.Background(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Commit == "" || strings.Join(plan.Files, " ") != "a.proto" {
+		t.Errorf("plan = %s at %q", plan.Files, plan.Commit)
+	}
+	plan.Close()
+	if _, err := os.Stat(plan.SourcePath); !os.IsNotExist(err) {
+		t.Error("Close() kept the checkout")
+	}
+	plan.Close()
+
+	if _, err := m.ApplyPlan(context.Background(), plan, AllSelector{}); err == nil || !strings.Contains(err.Error(), "already applied or closed") {
+		t.Errorf("ApplyPlan() of a closed plan = %v", err)
+	}
+	if got := readTarget(t, repo, "a.proto"); got != "<missing>" {
+		t.Errorf("closed plan wrote a.proto = %q", got)
+	}
+
+	// A plan applies once
+	plan, err = m.PlanSync(context.Background(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ApplyPlan(context.Background(), plan, AllSelector{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ApplyPlan(context.Background(), plan, AllSelector{}); err == nil {
+		t.Error("applying a plan twice succeeded")
+	}
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// plannedEntries classifies source files against the target: files missing
+// from the target are added (A), files with the same content unchanged (=),
+// everything else modified (M)
+func (m *Manager) plannedEntries(sourcePath, targetPath string, selectedFiles []string) []PlanEntry {
+	cache := loadHashCache()
+	defer cache.save()
+
+	entries := make([]PlanEntry, 0, len(selectedFiles))
+	for _, relPath := range selectedFiles {
+		dstPath := filepath.Join(targetPath, relPath)
+		status := "A"
+		if _, err := os.Stat(dstPath); err == nil {
+			status = "M"
+			if same, err := sameHash(cache, filepath.Join(sourcePath, relPath), dstPath); err == nil && same {
+				status = "="
+			}
+		}
+		entries = append(entries, PlanEntry{Path: relPath, Status: status})
+	}
+	return entries
+}
+
+// planSync prints the writes, deletions, backup and post-sync commands a sync
+// would perform and returns them as the result without touching anything
+func (m *Manager) planSync(repo *models.Repository, sourcePath string, entries []PlanEntry, result *SyncResult) *SyncResult {
+	result.DryRun = true
+
+	fmt.Fprintf(m.out, "\n🔍 Dry run for %s: nothing will be written\n", repo.Name)
+	fmt.Fprintln(m.out, "────────────────────────────────────────")
+
+	if m.backupEnabled(repo) {
+		// Only files about to be overwritten or deleted are captured
+		captured := 0
+		for _, entry := range entries {
+			if entry.Status == "M" || entry.Status == "D" {
+				captured++
+			}
+		}
+		for _, edit := range result.LocalEdits {
+			if edit.Resolution == models.OnConflictMerge {
+				captured++
+			}
+		}
+		if captured > 0 {
+			fmt.Fprintf(m.out, "  Backup:  %d files -> %s\n", captured, m.GetBackupRoot(repo.Name))
+		}
+	}
+
+	writes, deletes, unchanged := 0, 0, 0
+	for _, entry := range entries {
+		change := models.FileChange{Path: entry.Path}
+		switch entry.Status {
+		case "=":
+			change.ChangeType = models.ChangeTypeUnchanged
+			unchanged++
+			result.Changes = append(result.Changes, change)
+			continue
+		case "D":
+			change.ChangeType = models.ChangeTypeDeleted
+			if info, err := os.Stat(filepath.Join(repo.TargetDirectory, entry.Path)); err == nil {
+				change.Size = info.Size()
+			}
+			deletes++
+		case "A":
+			change.ChangeType = models.ChangeTypeAdded
+			writes++
+		default:
+			change.ChangeType = models.ChangeTypeModified
+			writes++
+		}
+		if change.ChangeType != models.ChangeTypeDeleted {
+			if info, err := os.Stat(filepath.Join(sourcePath, entry.Path)); err == nil {
+				change.Size = info.Size()
+			}
+		}
+
+		fmt.Fprintf(m.out, "  [%s] %s\n", entry.Status, filepath.Join(repo.TargetDirectory, entry.Path))
+		result.Changes = append(result.Changes, change)
+	}
+
+	for _, path := range result.Conflicts {
+		fmt.Fprintf(m.out, "  [!] %s (not owned, skipped)\n", filepath.Join(repo.TargetDirectory, path))
+	}
+
+	for _, edit := range result.LocalEdits {
+		fmt.Fprintf(m.out, "  [~] %s (local edits, %s)\n", filepath.Join(repo.TargetDirectory, edit.Path), edit.Resolution)
+	}
+
+	if len(repo.PostSyncCommands) > 0 {
+		commands := make([]models.PostSyncCommand, len(repo.PostSyncCommands))
+		copy(commands, repo.PostSyncCommands)
+		sort.Slice(commands, func(i, j int) bool {
+			return commands[i].Order < commands[j].Order
+		})
+		for _, cmd := range commands {
+			fmt.Fprintf(m.out, "  Run:     cd %s && %s\n", cmd.Directory, cmd.Command)
+		}
+	}
+
+	fmt.Fprintln(m.out, "────────────────────────────────────────")
+	fmt.Fprintf(m.out, "Would write %d files and delete %d files (%d unchanged)\n", writes, deletes, unchanged)
+
+	return result
+}
@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// snapshot returns every file below dir with its content, or nil if dir doesn't exist
+func snapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// changeList formats changes as sorted "type path" pairs
+func changeList(changes []models.FileChange) string {
+	var list []string
+	for _, change := range changes {
+		list = append(list, string(change.ChangeType)+" "+filepath.ToSlash(change.Path))
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	m := newTestManager(t)
+	m.SetPrune(true)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1", "api/c.proto": "c1"})
+	repo := syncedRepo(t, u)
+	repo.PostSyncCommands = []models.PostSyncCommand{{Command: "touch hook-ran", Directory: t.TempDir()}}
+
+	// A first sync that only plans doesn't even create the target
+	m.SetDryRun(true)
+	result := syncAll(t, m, repo)
+	if !result.DryRun || changeList(result.Changes) != "added a.proto, added b.proto, added c.proto" {
+		t.Errorf("dry run of a first sync = %+v", result)
+	}
+	if _, err := os.Stat(repo.TargetDirectory); !os.IsNotExist(err) {
+		t.Error("dry run created the target directory")
+	}
+
+	m.SetDryRun(false)
+	syncAll(t, m, repo)
+	hookRan := filepath.Join(repo.PostSyncCommands[0].Directory, "hook-ran")
+	if err := os.Remove(hookRan); err != nil {
+		t.Fatalf("post-sync command of the sync didn't run: %v", err)
+	}
+	u.commit(map[string]string{"api/a.proto": "a2", "api/d.proto": "d1"}, "api/b.proto")
+
+	home, _ := os.UserHomeDir()
+	homeBefore := snapshot(t, home)
+	parent := filepath.Dir(repo.TargetDirectory)
+	parentBefore := snapshot(t, parent)
+
+	m.SetDryRun(true)
+	result = syncAll(t, m, repo)
+	if !result.DryRun {
+		t.Error("result of a dry run is not marked DryRun")
+	}
+	if got, want := changeList(result.Changes), "added d.proto, deleted b.proto, modified a.proto, unchanged c.proto"; got != want {
+		t.Errorf("planned changes = %s, want %s", got, want)
+	}
+
+	// Target, lockfile, history, manifest, base snapshots and backups are untouched
+	if got := snapshot(t, parent); !sameFiles(got, parentBefore) {
+		t.Errorf("dry run changed the target: %v, was %v", got, parentBefore)
+	}
+	if got := snapshot(t, home); !sameFiles(got, homeBefore) {
+		t.Errorf("dry run changed the state in the home directory: %v, was %v", keys(got), keys(homeBefore))
+	}
+	if _, err := os.Stat(hookRan); !os.IsNotExist(err) {
+		t.Error("dry run ran a post-sync command")
+	}
+}
+
+// sameFiles compares two snapshots
+func sameFiles(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, content := range a {
+		if other, ok := b[path]; !ok || other != content {
+			return false
+		}
+	}
+	return true
+}
+
+// keys returns the sorted paths of a snapshot
+func keys(files map[string]string) []string {
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
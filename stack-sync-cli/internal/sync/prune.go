@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// staleEntries returns deletions for target files that match the repository's
+// patterns but no longer exist in the source
+func (m *Manager) staleEntries(ctx context.Context, repo *models.Repository, sourceFiles []string) ([]PlanEntry, error) {
+	if !m.directoryExists(repo.TargetDirectory) {
+		return nil, nil
+	}
+
+	upstream := make(map[string]bool, len(sourceFiles))
+	for _, file := range sourceFiles {
+		upstream[filepath.ToSlash(file)] = true
+	}
+
+	targetFiles, err := m.scanFiles(ctx, repo.TargetDirectory, repo.FilePatterns, repo.ExcludePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan target files: %w", err)
+	}
+
+	var entries []PlanEntry
+	for _, file := range targetFiles {
+		path := filepath.ToSlash(file)
+		if upstream[path] || path == LockFileName || isStageDir(path) {
+			continue
+		}
+		entries = append(entries, PlanEntry{Path: path, Status: "D"})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// pruneEntries returns the stale entries a prune deletes. Nothing is pruned
+// unless pruning is enabled, and only files the repository owns are pruned;
+// anything the tool never synced is kept.
+func (m *Manager) pruneEntries(repo *models.Repository, stale []PlanEntry) ([]PlanEntry, error) {
+	if (!m.prune && !repo.Prune) || len(stale) == 0 {
+		return nil, nil
+	}
+
+	owned, err := m.ownedFiles(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []PlanEntry
+	for _, entry := range stale {
+		if !owned[entry.Path] {
+			fmt.Fprintf(m.out, "Keeping %s: not owned by %s\n", entry.Path, repo.Name)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// syncedFiles returns the target paths earlier syncs of the repository wrote,
+// taken from the target's lockfile and the sync history
+func (m *Manager) syncedFiles(repo *models.Repository) (map[string]bool, error) {
+	synced := make(map[string]bool)
+
+	lock, err := LoadLock(repo.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if entry := lock.GetEntry(repo.Name); entry != nil {
+		for path := range entry.Files {
+			synced[path] = true
+		}
+	}
+
+	histories, err := GetHistoryForRepository(repo.Name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// History is newest first; replay it oldest first so later deletions win.
+	// Rolled back and cancelled syncs left nothing behind.
+	for i := len(histories) - 1; i >= 0; i-- {
+		if histories[i].RolledBack || histories[i].Cancelled {
+			continue
+		}
+		for _, change := range histories[i].FileChanges {
+			path := filepath.ToSlash(change.Path)
+			if change.ChangeType == models.ChangeTypeDeleted {
+				delete(synced, path)
+			} else {
+				synced[path] = true
+			}
+		}
+	}
+
+	return synced, nil
+}
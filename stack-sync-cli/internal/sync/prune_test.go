@@ -0,0 +1,209 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+func TestStaleEntries(t *testing.T) {
+	m := newTestManager(t)
+	repo := &models.Repository{
+		Name:            "proto",
+		TargetDirectory: t.TempDir(),
+		FilePatterns:    []string{"*.proto"},
+		ExcludePatterns: []string{"internal/*"},
+	}
+
+	// Without a target directory nothing is stale
+	missing := *repo
+	missing.TargetDirectory = repo.TargetDirectory + "-missing"
+	if entries, err := m.staleEntries(context.Background(), &missing, nil); err != nil || entries != nil {
+		t.Errorf("staleEntries() of a missing target = %v, %v", entries, err)
+	}
+
+	writeFiles(t, repo.TargetDirectory, map[string]string{
+		"a.proto":          "a",
+		"gone.proto":       "gone",
+		"sub/gone.proto":   "gone",
+		"sub/kept.proto":   "kept",
+		"notes.txt":        "not matched",
+		"internal/x.proto": "excluded",
+		LockFileName:       "{}",
+	})
+
+	entries, err := m.staleEntries(context.Background(), repo, []string{"a.proto", "sub/kept.proto", "new.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := entryPaths(entries), "gone.proto sub/gone.proto"; got != want {
+		t.Errorf("stale = %q, want %q", got, want)
+	}
+	for _, entry := range entries {
+		if entry.Status != "D" {
+			t.Errorf("%s has status %q, want D", entry.Path, entry.Status)
+		}
+	}
+}
+
+func TestPruneEntries(t *testing.T) {
+	stale := []PlanEntry{
+		{Path: "owned.proto", Status: "D"},
+		{Path: "sub/owned.proto", Status: "D"},
+		{Path: "hand.proto", Status: "D"},
+	}
+
+	tests := []struct {
+		name        string
+		prune       bool // --prune
+		repoPrune   bool // prune: true in the config
+		want        string
+		wantKeeping bool
+	}{
+		{name: "disabled", want: ""},
+		{name: "flag", prune: true, want: "owned.proto sub/owned.proto", wantKeeping: true},
+		{name: "config", repoPrune: true, want: "owned.proto sub/owned.proto", wantKeeping: true},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		out := &bytes.Buffer{}
+		m.SetOutput(out)
+		m.SetPrune(tt.prune)
+		repo := &models.Repository{Name: "proto", TargetDirectory: t.TempDir(), Prune: tt.repoPrune}
+		if err := SaveManifest(&models.OwnershipManifest{
+			Repository:      repo.Name,
+			TargetDirectory: repo.TargetDirectory,
+			Files:           []string{"owned.proto", "sub/owned.proto", "other.proto"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := m.pruneEntries(repo, stale)
+		if err != nil {
+			t.Fatalf("%s: pruneEntries() failed: %v", tt.name, err)
+		}
+		if got := entryPaths(entries); got != tt.want {
+			t.Errorf("%s: pruned %q, want %q", tt.name, got, tt.want)
+		}
+		if keeping := strings.Contains(out.String(), "Keeping hand.proto: not owned by proto"); keeping != tt.wantKeeping {
+			t.Errorf("%s: output %q, want the unowned file reported: %v", tt.name, out, tt.wantKeeping)
+		}
+	}
+}
+
+func TestSyncedFiles(t *testing.T) {
+	m := newTestManager(t)
+	repo := &models.Repository{Name: "proto", TargetDirectory: t.TempDir()}
+
+	// Nothing recorded yet
+	synced, err := m.syncedFiles(repo)
+	if err != nil || len(synced) != 0 {
+		t.Fatalf("syncedFiles() without lockfile or history = %v, %v", synced, err)
+	}
+
+	if err := SaveLock(repo.TargetDirectory, &models.LockFile{Repositories: []models.LockEntry{
+		{Name: "proto", Files: map[string]string{"locked.proto": sha256Hex("l"), "removed.proto": sha256Hex("r")}},
+		{Name: "other", Files: map[string]string{"other.proto": sha256Hex("o")}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// History is stored newest first
+	now := time.Now()
+	histories := []models.SyncHistory{
+		{Repository: "proto", Timestamp: now.Add(-4 * time.Hour), Success: true, FileChanges: []models.FileChange{
+			{Path: "first.proto", ChangeType: models.ChangeTypeAdded},
+			{Path: "readded.proto", ChangeType: models.ChangeTypeAdded},
+		}},
+		{Repository: "proto", Timestamp: now.Add(-3 * time.Hour), Success: true, FileChanges: []models.FileChange{
+			{Path: "readded.proto", ChangeType: models.ChangeTypeDeleted},
+			{Path: "removed.proto", ChangeType: models.ChangeTypeDeleted},
+		}},
+		{Repository: "proto", Timestamp: now.Add(-2 * time.Hour), Success: true, FileChanges: []models.FileChange{
+			{Path: "readded.proto", ChangeType: models.ChangeTypeModified},
+			{Path: "sub/unchanged.proto", ChangeType: models.ChangeTypeUnchanged},
+		}},
+		{Repository: "proto", Timestamp: now.Add(-time.Hour), RolledBack: true, FileChanges: []models.FileChange{
+			{Path: "rolled-back.proto", ChangeType: models.ChangeTypeAdded},
+			{Path: "first.proto", ChangeType: models.ChangeTypeDeleted},
+		}},
+		{Repository: "proto", Timestamp: now, Cancelled: true, FileChanges: []models.FileChange{
+			{Path: "cancelled.proto", ChangeType: models.ChangeTypeAdded},
+		}},
+		{Repository: "other", Timestamp: now, Success: true, FileChanges: []models.FileChange{
+			{Path: "theirs.proto", ChangeType: models.ChangeTypeAdded},
+		}},
+	}
+	for _, history := range histories {
+		if err := AddHistory(history); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	synced, err = m.syncedFiles(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := setPaths(synced), "first.proto locked.proto readded.proto sub/unchanged.proto"; got != want {
+		t.Errorf("synced = %q, want %q", got, want)
+	}
+
+	// Ownership falls back to the synced files until a manifest for the target exists
+	owned, err := m.ownedFiles(repo)
+	if err != nil || !owned["locked.proto"] || !owned["first.proto"] || owned["theirs.proto"] {
+		t.Errorf("ownedFiles() without a manifest = %v, %v", owned, err)
+	}
+	if err := SaveManifest(&models.OwnershipManifest{Repository: repo.Name, TargetDirectory: repo.TargetDirectory, Files: []string{"manifest.proto"}}); err != nil {
+		t.Fatal(err)
+	}
+	owned, err = m.ownedFiles(repo)
+	if err != nil || len(owned) != 1 || !owned["manifest.proto"] {
+		t.Errorf("ownedFiles() with a manifest = %v, %v", owned, err)
+	}
+}
+
+func TestPruneWithoutUpstreamFiles(t *testing.T) {
+	m := newTestManager(t)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/sub/b.proto": "b1", "api/README.md": "readme"})
+	repo := syncedRepo(t, u)
+	syncAll(t, m, repo)
+	writeFiles(t, repo.TargetDirectory, map[string]string{"hand.proto": "hand written"})
+
+	// Every matching file is removed upstream, so no file is selected
+	u.commit(nil, "api/a.proto", "api/sub/b.proto")
+
+	result := syncAll(t, m, repo)
+	if got := changeList(result.Changes); got != "" {
+		t.Errorf("sync without --prune changed %s", got)
+	}
+	if got := readTarget(t, repo, "a.proto"); got != "a1" {
+		t.Errorf("a.proto = %q without --prune", got)
+	}
+
+	m.SetPrune(true)
+	result = syncAll(t, m, repo)
+	if got, want := changeList(result.Changes), "deleted a.proto, deleted sub/b.proto"; got != want {
+		t.Errorf("pruned %s, want %s", got, want)
+	}
+	for path, want := range map[string]string{"a.proto": "<missing>", "sub/b.proto": "<missing>", "hand.proto": "hand written"} {
+		if got := readTarget(t, repo, path); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// setPaths returns the sorted paths of a set
+func setPaths(paths map[string]bool) string {
+	var list []string
+	for path := range paths {
+		list = append(list, path)
+	}
+	sort.Strings(list)
+	return strings.Join(list, " ")
+}
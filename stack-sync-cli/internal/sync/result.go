@@ -0,0 +1,49 @@
+package sync
+
+import "github.com/stackfilesync/stack-sync-cli/pkg/models"
+
+// SyncResult describes what a sync run did to the target directory
+type SyncResult struct {
+	Repository string
+	Commit     string              // commit the files were synced from
+	Changes    []models.FileChange // files added, modified or deleted in the target
+	Conflicts  []string            // unowned target files that were left alone
+	LocalEdits []LocalEdit         // files edited locally since the last sync
+	DryRun     bool                // Changes were only planned, nothing was written
+}
+
+// LocalEdit is a target file edited locally since the last sync and how it was resolved
+type LocalEdit struct {
+	Path       string
+	Resolution string // keep-local, take-remote or merge
+	Conflicted bool   // merged with conflict markers that need manual resolution
+}
+
+// HasChanges reports whether the sync wrote anything to the target directory
+func (r *SyncResult) HasChanges() bool {
+	if r == nil {
+		return false
+	}
+	for _, change := range r.Changes {
+		if change.ChangeType != models.ChangeTypeUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// HasConflicts reports whether files were left alone or merged with conflict markers
+func (r *SyncResult) HasConflicts() bool {
+	if r == nil {
+		return false
+	}
+	if len(r.Conflicts) > 0 {
+		return true
+	}
+	for _, edit := range r.LocalEdits {
+		if edit.Conflicted {
+			return true
+		}
+	}
+	return false
+}
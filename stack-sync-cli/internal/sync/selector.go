@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AllSelector selects every matching file without prompting
+type AllSelector struct{}
+
+// Select implements Selector
+func (AllSelector) Select(m *Manager, plan *Plan) ([]PlanEntry, error) {
+	files := candidateFiles(m, plan, "")
+	if len(files) == 0 {
+		return m.selectFiles(plan, nil)
+	}
+	fmt.Fprintf(m.out, "Selecting all %d files\n", len(files))
+	return m.selectFiles(plan, files)
+}
+
+// InteractiveSelector lets the user pick files with the keyboard or by number,
+// optionally from files matching a keyword. In non-interactive mode every
+// candidate is selected.
+type InteractiveSelector struct {
+	Keyword string // pre-filter, selection modes stay available
+}
+
+// Select implements Selector
+func (s InteractiveSelector) Select(m *Manager, plan *Plan) ([]PlanEntry, error) {
+	files := candidateFiles(m, plan, s.Keyword)
+	if len(files) == 0 {
+		return m.selectFiles(plan, nil)
+	}
+	if s.Keyword != "" {
+		fmt.Fprintln(m.out, "You can still use interactive selection modes (keyboard, number, etc.)")
+	}
+
+	selected, err := m.selectFilesToSync(files, plan.SourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("file selection cancelled: %w", err)
+	}
+	return m.selectFiles(plan, selected)
+}
+
+// NumberSelector selects files by their numbers in the listing, like "77,93"
+// or "1-5", optionally from files matching a keyword
+type NumberSelector struct {
+	Keyword   string
+	Selection string
+}
+
+// Select implements Selector
+func (s NumberSelector) Select(m *Manager, plan *Plan) ([]PlanEntry, error) {
+	files := candidateFiles(m, plan, s.Keyword)
+	if len(files) == 0 {
+		return m.selectFiles(plan, nil)
+	}
+
+	selected, err := m.selectFilesWithNumberSelection(files, plan.SourcePath, s.Selection)
+	if err != nil {
+		return nil, fmt.Errorf("file selection failed: %w", err)
+	}
+	return m.selectFiles(plan, selected)
+}
+
+// DiffSelector previews the diff of every changed file, including target
+// files gone upstream, and lets the user choose which changes to apply
+type DiffSelector struct{}
+
+// Select implements Selector
+func (DiffSelector) Select(m *Manager, plan *Plan) ([]PlanEntry, error) {
+	var changed []PlanEntry
+	for _, entry := range plan.Entries {
+		if entry.Status != "=" {
+			changed = append(changed, entry)
+		}
+	}
+	changed = append(changed, plan.Stale...)
+	sort.Slice(changed, func(i, j int) bool {
+		return changed[i].Path < changed[j].Path
+	})
+
+	if len(changed) == 0 {
+		fmt.Fprintln(m.out, "No changes detected between remote and local. Up to date.")
+		return nil, nil
+	}
+
+	selected, cancelled, err := m.previewDiffAndSelect(changed, plan.SourcePath, plan.Repository.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if cancelled {
+		fmt.Fprintln(m.out, "Diff preview cancelled. No files were synced.")
+		return nil, nil
+	}
+	if len(selected) == 0 {
+		fmt.Fprintln(m.out, "No files selected after diff preview. Nothing to sync.")
+	}
+	return selected, nil
+}
+
+// candidateFiles returns the files a file selector chooses from: every
+// matching source file, narrowed by keyword if one is given
+func candidateFiles(m *Manager, plan *Plan, keyword string) []string {
+	if len(plan.Files) == 0 {
+		fmt.Fprintf(m.out, "No files found matching patterns: %v\n", plan.Repository.FilePatterns)
+		return nil
+	}
+	fmt.Fprintf(m.out, "Found %d files to sync:\n", len(plan.Files))
+
+	if keyword == "" {
+		return plan.Files
+	}
+	files := m.preFilterFilesByKeyword(plan.Files, keyword)
+	if len(files) == 0 {
+		fmt.Fprintf(m.out, "No files found matching filter keyword: %s\n", keyword)
+		return nil
+	}
+	fmt.Fprintf(m.out, "Pre-filtered to %d files matching '%s'\n", len(files), keyword)
+	return files
+}
@@ -0,0 +1,175 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/git"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// syncSource is a checked out copy of the remote repository used as sync input
+type syncSource struct {
+	workDir  string // root of the checkout (temp directory)
+	path     string // workDir joined with the repository's SourceDirectory
+	strategy string // clone strategy that produced the checkout
+	commit   string // commit the checkout was made from
+	resolved string // what the configured branch or ref resolved to, for display
+	locked   bool   // checkout reproduces the lockfile, which is left untouched
+}
+
+// shortCommit returns the abbreviated commit hash of the checkout
+func (s *syncSource) shortCommit() string {
+	if len(s.commit) > 8 {
+		return s.commit[:8]
+	}
+	return s.commit
+}
+
+// prepareSource fetches the repository and checks out the configured branch or ref into a temp directory.
+// The returned cleanup function removes the temp directory and is safe to call on error.
+// Cloning and fetching stop when ctx is cancelled or the repository's network timeout expires.
+func (m *Manager) prepareSource(ctx context.Context, repo *models.Repository) (*syncSource, func(), error) {
+	tempDir, err := os.MkdirTemp("", "stack-sync-*")
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tempDir) }
+
+	source := &syncSource{
+		workDir:  tempDir,
+		strategy: repo.CloneStrategy,
+		resolved: repo.Branch,
+	}
+
+	// An explicit clone strategy other than mirror bypasses the cache
+	if source.strategy == "" && m.config.Settings.CacheEnabled {
+		source.strategy = models.CloneStrategyMirror
+	}
+
+	tr, err := m.transport(repo)
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	netCtx, cancel := withTimeout(ctx, repo.NetworkTimeout)
+	defer cancel()
+	if source.strategy == models.CloneStrategyMirror {
+		err = m.checkoutFromCache(netCtx, repo, tr, source)
+	} else {
+		err = m.checkoutFromClone(netCtx, repo, tr, source)
+	}
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(netCtx.Err(), context.DeadlineExceeded) {
+			return nil, cleanup, fmt.Errorf("network timeout of %s exceeded: %w", repo.NetworkTimeout, err)
+		}
+		return nil, cleanup, err
+	}
+
+	if repo.Ref != "" {
+		fmt.Fprintf(m.out, "Resolved ref %s -> %s\n", repo.Ref, source.resolved)
+	}
+
+	// Determine source path
+	source.path = tempDir
+	if repo.SourceDirectory != "" {
+		source.path = filepath.Join(tempDir, repo.SourceDirectory)
+	}
+
+	// Check if source directory exists
+	if _, err := os.Stat(source.path); os.IsNotExist(err) {
+		return nil, cleanup, fmt.Errorf("source directory does not exist: %s", repo.SourceDirectory)
+	}
+
+	return source, cleanup, nil
+}
+
+// checkoutFromClone clones the repository straight into the temp directory
+// and records the clone strategy that was actually used
+func (m *Manager) checkoutFromClone(ctx context.Context, repo *models.Repository, tr *git.Transport, source *syncSource) error {
+	var pin *git.Pin
+	if repo.Ref != "" {
+		var err error
+		pin, err = git.ResolvePin(ctx, repo, tr)
+		if err != nil {
+			return fmt.Errorf("failed to resolve ref %s: %w", repo.Ref, err)
+		}
+	}
+
+	fmt.Fprintf(m.out, "Cloning %s @ %s to temp directory...\n", repo.URL, repo.GetRevision())
+	ops, err := git.CloneContext(ctx, repo, source.workDir, pin, tr, m.out)
+	if err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+	source.strategy = ops.Strategy()
+
+	if pin != nil && ops.Strategy() == models.CloneStrategyFull {
+		fmt.Fprintf(m.out, "Checking out ref: %s\n", repo.Ref)
+		if _, err := ops.CheckoutPin(pin); err != nil {
+			return err
+		}
+	} else if ops.Strategy() == models.CloneStrategyFull && repo.Branch != "" && repo.Branch != "main" && repo.Branch != "master" {
+		// Branch-limited strategies already cloned the configured branch or pin
+		fmt.Fprintf(m.out, "Checking out branch: %s\n", repo.Branch)
+		if err := ops.CheckoutBranch(repo.Branch); err != nil {
+			return fmt.Errorf("failed to checkout branch %s: %w", repo.Branch, err)
+		}
+	}
+
+	hash, err := ops.HeadHash()
+	if err != nil {
+		return fmt.Errorf("failed to resolve checked out commit: %w", err)
+	}
+	source.commit = hash.String()
+
+	if pin != nil {
+		pin.Hash = hash
+		source.resolved = pin.String()
+	}
+
+	return nil
+}
+
+// checkoutFromCache updates the cached mirror and extracts the branch or ref into the temp directory
+func (m *Manager) checkoutFromCache(ctx context.Context, repo *models.Repository, tr *git.Transport, source *syncSource) error {
+	mirror, err := git.OpenMirror(ctx, repo, git.MirrorPath(m.config.GetCacheDir(), repo.Name), tr, m.out)
+	if err != nil {
+		return fmt.Errorf("failed to update cache: %w", err)
+	}
+
+	if repo.Ref != "" {
+		pin, err := mirror.ResolvePin(repo.Ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve ref %s: %w", repo.Ref, err)
+		}
+		source.commit = pin.Hash.String()
+		source.resolved = pin.String()
+	} else {
+		hash, err := mirror.ResolveBranch(repo.Branch)
+		if err != nil {
+			return err
+		}
+		source.commit = hash.String()
+	}
+
+	fmt.Fprintf(m.out, "Extracting %s @ %s (%s) from cache...\n", repo.Name, repo.GetRevision(), source.shortCommit())
+	return mirror.Extract(git.NewHash(source.commit), repo.SourceDirectory, source.workDir)
+}
+
+// transport resolves how to reach a repository's remote, with the global
+// proxy and TLS settings as defaults
+func (m *Manager) transport(repo *models.Repository) (*git.Transport, error) {
+	return git.NewTransport(repo, m.config.Settings.NetworkConfig)
+}
+
+// withTimeout bounds ctx by timeout; zero means no limit
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,194 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stageDirPattern names the staging directory created next to the target
+const stageDirPattern = ".stack-sync-stage-*"
+
+// isStageDir reports whether a relative path lies in a staging directory,
+// either one left inside a target by older versions or the stage of a target
+// nested in the scanned directory
+func isStageDir(relPath string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if matched, _ := filepath.Match(".*"+stageDirPattern[1:], part); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// stagedOp is a single staged write or deletion
+type stagedOp struct {
+	path    string // relative to the target directory
+	delete  bool
+	hadOld  bool     // an existing file was moved aside and must be restored on rollback
+	applied bool     // the op has been swapped into the target
+	dirs    []string // directories created for the op, innermost last
+}
+
+// stagedApply writes a changeset into a staging directory on the target's
+// filesystem and swaps it in with renames. Replaced and deleted files are
+// moved aside so the whole changeset can be rolled back.
+type stagedApply struct {
+	targetDir string
+	stageDir  string
+	ops       []*stagedOp
+}
+
+// newStagedApply creates the staging directory next to the target directory,
+// so renames stay on its filesystem while post-sync hooks never see the stage
+func newStagedApply(targetDir string) (*stagedApply, error) {
+	targetDir = filepath.Clean(targetDir)
+	stageDir, err := os.MkdirTemp(filepath.Dir(targetDir), "."+filepath.Base(targetDir)+stageDirPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return &stagedApply{targetDir: targetDir, stageDir: stageDir}, nil
+}
+
+// newPath is where the staged content of a file lives
+func (s *stagedApply) newPath(path string) string {
+	return filepath.Join(s.stageDir, "new", path)
+}
+
+// oldPath is where the previous content of a file is kept until finish
+func (s *stagedApply) oldPath(path string) string {
+	return filepath.Join(s.stageDir, "old", path)
+}
+
+// stageFile stages a copy of src to be written to path
+func (s *stagedApply) stageFile(path, src string, copyFile func(src, dst string) error) error {
+	dst := s.newPath(path)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	if err := copyFile(src, dst); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	s.ops = append(s.ops, &stagedOp{path: path})
+	return nil
+}
+
+// stageData stages content to be written to path
+func (s *stagedApply) stageData(path string, data []byte, perm os.FileMode) error {
+	dst := s.newPath(path)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	if err := os.WriteFile(dst, data, perm); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	s.ops = append(s.ops, &stagedOp{path: path})
+	return nil
+}
+
+// stageDelete stages the removal of path
+func (s *stagedApply) stageDelete(path string) {
+	s.ops = append(s.ops, &stagedOp{path: path, delete: true})
+}
+
+// commit swaps every staged op into the target. On failure the ops applied so
+// far are rolled back before the error is returned.
+func (s *stagedApply) commit() error {
+	for _, op := range s.ops {
+		if err := s.apply(op); err != nil {
+			if rbErr := s.rollback(); rbErr != nil {
+				return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// apply swaps a single op into the target
+func (s *stagedApply) apply(op *stagedOp) error {
+	target := filepath.Join(s.targetDir, op.path)
+
+	if _, err := os.Lstat(target); err == nil {
+		old := s.oldPath(op.path)
+		if err := os.MkdirAll(filepath.Dir(old), 0755); err != nil {
+			return fmt.Errorf("failed to move aside %s: %w", op.path, err)
+		}
+		if err := os.Rename(target, old); err != nil {
+			return fmt.Errorf("failed to move aside %s: %w", op.path, err)
+		}
+		op.hadOld = true
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat %s: %w", op.path, err)
+	}
+	op.applied = true
+
+	if op.delete {
+		return nil
+	}
+
+	dirs, err := mkdirTracked(filepath.Dir(target))
+	op.dirs = dirs
+	if err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", op.path, err)
+	}
+	if err := os.Rename(s.newPath(op.path), target); err != nil {
+		return fmt.Errorf("failed to write %s: %w", op.path, err)
+	}
+	return nil
+}
+
+// rollback restores every applied op in reverse order and removes the staging directory
+func (s *stagedApply) rollback() error {
+	var firstErr error
+	for i := len(s.ops) - 1; i >= 0; i-- {
+		op := s.ops[i]
+		if !op.applied {
+			continue
+		}
+
+		target := filepath.Join(s.targetDir, op.path)
+		if !op.delete {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if op.hadOld {
+			if err := os.Rename(s.oldPath(op.path), target); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed to restore %s: %w", op.path, err)
+			}
+		}
+		for j := len(op.dirs) - 1; j >= 0; j-- {
+			os.Remove(op.dirs[j]) // only succeeds if nothing else was put there
+		}
+		op.applied = false
+	}
+
+	s.finish()
+	return firstErr
+}
+
+// finish discards the staging directory, keeping the applied changes
+func (s *stagedApply) finish() {
+	os.RemoveAll(s.stageDir)
+}
+
+// mkdirTracked creates dir and its missing parents and returns the directories it created
+func mkdirTracked(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append([]string{d}, missing...)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
@@ -0,0 +1,190 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// copyTestFile copies a file the way syncs stage source files
+func copyTestFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// listDir returns the entries of a directory
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestIsStageDir(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{".stack-sync-stage-123", true},
+		{".stack-sync-stage-123/new/a.proto", true},
+		{".proto.stack-sync-stage-123/old/a.proto", true},
+		{"sub/.nested.stack-sync-stage-9/new/a.proto", true},
+		{"stack-sync-stage-1", false},
+		{"a.proto", false},
+		{"api/a.proto", false},
+		{".stack-sync.lock", false},
+	}
+
+	for _, tt := range tests {
+		if got := isStageDir(filepath.FromSlash(tt.path)); got != tt.want {
+			t.Errorf("isStageDir(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestStagedApply(t *testing.T) {
+	original := map[string]string{"a.proto": "a1", "b.proto": "b1", "keep.proto": "keep"}
+
+	tests := []struct {
+		name string
+		// rollback undoes the changeset once it is committed
+		rollback bool
+		want     map[string]string
+	}{
+		{
+			name: "commit",
+			want: map[string]string{"a.proto": "a2", "b.proto": "<missing>", "new/c.proto": "c", "keep.proto": "keep"},
+		},
+		{
+			name:     "rollback",
+			rollback: true,
+			want:     map[string]string{"a.proto": "a1", "b.proto": "b1", "new/c.proto": "<missing>", "keep.proto": "keep"},
+		},
+	}
+
+	for _, tt := range tests {
+		parent := t.TempDir()
+		target := filepath.Join(parent, "target")
+		writeFiles(t, target, original)
+		src := t.TempDir()
+		writeFiles(t, src, map[string]string{"c.proto": "c"})
+
+		txn, err := newStagedApply(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isStageDir(filepath.Base(txn.stageDir)) || filepath.Dir(txn.stageDir) != parent {
+			t.Errorf("%s: staging directory %s is not a staging directory next to the target", tt.name, txn.stageDir)
+		}
+
+		if err := txn.stageData("a.proto", []byte("a2"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		txn.stageDelete("b.proto")
+		if err := txn.stageFile(filepath.Join("new", "c.proto"), filepath.Join(src, "c.proto"), copyTestFile); err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing reaches the target before commit
+		if got := len(listDir(t, target)); got != len(original) {
+			t.Errorf("%s: target has %d entries before commit, want %d", tt.name, got, len(original))
+		}
+
+		if err := txn.commit(); err != nil {
+			t.Fatalf("%s: commit() failed: %v", tt.name, err)
+		}
+		if tt.rollback {
+			if err := txn.rollback(); err != nil {
+				t.Fatalf("%s: rollback() failed: %v", tt.name, err)
+			}
+		} else {
+			txn.finish()
+		}
+
+		for path, want := range tt.want {
+			if got := readTarget(t, &models.Repository{TargetDirectory: target}, path); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, path, got, want)
+			}
+		}
+		if tt.rollback {
+			if _, err := os.Stat(filepath.Join(target, "new")); !os.IsNotExist(err) {
+				t.Errorf("%s: directory created for the changeset was left behind", tt.name)
+			}
+		}
+		if entries := listDir(t, parent); len(entries) != 1 {
+			t.Errorf("%s: staging directory left behind: %v", tt.name, entries)
+		}
+	}
+}
+
+func TestStagedApplyRollsBackFailedCommit(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "target")
+	writeFiles(t, target, map[string]string{"a.proto": "a1", "b.proto": "b1"})
+
+	txn, err := newStagedApply(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.stageData("a.proto", []byte("a2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	txn.stageDelete("b.proto")
+	if err := txn.stageData("c.proto", []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The last op fails: its staged content disappeared
+	if err := os.Remove(txn.newPath("c.proto")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := txn.commit(); err == nil {
+		t.Fatal("commit() should fail")
+	}
+
+	repo := &models.Repository{TargetDirectory: target}
+	for path, want := range map[string]string{"a.proto": "a1", "b.proto": "b1"} {
+		if got := readTarget(t, repo, path); got != want {
+			t.Errorf("%s = %q after a failed commit, want %q", path, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "c.proto")); !os.IsNotExist(err) {
+		t.Error("c.proto was written by a failed commit")
+	}
+	if _, err := os.Stat(txn.stageDir); !os.IsNotExist(err) {
+		t.Error("staging directory left behind after a failed commit")
+	}
+}
+
+func TestScanFilesSkipsStageDirs(t *testing.T) {
+	m := newTestManager(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.proto":                           "a",
+		"sub/b.proto":                       "b",
+		".stack-sync-stage-1/new/a.proto":   "leftover",
+		"sub/.x.stack-sync-stage-2/c.proto": "nested target stage",
+	})
+
+	files, err := m.scanFiles(context.Background(), dir, []string{"*.proto"}, nil)
+	if err != nil {
+		t.Fatalf("scanFiles() failed: %v", err)
+	}
+	sort.Strings(files)
+	if got, want := strings.Join(files, " "), "a.proto "+filepath.Join("sub", "b.proto"); got != want {
+		t.Errorf("scanFiles() = %v, want a.proto and sub/b.proto", files)
+	}
+}
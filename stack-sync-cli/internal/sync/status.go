@@ -0,0 +1,296 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stackfilesync/stack-sync-cli/internal/git"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// statusTimeout bounds the ls-remote of a status check for repositories
+// without network_timeout, so list never hangs on an unreachable remote
+const statusTimeout = 30 * time.Second
+
+// Where RemoteCommit was read from
+const (
+	RemoteSourceRemote = "remote" // ls-remote
+	RemoteSourceCache  = "cache"  // the cached mirror, as last fetched
+)
+
+// UpdateRepositoryStatus compares a repository's target directory with its
+// last sync and the remote head. Files edited or deleted locally since the
+// last sync and a remote that moved past the synced commit each make it
+// modified; both together are a conflict. When the mirror cache holds both
+// commits, only upstream changes to the synced files count, and a conflict
+// needs a file changed on both sides. Offline, the remote head is read from
+// the cached mirror, and without one only local edits are checked, as they
+// are for targets whose synced commit wasn't recorded.
+func (m *Manager) UpdateRepositoryStatus(ctx context.Context, repo *models.Repository) error {
+	repo.FilesTracked = 0
+	repo.FilesModified = 0
+	repo.ModifiedFiles = nil
+	repo.SyncedCommit = ""
+	repo.RemoteCommit = ""
+	repo.RemoteSource = ""
+
+	if _, err := os.Stat(repo.TargetDirectory); os.IsNotExist(err) {
+		repo.Status = models.StatusNotCloned
+		return nil
+	}
+
+	synced, err := m.lastSynced(repo)
+	if err != nil {
+		repo.Status = models.StatusError
+		return err
+	}
+	repo.SyncedCommit = synced
+
+	edited, tracked, err := m.localEdits(repo)
+	if err != nil {
+		repo.Status = models.StatusError
+		return err
+	}
+	repo.FilesTracked = tracked
+	repo.ModifiedFiles = edited
+	repo.FilesModified = len(edited)
+
+	if synced == "" {
+		// Without a synced commit the remote can't be compared, only the
+		// files synced into the target, if there are any
+		switch {
+		case tracked == 0:
+			repo.Status = models.StatusNotCloned
+		case len(edited) > 0:
+			repo.Status = models.StatusModified
+		default:
+			repo.Status = models.StatusUpToDate
+		}
+		return nil
+	}
+
+	remote, mirror, err := m.remoteHead(ctx, repo)
+	if err != nil {
+		repo.Status = models.StatusError
+		return err
+	}
+
+	changed := remote != "" && !sameCommit(remote, synced)
+	var upstream map[string]bool
+	if changed && mirror != nil && len(remote) == 40 {
+		files, err := mirror.ChangedFiles(plumbing.NewHash(synced), plumbing.NewHash(remote), repo.SourceDirectory)
+		if err == nil {
+			upstream = map[string]bool{}
+			for _, file := range files {
+				if m.matchesPatterns(file, repo.FilePatterns) && !m.shouldExclude(file, repo.ExcludePatterns) {
+					upstream[file] = true
+				}
+			}
+			changed = len(upstream) > 0
+		}
+	}
+
+	switch {
+	case changed && conflicting(edited, upstream):
+		repo.Status = models.StatusConflict
+	case changed || len(edited) > 0:
+		repo.Status = models.StatusModified
+	default:
+		repo.Status = models.StatusUpToDate
+	}
+	return nil
+}
+
+// UpdateAllStatuses updates the status of all repositories
+func (m *Manager) UpdateAllStatuses(ctx context.Context) error {
+	failed := 0
+	for i := range m.config.Repositories {
+		if err := m.UpdateRepositoryStatus(ctx, &m.config.Repositories[i]); err != nil {
+			fmt.Fprintf(m.out, "Warning: failed to update status for %s: %v\n",
+				m.config.Repositories[i].Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to update the status of %d repositories", failed)
+	}
+	return nil
+}
+
+// lastSynced returns the commit the target directory was last synced to, as
+// recorded by its lockfile or else by sync history, and sets LastSync
+func (m *Manager) lastSynced(repo *models.Repository) (string, error) {
+	histories, err := GetHistoryForRepository(repo.Name, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var commit string
+	for _, history := range histories {
+		if history.Success && history.Commit != "" {
+			timestamp := history.Timestamp
+			repo.LastSync = &timestamp
+			commit = history.Commit
+			break
+		}
+	}
+
+	if lock, err := LoadLock(repo.TargetDirectory); err == nil {
+		if entry := lock.GetEntry(repo.Name); entry != nil && entry.Commit != "" {
+			commit = entry.Commit
+		}
+	}
+	return commit, nil
+}
+
+// localEdits returns the synced files that were edited or deleted in the
+// target directory since the last sync, and how many files are synced
+func (m *Manager) localEdits(repo *models.Repository) ([]string, int, error) {
+	owned, err := m.ownedFiles(repo)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lockHashes := map[string]string{}
+	if lock, err := LoadLock(repo.TargetDirectory); err == nil {
+		if entry := lock.GetEntry(repo.Name); entry != nil {
+			lockHashes = entry.Files
+		}
+	}
+	baseDir := GetBaseDir(repo.Name)
+
+	edited := []string{}
+	for file := range owned {
+		local := filepath.Join(repo.TargetDirectory, filepath.FromSlash(file))
+		if _, err := os.Stat(local); os.IsNotExist(err) {
+			edited = append(edited, file)
+			continue
+		}
+
+		changed, _, err := locallyEdited(local, filepath.Join(baseDir, filepath.FromSlash(file)), lockHashes[file])
+		if err != nil {
+			return nil, 0, err
+		}
+		if changed {
+			edited = append(edited, file)
+		}
+	}
+
+	sort.Strings(edited)
+	return edited, len(owned), nil
+}
+
+// remoteHead returns the commit the repository's branch or ref points to on
+// the remote, or in the cached mirror when offline, and the mirror if one is
+// cached. Offline without a mirror the head is unknown and "" is returned.
+// A commit SHA pin that can't be resolved yet is returned abbreviated.
+func (m *Manager) remoteHead(ctx context.Context, repo *models.Repository) (string, *git.Mirror, error) {
+	mirror, err := git.OpenCachedMirror(repo, git.MirrorPath(m.config.GetCacheDir(), repo.Name))
+	if err != nil {
+		mirror = nil
+	}
+
+	var refs []*plumbing.Reference
+	if m.offline {
+		if mirror == nil {
+			return "", nil, nil
+		}
+		refs, err = mirror.References()
+		if err != nil {
+			return "", nil, err
+		}
+		repo.RemoteSource = RemoteSourceCache
+	} else {
+		tr, err := m.transport(repo)
+		if err != nil {
+			return "", nil, err
+		}
+
+		timeout := repo.NetworkTimeout
+		if timeout <= 0 {
+			timeout = statusTimeout
+		}
+		listCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		refs, err = git.ListRemoteRefs(listCtx, repo, tr)
+		if err != nil {
+			return "", nil, err
+		}
+		repo.RemoteSource = RemoteSourceRemote
+	}
+
+	commit, err := headCommit(repo, refs)
+	if err != nil {
+		return "", nil, err
+	}
+	repo.RemoteCommit = commit
+	return commit, mirror, nil
+}
+
+// headCommit resolves the repository's ref, or else its branch, against refs
+func headCommit(repo *models.Repository, refs []*plumbing.Reference) (string, error) {
+	if repo.Ref != "" {
+		pin, err := git.ResolvePinFrom(repo.Ref, refs)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve ref %s: %w", repo.Ref, err)
+		}
+		if pin.Hash.IsZero() {
+			return strings.ToLower(pin.Short), nil
+		}
+		return pin.Hash.String(), nil
+	}
+
+	if repo.Branch != "" {
+		name := plumbing.NewBranchReferenceName(repo.Branch)
+		for _, ref := range refs {
+			if ref.Name() == name {
+				return ref.Hash().String(), nil
+			}
+		}
+		return "", fmt.Errorf("branch not found on remote: %s", repo.Branch)
+	}
+
+	// The remote's HEAD, which a mirror keeps as a symbolic reference
+	for _, ref := range refs {
+		if ref.Name() != plumbing.HEAD {
+			continue
+		}
+		if ref.Type() == plumbing.HashReference {
+			return ref.Hash().String(), nil
+		}
+		for _, target := range refs {
+			if target.Name() == ref.Target() {
+				return target.Hash().String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("remote has no HEAD")
+}
+
+// sameCommit compares two commit hashes, either of which may be abbreviated
+func sameCommit(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a != "" && strings.HasPrefix(b, a)
+}
+
+// conflicting reports whether local edits overlap upstream changes. Without
+// knowing which files changed upstream, any local edit may conflict.
+func conflicting(edited []string, upstream map[string]bool) bool {
+	if upstream == nil {
+		return len(edited) > 0
+	}
+	for _, file := range edited {
+		if upstream[file] {
+			return true
+		}
+	}
+	return false
+}
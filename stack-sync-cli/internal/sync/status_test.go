@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/git"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// status updates and returns the status of repo
+func status(t *testing.T, m *Manager, repo *models.Repository) models.SyncStatus {
+	t.Helper()
+	if err := m.UpdateRepositoryStatus(context.Background(), repo); err != nil {
+		t.Fatalf("status of %s failed: %v", repo.Name, err)
+	}
+	return repo.Status
+}
+
+// fetchMirror brings the cached mirror of repo up to date with its remote
+func fetchMirror(t *testing.T, m *Manager, repo *models.Repository) {
+	t.Helper()
+	if _, err := git.OpenMirror(context.Background(), repo, git.MirrorPath(m.config.GetCacheDir(), repo.Name), nil, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusWithoutRecordedCommit(t *testing.T) {
+	m := newTestManager(t)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"})
+	repo := syncedRepo(t, u)
+
+	if got := status(t, m, repo); got != models.StatusNotCloned {
+		t.Errorf("status without a target = %s", got)
+	}
+	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(t, m, repo); got != models.StatusNotCloned {
+		t.Errorf("status of a target nothing was synced into = %s", got)
+	}
+
+	// A sync whose commit was recorded neither in the lockfile nor in history
+	syncAll(t, m, repo)
+	if err := os.Remove(GetLockPath(repo.TargetDirectory)); err != nil {
+		t.Fatal(err)
+	}
+	store, err := LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range store.Histories {
+		store.Histories[i].Commit = ""
+	}
+	if err := SaveHistory(store); err != nil {
+		t.Fatal(err)
+	}
+
+	// The remote moved, but without a synced commit only files are compared
+	u.commit(map[string]string{"api/a.proto": "a2"})
+	if got := status(t, m, repo); got != models.StatusUpToDate || repo.FilesTracked != 2 || repo.RemoteCommit != "" {
+		t.Errorf("status of unedited files = %s, %d tracked, remote %q", got, repo.FilesTracked, repo.RemoteCommit)
+	}
+
+	writeFiles(t, repo.TargetDirectory, map[string]string{"b.proto": "edited"})
+	if got := status(t, m, repo); got != models.StatusModified || strings.Join(repo.ModifiedFiles, " ") != "b.proto" {
+		t.Errorf("status of an edited file = %s, modified %v", got, repo.ModifiedFiles)
+	}
+}
+
+func TestStatusAgainstRemote(t *testing.T) {
+	m := newTestManager(t)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"})
+	repo := syncedRepo(t, u)
+	synced := syncAll(t, m, repo).Commit
+
+	if got := status(t, m, repo); got != models.StatusUpToDate {
+		t.Errorf("status after a sync = %s", got)
+	}
+	if repo.SyncedCommit != synced || repo.RemoteCommit != synced || repo.RemoteSource != RemoteSourceRemote {
+		t.Errorf("synced %s, remote %s from %q, want both %s from the remote", repo.SyncedCommit, repo.RemoteCommit, repo.RemoteSource, synced)
+	}
+
+	writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "edited"})
+	if got := status(t, m, repo); got != models.StatusModified {
+		t.Errorf("status with a local edit = %s", got)
+	}
+
+	// Without a mirror, which files changed upstream is unknown, so any local
+	// edit conflicts with a moved remote
+	head := u.commit(map[string]string{"api/b.proto": "b2"})
+	if got := status(t, m, repo); got != models.StatusConflict || repo.RemoteCommit != head {
+		t.Errorf("status with a local edit and a moved remote = %s, remote %s, want %s", got, repo.RemoteCommit, head)
+	}
+
+	writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "a1"})
+	if got := status(t, m, repo); got != models.StatusModified || repo.FilesModified != 0 {
+		t.Errorf("status with a moved remote = %s, %d modified", got, repo.FilesModified)
+	}
+
+	repo.Branch = "missing"
+	if err := m.UpdateRepositoryStatus(context.Background(), repo); err == nil || repo.Status != models.StatusError {
+		t.Errorf("status of a missing branch = %s, %v", repo.Status, err)
+	}
+}
+
+func TestStatusWithMirror(t *testing.T) {
+	tests := []struct {
+		name    string
+		edited  map[string]string // local edits in the target
+		changed map[string]string // upstream changes
+		want    models.SyncStatus
+	}{
+		{name: "unsynced files changed", changed: map[string]string{"api/README.md": "docs", "other/c.proto": "c1"}, want: models.StatusUpToDate},
+		{name: "synced file changed", changed: map[string]string{"api/b.proto": "b2"}, want: models.StatusModified},
+		{name: "edit and unsynced files changed", edited: map[string]string{"a.proto": "edited"}, changed: map[string]string{"api/README.md": "docs"}, want: models.StatusModified},
+		{name: "edit and other synced file changed", edited: map[string]string{"a.proto": "edited"}, changed: map[string]string{"api/b.proto": "b2"}, want: models.StatusModified},
+		{name: "edited file changed", edited: map[string]string{"a.proto": "edited"}, changed: map[string]string{"api/a.proto": "a2"}, want: models.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		m.config.Settings.CacheEnabled = true
+		u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"})
+		repo := syncedRepo(t, u)
+		syncAll(t, m, repo)
+		writeFiles(t, repo.TargetDirectory, tt.edited)
+
+		u.commit(tt.changed)
+		fetchMirror(t, m, repo)
+		if got := status(t, m, repo); got != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusOffline(t *testing.T) {
+	// Without a mirror the remote head is unknown and only local edits count
+	m := newTestManager(t)
+	m.SetOffline(true)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1"})
+	repo := syncedRepo(t, u)
+	syncAll(t, m, repo)
+	u.commit(map[string]string{"api/a.proto": "a2"})
+	if got := status(t, m, repo); got != models.StatusUpToDate || repo.RemoteCommit != "" || repo.RemoteSource != "" {
+		t.Errorf("offline status without a mirror = %s, remote %q from %q", got, repo.RemoteCommit, repo.RemoteSource)
+	}
+	writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "edited"})
+	if got := status(t, m, repo); got != models.StatusModified {
+		t.Errorf("offline status with a local edit = %s", got)
+	}
+
+	// With one, the remote head is what the mirror last fetched
+	m = newTestManager(t)
+	m.config.Settings.CacheEnabled = true
+	m.SetOffline(true)
+	u = newUpstream(t, map[string]string{"api/a.proto": "a1"})
+	repo = syncedRepo(t, u)
+	synced := syncAll(t, m, repo).Commit
+
+	head := u.commit(map[string]string{"api/a.proto": "a2"})
+	if got := status(t, m, repo); got != models.StatusUpToDate || repo.RemoteCommit != synced || repo.RemoteSource != RemoteSourceCache {
+		t.Errorf("offline status before a fetch = %s, remote %s from %q, want %s from the cache", got, repo.RemoteCommit, repo.RemoteSource, synced)
+	}
+	fetchMirror(t, m, repo)
+	if got := status(t, m, repo); got != models.StatusModified || repo.RemoteCommit != head {
+		t.Errorf("offline status after a fetch = %s, remote %s, want %s", got, repo.RemoteCommit, head)
+	}
+}
@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stackfilesync/stack-sync-cli/internal/config"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// newTestManager creates a manager with a temporary home directory, so
+// manifests, history and backups stay out of the real one
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	m := NewManager(&config.Config{Settings: config.Settings{BackupEnabled: true, BackupDir: filepath.Join(home, "backups")}}, nil)
+	m.SetOutput(&bytes.Buffer{})
+	return m
+}
+
+// writeFiles creates files with the given content below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTarget returns the content of a target file, or "<missing>"
+func readTarget(t *testing.T, repo *models.Repository, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(repo.TargetDirectory, filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// entryPaths returns the sorted paths of plan entries
+func entryPaths(entries []PlanEntry) string {
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, filepath.ToSlash(entry.Path))
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, " ")
+}
+
+// sha256Hex returns the hex encoded SHA-256 of content
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// upstream is a local git repository standing in for a repository's remote
+type upstream struct {
+	t       *testing.T
+	dir     string
+	repo    *gogit.Repository
+	commits int
+}
+
+// newUpstream creates a repository on branch main with files committed
+func newUpstream(t *testing.T, files map[string]string) *upstream {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := gogit.PlainInitWithOptions(dir, &gogit.PlainInitOptions{InitOptions: gogit.InitOptions{DefaultBranch: plumbing.Main}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &upstream{t: t, dir: dir, repo: repo}
+	u.commit(files)
+	return u
+}
+
+// commit writes files, removes deleted ones and commits the result
+func (u *upstream) commit(files map[string]string, deleted ...string) string {
+	u.t.Helper()
+	writeFiles(u.t, u.dir, files)
+	for _, path := range deleted {
+		if err := os.Remove(filepath.Join(u.dir, filepath.FromSlash(path))); err != nil {
+			u.t.Fatal(err)
+		}
+	}
+
+	w, err := u.repo.Worktree()
+	if err != nil {
+		u.t.Fatal(err)
+	}
+	if err := w.AddWithOptions(&gogit.AddOptions{All: true}); err != nil {
+		u.t.Fatal(err)
+	}
+	u.commits++
+	hash, err := w.Commit("change", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(int64(1700000000+u.commits), 0)},
+	})
+	if err != nil {
+		u.t.Fatal(err)
+	}
+	return hash.String()
+}
+
+// syncedRepo returns a repository syncing the .proto files of u's api
+// directory into a target directory that doesn't exist yet
+func syncedRepo(t *testing.T, u *upstream) *models.Repository {
+	return &models.Repository{
+		Name:            "proto",
+		URL:             u.dir,
+		Branch:          "main",
+		SourceDirectory: "api",
+		TargetDirectory: filepath.Join(t.TempDir(), "target"),
+		FilePatterns:    []string{"*.proto"},
+	}
+}
+
+// syncAll syncs every matching file of repo without prompts
+func syncAll(t *testing.T, m *Manager, repo *models.Repository) *SyncResult {
+	t.Helper()
+	m.SetNonInteractive(true)
+	result, err := m.SyncRepositoryWith(context.Background(), repo, AllSelector{})
+	if err != nil {
+		t.Fatalf("sync of %s failed: %v", repo.Name, err)
+	}
+	return result
+}
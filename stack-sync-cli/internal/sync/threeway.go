@@ -0,0 +1,285 @@
+package sync
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// GetBaseDir returns the directory holding the last synced content of a repository,
+// the base of the three-way comparison between local and remote files
+func GetBaseDir(repoName string) string {
+	name := unsafeManifestChars.ReplaceAllString(repoName, "_")
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".stack-sync", "base", name)
+	}
+	return filepath.Join(homeDir, ".stack-sync", "base", name)
+}
+
+// resolveLocalEdits finds files edited locally since the last sync. Files only
+// edited locally keep their edits; files also changed upstream are resolved
+// according to the conflict strategy. Edited files removed upstream are only
+// pruned with take-remote. Entries that should not be copied from the remote
+// are dropped; merges are staged later by stageMerges. Prompts read answers
+// from input.
+func (m *Manager) resolveLocalEdits(repo *models.Repository, sourcePath string, entries []PlanEntry, input *bufio.Reader) ([]PlanEntry, []LocalEdit, error) {
+	lockHashes := map[string]string{}
+	if lock, err := LoadLock(repo.TargetDirectory); err == nil {
+		if entry := lock.GetEntry(repo.Name); entry != nil {
+			lockHashes = entry.Files
+		}
+	}
+	baseDir := GetBaseDir(repo.Name)
+
+	var remaining []PlanEntry
+	var edits []LocalEdit
+	for _, entry := range entries {
+		if entry.Status != "M" && entry.Status != "D" {
+			remaining = append(remaining, entry)
+			continue
+		}
+
+		path := filepath.ToSlash(entry.Path)
+		local := filepath.Join(repo.TargetDirectory, entry.Path)
+		remote := filepath.Join(sourcePath, entry.Path)
+		base := filepath.Join(baseDir, entry.Path)
+
+		if entry.Status == "D" {
+			edited, _, err := locallyEdited(local, base, lockHashes[path])
+			if err != nil {
+				return nil, nil, err
+			}
+			if !edited {
+				remaining = append(remaining, entry)
+				continue
+			}
+			if m.conflictStrategy(repo) == models.OnConflictTakeRemote {
+				fmt.Fprintf(m.out, "Deleting %s despite local edits (removed upstream)\n", path)
+				edits = append(edits, LocalEdit{Path: path, Resolution: models.OnConflictTakeRemote})
+				remaining = append(remaining, entry)
+				continue
+			}
+			fmt.Fprintf(m.out, "Keeping local edits in %s (removed upstream)\n", path)
+			edits = append(edits, LocalEdit{Path: path, Resolution: models.OnConflictKeepLocal})
+			continue
+		}
+
+		if same, err := sameContent(local, remote); err != nil {
+			return nil, nil, err
+		} else if same {
+			remaining = append(remaining, entry)
+			continue
+		}
+
+		edited, hasBase, err := locallyEdited(local, base, lockHashes[path])
+		if err != nil {
+			return nil, nil, err
+		}
+		if !edited {
+			remaining = append(remaining, entry)
+			continue
+		}
+
+		// Only the local side changed: nothing upstream to bring in
+		if hasBase {
+			if same, err := sameContent(remote, base); err != nil {
+				return nil, nil, err
+			} else if same {
+				fmt.Fprintf(m.out, "Keeping local edits in %s (unchanged upstream)\n", path)
+				edits = append(edits, LocalEdit{Path: path, Resolution: models.OnConflictKeepLocal})
+				continue
+			}
+		}
+
+		resolution, err := m.conflictResolution(repo, entry, sourcePath, input)
+		if err != nil {
+			return nil, nil, err
+		}
+		edits = append(edits, LocalEdit{Path: path, Resolution: resolution})
+
+		switch resolution {
+		case models.OnConflictTakeRemote:
+			fmt.Fprintf(m.out, "Overwriting local edits in %s with the remote version\n", path)
+			remaining = append(remaining, entry)
+		case models.OnConflictMerge:
+			fmt.Fprintf(m.out, "Merging local edits in %s with the remote version\n", path)
+		default:
+			fmt.Fprintf(m.out, "Keeping local edits in %s (changed upstream too)\n", path)
+		}
+	}
+
+	return remaining, edits, nil
+}
+
+// locallyEdited reports whether a target file differs from the last synced
+// content. Without a base snapshot the lockfile hash is used instead.
+func locallyEdited(local, base, lockHash string) (edited bool, hasBase bool, err error) {
+	if _, err := os.Stat(base); err == nil {
+		same, err := sameContent(local, base)
+		return !same, true, err
+	}
+
+	if lockHash == "" {
+		// Synced before base snapshots existed and never locked: assume untouched
+		return false, false, nil
+	}
+
+	hash, err := hashFile(local)
+	if err != nil {
+		return false, false, err
+	}
+	return hash != lockHash, false, nil
+}
+
+// conflictStrategy returns the --on-conflict flag, else the repository's
+// on_conflict, else ask
+func (m *Manager) conflictStrategy(repo *models.Repository) string {
+	if m.onConflict != "" {
+		return m.onConflict
+	}
+	if repo.OnConflict != "" {
+		return repo.OnConflict
+	}
+	return models.OnConflictAsk
+}
+
+// conflictResolution picks how to resolve a file edited on both sides:
+// the --on-conflict flag, then the repository's on_conflict, then a prompt
+// answered from input
+func (m *Manager) conflictResolution(repo *models.Repository, entry PlanEntry, sourcePath string, input *bufio.Reader) (string, error) {
+	strategy := m.conflictStrategy(repo)
+
+	if strategy != models.OnConflictAsk {
+		return strategy, nil
+	}
+	if m.nonInteractive {
+		return models.OnConflictKeepLocal, nil
+	}
+
+	for {
+		fmt.Fprintf(m.out, "\n⚠ %s was edited locally and changed upstream since the last sync\n", entry.Path)
+		fmt.Fprint(m.out, "  [k] 保留本地 keep local  [t] 使用远程 take remote  [m] 合并 merge  [d] 查看 diff > ")
+
+		answer, err := input.ReadString('\n')
+		if err != nil && answer == "" {
+			// No more input: leave the local file alone
+			return models.OnConflictKeepLocal, nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "k", "", "keep", "keep-local":
+			return models.OnConflictKeepLocal, nil
+		case "t", "take", "take-remote":
+			return models.OnConflictTakeRemote, nil
+		case "m", "merge":
+			return models.OnConflictMerge, nil
+		case "d", "diff":
+			if err := m.showFileDiff(entry, sourcePath, repo.TargetDirectory); err != nil {
+				fmt.Fprintf(m.out, "Failed to show diff: %v\n", err)
+			}
+		default:
+			fmt.Fprintln(m.out, "Please enter k, t, m or d")
+		}
+	}
+}
+
+// stageMerges stages three-way merges for files resolved with "merge". Overlapping
+// edits are staged with conflict markers and flagged on the edit.
+func (m *Manager) stageMerges(repo *models.Repository, sourcePath string, edits []LocalEdit, txn *stagedApply) ([]models.FileChange, error) {
+	var changes []models.FileChange
+	baseDir := GetBaseDir(repo.Name)
+
+	for i := range edits {
+		edit := &edits[i]
+		if edit.Resolution != models.OnConflictMerge {
+			continue
+		}
+
+		path := filepath.FromSlash(edit.Path)
+		local := filepath.Join(repo.TargetDirectory, path)
+		remote := filepath.Join(sourcePath, path)
+		base := filepath.Join(baseDir, path)
+		if _, err := os.Stat(base); err != nil {
+			// No common ancestor: the whole file becomes one conflict
+			base = os.DevNull
+		}
+
+		merged, conflicts, err := mergeFile(local, base, remote)
+		if err != nil {
+			return changes, fmt.Errorf("failed to merge %s: %w", edit.Path, err)
+		}
+
+		info, err := os.Stat(local)
+		if err != nil {
+			return changes, err
+		}
+		if err := txn.stageData(path, merged, info.Mode().Perm()); err != nil {
+			return changes, err
+		}
+
+		edit.Conflicted = conflicts > 0
+		if edit.Conflicted {
+			fmt.Fprintf(m.out, "Merged %s with %d conflicts, resolve the markers by hand\n", edit.Path, conflicts)
+		} else {
+			fmt.Fprintf(m.out, "Merged %s cleanly\n", edit.Path)
+		}
+
+		changes = append(changes, models.FileChange{
+			Path:       path,
+			ChangeType: models.ChangeTypeModified,
+			Size:       int64(len(merged)),
+		})
+	}
+
+	return changes, nil
+}
+
+// mergeFile runs git merge-file and returns the merged content and the number of conflicts
+func mergeFile(local, base, remote string) ([]byte, int, error) {
+	cmd := exec.Command("git", "merge-file", "-p", "-L", "local", "-L", "base", "-L", "remote", local, base, remote)
+	output, err := cmd.Output()
+	if err != nil {
+		// A positive exit status is the number of conflicts
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+			return output, exitErr.ExitCode(), nil
+		}
+		return nil, 0, err
+	}
+	return output, 0, nil
+}
+
+// updateBase stores the remote content of everything this sync wrote, so the
+// next sync can tell local edits from upstream changes. Files whose local edits
+// were kept retain their old base until they are synced again.
+func (m *Manager) updateBase(repo *models.Repository, sourcePath string, fileChanges []models.FileChange) error {
+	baseDir := GetBaseDir(repo.Name)
+
+	paths := make(map[string]bool)
+	for _, change := range fileChanges {
+		path := change.Path
+		if change.ChangeType == models.ChangeTypeDeleted {
+			if err := os.Remove(filepath.Join(baseDir, path)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		paths[path] = true
+	}
+	for path := range paths {
+		dst := filepath.Join(baseDir, path)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("failed to create base directory: %w", err)
+		}
+		if err := m.copyFile(filepath.Join(sourcePath, path), dst); err != nil {
+			return fmt.Errorf("failed to store base of %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,281 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// readBase returns the base snapshot of a file, or "<missing>"
+func readBase(t *testing.T, repo *models.Repository, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(GetBaseDir(repo.Name), filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLocallyEdited(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"local": "synced", "base": "synced", "other": "edited"})
+	local, base, other := filepath.Join(dir, "local"), filepath.Join(dir, "base"), filepath.Join(dir, "other")
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name        string
+		local, base string
+		lockHash    string
+		wantEdited  bool
+		wantHasBase bool
+	}{
+		{name: "same as base", local: local, base: base, lockHash: sha256Hex("ignored"), wantHasBase: true},
+		{name: "differs from base", local: other, base: base, wantEdited: true, wantHasBase: true},
+		{name: "same as lock", local: local, base: missing, lockHash: sha256Hex("synced")},
+		{name: "differs from lock", local: other, base: missing, lockHash: sha256Hex("synced"), wantEdited: true},
+		{name: "neither base nor lock", local: other, base: missing},
+	}
+
+	for _, tt := range tests {
+		edited, hasBase, err := locallyEdited(tt.local, tt.base, tt.lockHash)
+		if err != nil {
+			t.Errorf("%s: locallyEdited() failed: %v", tt.name, err)
+			continue
+		}
+		if edited != tt.wantEdited || hasBase != tt.wantHasBase {
+			t.Errorf("%s: locallyEdited() = %v, %v, want %v, %v", tt.name, edited, hasBase, tt.wantEdited, tt.wantHasBase)
+		}
+	}
+}
+
+func TestMergeFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"base":           "one\ntwo\nthree\n",
+		"local":          "ONE\ntwo\nthree\n",
+		"remote":         "one\ntwo\nTHREE\n",
+		"remote-overlap": "uno\ntwo\nthree\n",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	merged, conflicts, err := mergeFile(path("local"), path("base"), path("remote"))
+	if err != nil || conflicts != 0 || string(merged) != "ONE\ntwo\nTHREE\n" {
+		t.Errorf("clean merge = %q, %d conflicts, %v", merged, conflicts, err)
+	}
+
+	merged, conflicts, err = mergeFile(path("local"), path("base"), path("remote-overlap"))
+	if err != nil || conflicts != 1 {
+		t.Fatalf("overlapping merge = %d conflicts, %v, want 1", conflicts, err)
+	}
+	for _, marker := range []string{"<<<<<<< local\nONE\n", "=======\nuno\n>>>>>>> remote\n", "two\nthree\n"} {
+		if !strings.Contains(string(merged), marker) {
+			t.Errorf("overlapping merge %q lacks %q", merged, marker)
+		}
+	}
+
+	if _, _, err := mergeFile(path("missing"), path("base"), path("remote")); err == nil {
+		t.Error("mergeFile() of a missing file succeeded")
+	}
+}
+
+func TestUpdateBase(t *testing.T) {
+	m := newTestManager(t)
+	repo := &models.Repository{Name: "proto"}
+	source := t.TempDir()
+	writeFiles(t, source, map[string]string{"a.proto": "a2", "sub/b.proto": "b1", "c.proto": "c1"})
+	writeFiles(t, GetBaseDir(repo.Name), map[string]string{"a.proto": "a1", "gone.proto": "gone", "kept.proto": "kept"})
+
+	err := m.updateBase(repo, source, []models.FileChange{
+		{Path: "a.proto", ChangeType: models.ChangeTypeModified},
+		{Path: filepath.Join("sub", "b.proto"), ChangeType: models.ChangeTypeAdded},
+		{Path: "gone.proto", ChangeType: models.ChangeTypeDeleted},
+		{Path: "never-synced.proto", ChangeType: models.ChangeTypeDeleted},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"a.proto": "a2", "sub/b.proto": "b1", "kept.proto": "kept"}
+	if got := snapshot(t, GetBaseDir(repo.Name)); !sameFiles(got, want) {
+		t.Errorf("base = %v, want %v", got, want)
+	}
+}
+
+func TestConflictResolutionPrompt(t *testing.T) {
+	entry := PlanEntry{Path: "a.proto", Status: "M"}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string // one resolution per prompt, all reading the same input
+	}{
+		{name: "take remote", input: "t\n", want: []string{models.OnConflictTakeRemote}},
+		{name: "merge", input: "merge\n", want: []string{models.OnConflictMerge}},
+		{name: "default", input: "\n", want: []string{models.OnConflictKeepLocal}},
+		{name: "retry after invalid input", input: "x\nK\n", want: []string{models.OnConflictKeepLocal}},
+		{name: "end of input", input: "", want: []string{models.OnConflictKeepLocal}},
+		{name: "last line without newline", input: "t", want: []string{models.OnConflictTakeRemote}},
+		{name: "one reader for every prompt", input: "t\nm\nk\n", want: []string{models.OnConflictTakeRemote, models.OnConflictMerge, models.OnConflictKeepLocal}},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		repo := &models.Repository{Name: "proto"}
+		input := bufio.NewReader(strings.NewReader(tt.input))
+		for i, want := range tt.want {
+			got, err := m.conflictResolution(repo, entry, t.TempDir(), input)
+			if err != nil || got != want {
+				t.Errorf("%s: prompt %d = %q, %v, want %q", tt.name, i+1, got, err, want)
+			}
+		}
+	}
+
+	// The flag beats the repository setting, and both skip the prompt
+	m := newTestManager(t)
+	repo := &models.Repository{Name: "proto", OnConflict: models.OnConflictMerge}
+	if got, _ := m.conflictResolution(repo, entry, "", bufio.NewReader(strings.NewReader("t\n"))); got != models.OnConflictMerge {
+		t.Errorf("on_conflict: merge resolved to %q", got)
+	}
+	m.SetOnConflict(models.OnConflictKeepLocal)
+	if got, _ := m.conflictResolution(repo, entry, "", bufio.NewReader(strings.NewReader("t\n"))); got != models.OnConflictKeepLocal {
+		t.Errorf("--on-conflict keep-local resolved to %q", got)
+	}
+
+	// Without a terminal nobody is asked
+	m = newTestManager(t)
+	m.SetNonInteractive(true)
+	if got, _ := m.conflictResolution(&models.Repository{Name: "proto"}, entry, "", bufio.NewReader(strings.NewReader("t\n"))); got != models.OnConflictKeepLocal {
+		t.Errorf("non-interactive ask resolved to %q", got)
+	}
+}
+
+func TestOnConflictModes(t *testing.T) {
+	const base = "one\ntwo\nthree\n"
+	const local = "ONE\ntwo\nthree\n"
+
+	tests := []struct {
+		name           string
+		onConflict     string
+		remote         string
+		want           string // a.proto after the sync
+		wantResolution string
+		wantConflicted bool
+		wantBase       string
+	}{
+		{
+			name:           "keep-local",
+			onConflict:     models.OnConflictKeepLocal,
+			remote:         "one\ntwo\nTHREE\n",
+			want:           local,
+			wantResolution: models.OnConflictKeepLocal,
+			wantBase:       base,
+		},
+		{
+			name:           "ask without a terminal",
+			onConflict:     models.OnConflictAsk,
+			remote:         "one\ntwo\nTHREE\n",
+			want:           local,
+			wantResolution: models.OnConflictKeepLocal,
+			wantBase:       base,
+		},
+		{
+			name:           "take-remote",
+			onConflict:     models.OnConflictTakeRemote,
+			remote:         "one\ntwo\nTHREE\n",
+			want:           "one\ntwo\nTHREE\n",
+			wantResolution: models.OnConflictTakeRemote,
+			wantBase:       "one\ntwo\nTHREE\n",
+		},
+		{
+			name:           "clean merge",
+			onConflict:     models.OnConflictMerge,
+			remote:         "one\ntwo\nTHREE\n",
+			want:           "ONE\ntwo\nTHREE\n",
+			wantResolution: models.OnConflictMerge,
+			wantBase:       "one\ntwo\nTHREE\n",
+		},
+		{
+			name:           "merge with conflict markers",
+			onConflict:     models.OnConflictMerge,
+			remote:         "uno\ntwo\nthree\n",
+			want:           "<<<<<<< local\nONE\n=======\nuno\n>>>>>>> remote\ntwo\nthree\n",
+			wantResolution: models.OnConflictMerge,
+			wantConflicted: true,
+			wantBase:       "uno\ntwo\nthree\n",
+		},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		u := newUpstream(t, map[string]string{"api/a.proto": base, "api/b.proto": "b1"})
+		repo := syncedRepo(t, u)
+		syncAll(t, m, repo)
+
+		writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": local})
+		u.commit(map[string]string{"api/a.proto": tt.remote, "api/b.proto": "b2"})
+		m.SetOnConflict(tt.onConflict)
+		result := syncAll(t, m, repo)
+
+		if got := readTarget(t, repo, "a.proto"); got != tt.want {
+			t.Errorf("%s: a.proto = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := readTarget(t, repo, "b.proto"); got != "b2" {
+			t.Errorf("%s: b.proto = %q, want the upstream change", tt.name, got)
+		}
+		want := []LocalEdit{{Path: "a.proto", Resolution: tt.wantResolution, Conflicted: tt.wantConflicted}}
+		if len(result.LocalEdits) != 1 || result.LocalEdits[0] != want[0] {
+			t.Errorf("%s: local edits = %+v, want %+v", tt.name, result.LocalEdits, want)
+		}
+		if result.HasConflicts() != tt.wantConflicted {
+			t.Errorf("%s: HasConflicts() = %v", tt.name, result.HasConflicts())
+		}
+		if got := readBase(t, repo, "a.proto"); got != tt.wantBase {
+			t.Errorf("%s: base of a.proto = %q, want %q", tt.name, got, tt.wantBase)
+		}
+	}
+}
+
+func TestLocalEditsWithoutUpstreamChange(t *testing.T) {
+	for _, onConflict := range []string{models.OnConflictKeepLocal, models.OnConflictTakeRemote, models.OnConflictMerge} {
+		m := newTestManager(t)
+		m.SetPrune(true)
+		u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1", "api/c.proto": "c1"})
+		repo := syncedRepo(t, u)
+		syncAll(t, m, repo)
+
+		// a.proto is only edited locally; b.proto is edited locally and removed upstream
+		writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "a local", "b.proto": "b local"})
+		u.commit(map[string]string{"api/c.proto": "c2"}, "api/b.proto")
+		m.SetOnConflict(onConflict)
+		out := &bytes.Buffer{}
+		m.SetOutput(out)
+		syncAll(t, m, repo)
+
+		if got := readTarget(t, repo, "a.proto"); got != "a local" {
+			t.Errorf("%s: a.proto = %q, want the local edit kept", onConflict, got)
+		}
+		if !strings.Contains(out.String(), "Keeping local edits in a.proto (unchanged upstream)") {
+			t.Errorf("%s: output lacks the kept edit of a.proto:\n%s", onConflict, out)
+		}
+
+		// Only take-remote prunes local edits removed upstream
+		wantB := "b local"
+		if onConflict == models.OnConflictTakeRemote {
+			wantB = "<missing>"
+		}
+		if got := readTarget(t, repo, "b.proto"); got != wantB {
+			t.Errorf("%s: b.proto = %q, want %q", onConflict, got, wantB)
+		}
+		if got := readTarget(t, repo, "c.proto"); got != "c2" {
+			t.Errorf("%s: c.proto = %q, want c2", onConflict, got)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// FindSyncToUndo returns the history entry an undo reverts: the entry with the
+// given ID, or else the newest successful sync that changed files and hasn't
+// been undone. Undos are only picked by ID, so repeated undos walk back
+// through history. An empty repoName considers every repository.
+func FindSyncToUndo(repoName, id string) (*models.SyncHistory, error) {
+	histories, err := GetAllHistory(0)
+	if err != nil {
+		return nil, err
+	}
+	undone := UndoneSyncs(histories)
+
+	for i := range histories {
+		history := &histories[i]
+		if repoName != "" && history.Repository != repoName {
+			continue
+		}
+
+		if id != "" {
+			if history.ID != id {
+				continue
+			}
+			if !history.Success {
+				return nil, fmt.Errorf("sync %s did not succeed, there is nothing to undo", id)
+			}
+			if by, ok := undone[id]; ok {
+				return nil, fmt.Errorf("sync %s was already undone by %s", id, by)
+			}
+			return history, nil
+		}
+
+		if history.Success && history.UndoOf == "" && undone[history.ID] == "" && hasFileChanges(history) {
+			return history, nil
+		}
+	}
+
+	if id != "" {
+		return nil, fmt.Errorf("no sync history entry %s", id)
+	}
+	if repoName != "" {
+		return nil, fmt.Errorf("no sync of %s to undo", repoName)
+	}
+	return nil, fmt.Errorf("no sync to undo")
+}
+
+// UndoneSyncs maps the IDs of undone history entries to the undo's ID
+func UndoneSyncs(histories []models.SyncHistory) map[string]string {
+	undone := make(map[string]string)
+	for _, history := range histories {
+		if history.UndoOf != "" && history.Success {
+			undone[history.UndoOf] = history.ID
+		}
+	}
+	return undone
+}
+
+// hasFileChanges reports whether a sync wrote or deleted anything
+func hasFileChanges(history *models.SyncHistory) bool {
+	for _, change := range history.FileChanges {
+		if change.ChangeType != models.ChangeTypeUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// UndoSync reverts a recorded sync: files it added are deleted, and files it
+// modified or deleted get their previous content back, from the backup taken
+// before the sync or else from the commit the lockfile recorded before it.
+// The undo is applied atomically and recorded as a history entry of its own.
+// Undoing the first sync of a repository removes it from the lockfile.
+func (m *Manager) UndoSync(ctx context.Context, repo *models.Repository, entry *models.SyncHistory) (*SyncResult, error) {
+	startTime := time.Now()
+	result := &SyncResult{Repository: repo.Name}
+
+	if !m.force {
+		if err := m.checkUndoSafe(repo, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	previousCommit := entry.PreviousCommit
+	if previousCommit == "" {
+		previousCommit = previousSyncCommit(entry)
+	}
+	result.Commit = previousCommit
+
+	// Previous content comes from the backup when it has the file
+	var backup *BackupInfo
+	if entry.Backup != "" {
+		found, err := m.FindBackup(repo.Name, entry.Backup)
+		if err != nil {
+			fmt.Fprintf(m.out, "Warning: backup %s is gone, falling back to commit %s\n", entry.Backup, shortHash(previousCommit))
+		} else {
+			backup = found
+		}
+	}
+
+	var restore []models.FileChange // content to bring back
+	var needCommit []string
+	for _, change := range entry.FileChanges {
+		path := filepath.ToSlash(change.Path)
+		target := filepath.Join(repo.TargetDirectory, filepath.FromSlash(path))
+		_, statErr := os.Stat(target)
+
+		switch change.ChangeType {
+		case models.ChangeTypeUnchanged:
+			continue
+		case models.ChangeTypeAdded:
+			if statErr == nil {
+				result.Changes = append(result.Changes, models.FileChange{Path: path, ChangeType: models.ChangeTypeDeleted, Size: change.Size})
+			}
+			continue
+		}
+
+		undo := models.FileChange{Path: path, ChangeType: models.ChangeTypeModified}
+		if statErr != nil {
+			undo.ChangeType = models.ChangeTypeAdded
+		}
+		restore = append(restore, undo)
+		if backup == nil {
+			needCommit = append(needCommit, path)
+		} else if _, ok := backupFile(backup, path); !ok {
+			needCommit = append(needCommit, path)
+		}
+	}
+
+	// Check out the previous commit only if the backup can't supply everything
+	var source *syncSource
+	if len(needCommit) > 0 {
+		if previousCommit == "" {
+			return nil, fmt.Errorf("cannot restore %s: no backup holds the previous content and no earlier commit is recorded", strings.Join(needCommit, ", "))
+		}
+
+		previous := *repo
+		previous.Ref = previousCommit
+		fmt.Fprintf(m.out, "Restoring %d files from commit %s\n", len(needCommit), shortHash(previousCommit))
+
+		var cleanup func()
+		var err error
+		source, cleanup, err = m.prepareSource(ctx, &previous)
+		defer cleanup()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check out commit %s: %w", shortHash(previousCommit), err)
+		}
+		for _, path := range needCommit {
+			if _, err := os.Stat(filepath.Join(source.path, filepath.FromSlash(path))); err != nil {
+				return nil, fmt.Errorf("cannot restore %s: not in backup and not in commit %s", path, shortHash(previousCommit))
+			}
+		}
+	}
+	if source == nil {
+		source = &syncSource{commit: previousCommit}
+	}
+	source.resolved = "undo " + entry.ID
+
+	result.Changes = append(result.Changes, restore...)
+	sort.Slice(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Path < result.Changes[j].Path
+	})
+
+	if len(result.Changes) == 0 {
+		fmt.Fprintln(m.out, "Nothing to undo: the target no longer has any of the sync's changes")
+		return result, nil
+	}
+	if m.dryRun {
+		result.DryRun = true
+		return result, nil
+	}
+
+	if err := os.MkdirAll(repo.TargetDirectory, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	outcome := syncOutcome{previousCommit: m.lockedCommit(repo), undoOf: entry.ID}
+
+	// Stage everything, keep a backup of the current state, then swap it in
+	txn, err := newStagedApply(repo.TargetDirectory)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range result.Changes {
+		if err := m.stageUndo(txn, change, backup, source); err != nil {
+			txn.finish()
+			return nil, fmt.Errorf("failed to stage %s: %w", change.Path, err)
+		}
+	}
+
+	// Last chance to cancel before the target changes
+	if err := ctx.Err(); err != nil {
+		txn.finish()
+		return nil, fmt.Errorf("%w: %w", ErrCancelled, err)
+	}
+
+	outcome.backup = m.backupChanges(repo, result.Changes)
+
+	if err := txn.commit(); err != nil {
+		outcome.rolledBack = true
+		outcome.err = err.Error()
+		m.recordSyncHistory(repo, source, result.Changes, startTime, outcome)
+		return nil, fmt.Errorf("failed to undo sync: %w", err)
+	}
+	txn.finish()
+	m.pruneOldBackups(repo)
+
+	outcome.success = true
+	hashWritten(repo.TargetDirectory, result.Changes)
+	m.recordSyncHistory(repo, source, result.Changes, startTime, outcome)
+
+	// The target is back at the previous commit, or never synced at all
+	if source.commit == "" {
+		if err := removeLockEntry(repo.TargetDirectory, repo.Name); err != nil {
+			fmt.Fprintf(m.out, "Warning: failed to update lockfile: %v\n", err)
+		}
+	} else if err := m.updateLock(repo, source, repo.TargetDirectory, result.Changes, nil); err != nil {
+		fmt.Fprintf(m.out, "Warning: failed to update lockfile: %v\n", err)
+	}
+	if err := m.updateManifest(repo, result.Changes); err != nil {
+		fmt.Fprintf(m.out, "Warning: failed to update ownership manifest: %v\n", err)
+	}
+	if err := m.updateBase(repo, repo.TargetDirectory, result.Changes); err != nil {
+		fmt.Fprintf(m.out, "Warning: failed to store base snapshot: %v\n", err)
+	}
+
+	now := time.Now()
+	repo.LastSync = &now
+	repo.Status = models.StatusUpToDate
+	return result, nil
+}
+
+// stageUndo stages one file of an undo from the backup or the previous commit
+func (m *Manager) stageUndo(txn *stagedApply, change models.FileChange, backup *BackupInfo, source *syncSource) error {
+	path := filepath.FromSlash(change.Path)
+	if change.ChangeType == models.ChangeTypeDeleted {
+		txn.stageDelete(path)
+		return nil
+	}
+
+	if backup != nil {
+		if file, ok := backupFile(backup, change.Path); ok {
+			data, err := readBackupFile(backup, file)
+			if err != nil {
+				return err
+			}
+			return txn.stageData(path, data, os.FileMode(file.Mode))
+		}
+	}
+	return txn.stageFile(path, filepath.Join(source.path, path), m.copyFile)
+}
+
+// checkUndoSafe refuses to undo a sync whose files were changed again by a
+// later sync that is still in effect, or edited locally since: files it wrote
+// must still have the hash it recorded, files it deleted must still be gone
+func (m *Manager) checkUndoSafe(repo *models.Repository, entry *models.SyncHistory) error {
+	histories, err := GetHistoryForRepository(entry.Repository, 0)
+	if err != nil {
+		return err
+	}
+	undone := UndoneSyncs(histories)
+
+	paths := make(map[string]bool)
+	for _, change := range entry.FileChanges {
+		if change.ChangeType != models.ChangeTypeUnchanged {
+			paths[filepath.ToSlash(change.Path)] = true
+		}
+	}
+
+	// History is newest first; everything before the entry came later
+	for _, later := range histories {
+		if later.ID == entry.ID {
+			break
+		}
+		if !later.Success || undone[later.ID] != "" || later.UndoOf != "" {
+			continue
+		}
+		for _, change := range later.FileChanges {
+			if change.ChangeType != models.ChangeTypeUnchanged && paths[filepath.ToSlash(change.Path)] {
+				return fmt.Errorf("%s was changed again by a later sync (%s), undo that one first or use --force", change.Path, later.ID)
+			}
+		}
+	}
+
+	// History recorded before hashes were kept falls back to the lockfile
+	lockHashes := map[string]string{}
+	if lock, err := LoadLock(repo.TargetDirectory); err == nil {
+		if locked := lock.GetEntry(repo.Name); locked != nil {
+			lockHashes = locked.Files
+		}
+	}
+
+	for _, change := range entry.FileChanges {
+		path := filepath.ToSlash(change.Path)
+		target := filepath.Join(repo.TargetDirectory, filepath.FromSlash(path))
+
+		switch change.ChangeType {
+		case models.ChangeTypeDeleted:
+			if _, err := os.Stat(target); err == nil {
+				return fmt.Errorf("%s was created again since the sync, undo would overwrite it; use --force to undo anyway", path)
+			}
+		case models.ChangeTypeAdded, models.ChangeTypeModified:
+			want := change.Hash
+			if want == "" {
+				want = lockHashes[path]
+			}
+			if want == "" {
+				continue
+			}
+			got, err := hashFile(target)
+			if os.IsNotExist(err) {
+				// Nothing left to lose
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to hash %s: %w", path, err)
+			}
+			if got != want {
+				return fmt.Errorf("%s was edited since the sync, undo would discard the edits; use --force to undo anyway", path)
+			}
+		}
+	}
+	return nil
+}
+
+// previousSyncCommit returns the commit of the last successful sync of the same
+// repository before entry, for history recorded without a previous commit
+func previousSyncCommit(entry *models.SyncHistory) string {
+	histories, err := GetHistoryForRepository(entry.Repository, 0)
+	if err != nil {
+		return ""
+	}
+	for i, history := range histories {
+		if history.ID != entry.ID {
+			continue
+		}
+		for _, older := range histories[i+1:] {
+			if older.Success && older.Commit != "" {
+				return older.Commit
+			}
+		}
+	}
+	return ""
+}
+
+// shortHash abbreviates a commit hash for display
+func shortHash(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
@@ -0,0 +1,245 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// undoLast undoes the newest sync of repo that can be undone
+func undoLast(t *testing.T, m *Manager, repo *models.Repository) (*SyncResult, error) {
+	t.Helper()
+	entry, err := FindSyncToUndo(repo.Name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.UndoSync(context.Background(), repo, entry)
+}
+
+// lockEntry returns the lock entry of repo, or nil
+func lockEntry(t *testing.T, repo *models.Repository) *models.LockEntry {
+	t.Helper()
+	lock, err := LoadLock(repo.TargetDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lock.GetEntry(repo.Name)
+}
+
+func TestUndoSync(t *testing.T) {
+	for _, backups := range []bool{true, false} {
+		m := newTestManager(t)
+		m.config.Settings.BackupEnabled = backups
+		m.SetPrune(true)
+		u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"})
+		repo := syncedRepo(t, u)
+		first := syncAll(t, m, repo).Commit
+
+		u.commit(map[string]string{"api/a.proto": "a2", "api/c.proto": "c1"}, "api/b.proto")
+		second := syncAll(t, m, repo)
+		if got := changeList(second.Changes); got != "added c.proto, deleted b.proto, modified a.proto" {
+			t.Fatalf("backups %v: second sync changed %s", backups, got)
+		}
+
+		result, err := undoLast(t, m, repo)
+		if err != nil {
+			t.Fatalf("backups %v: undo failed: %v", backups, err)
+		}
+		if got, want := changeList(result.Changes), "added b.proto, deleted c.proto, modified a.proto"; got != want {
+			t.Errorf("backups %v: undo changed %s, want %s", backups, got, want)
+		}
+		for path, want := range map[string]string{"a.proto": "a1", "b.proto": "b1", "c.proto": "<missing>"} {
+			if got := readTarget(t, repo, path); got != want {
+				t.Errorf("backups %v: %s = %q after undo, want %q", backups, path, got, want)
+			}
+		}
+
+		// The lockfile is back at the first sync's commit and the undo is in history
+		if entry := lockEntry(t, repo); entry == nil || entry.Commit != first || entry.Files["a.proto"] != sha256Hex("a1") || entry.Files["c.proto"] != "" {
+			t.Errorf("backups %v: lock entry after undo = %+v", backups, entry)
+		}
+		history := lastHistory(t, repo)
+		if !history.Success || history.UndoOf == "" || history.Commit != first {
+			t.Errorf("backups %v: history of the undo = %+v", backups, history)
+		}
+
+		// The next undo reverts the first sync, not the undo
+		entry, err := FindSyncToUndo(repo.Name, "")
+		if err != nil || entry.Commit != first || entry.UndoOf != "" {
+			t.Errorf("backups %v: next undo would revert %+v, %v", backups, entry, err)
+		}
+	}
+}
+
+func TestUndoFirstSync(t *testing.T) {
+	m := newTestManager(t)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/sub/b.proto": "b1"})
+	repo := syncedRepo(t, u)
+	syncAll(t, m, repo)
+	writeFiles(t, repo.TargetDirectory, map[string]string{"hand.proto": "hand written"})
+
+	result, err := undoLast(t, m, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := changeList(result.Changes), "deleted a.proto, deleted sub/b.proto"; got != want {
+		t.Errorf("undo changed %s, want %s", got, want)
+	}
+	if got := readTarget(t, repo, "hand.proto"); got != "hand written" {
+		t.Errorf("hand.proto = %q after undo", got)
+	}
+
+	// No commit was synced before, so the lockfile has nothing left to record
+	if _, err := os.Stat(GetLockPath(repo.TargetDirectory)); !os.IsNotExist(err) {
+		t.Errorf("lockfile still exists after undoing the only sync: %v", err)
+	}
+	if entry, err := FindSyncToUndo(repo.Name, ""); err == nil {
+		t.Errorf("FindSyncToUndo() after undoing every sync = %+v", entry)
+	}
+}
+
+func TestRemoveLockEntry(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveLock(dir, &models.LockFile{Repositories: []models.LockEntry{
+		{Name: "proto", Commit: "1111", Files: map[string]string{"a.proto": "aa"}},
+		{Name: "other", Commit: "2222", Files: map[string]string{"o.proto": "oo"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeLockEntry(dir, "proto"); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := LoadLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Repositories) != 1 || lock.GetEntry("other") == nil || lock.GetEntry("proto") != nil {
+		t.Errorf("lock after removing proto = %+v", lock.Repositories)
+	}
+
+	if err := removeLockEntry(dir, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(GetLockPath(dir)); !os.IsNotExist(err) {
+		t.Errorf("empty lockfile was kept: %v", err)
+	}
+	if err := removeLockEntry(dir, "other"); err != nil {
+		t.Errorf("removeLockEntry() without a lockfile failed: %v", err)
+	}
+}
+
+func TestUndoRefusesToDiscardChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, m *Manager, u *upstream, repo *models.Repository)
+		wantErr string
+	}{
+		{
+			name: "edited locally",
+			change: func(t *testing.T, m *Manager, u *upstream, repo *models.Repository) {
+				writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "edited"})
+			},
+			wantErr: "a.proto was edited since the sync",
+		},
+		{
+			name: "added file edited locally",
+			change: func(t *testing.T, m *Manager, u *upstream, repo *models.Repository) {
+				writeFiles(t, repo.TargetDirectory, map[string]string{"c.proto": "edited"})
+			},
+			wantErr: "c.proto was edited since the sync",
+		},
+		{
+			name: "deleted file created again",
+			change: func(t *testing.T, m *Manager, u *upstream, repo *models.Repository) {
+				writeFiles(t, repo.TargetDirectory, map[string]string{"b.proto": "hand written"})
+			},
+			wantErr: "b.proto was created again since the sync",
+		},
+		{
+			name: "changed by a later sync",
+			change: func(t *testing.T, m *Manager, u *upstream, repo *models.Repository) {
+				u.commit(map[string]string{"api/a.proto": "a3"})
+				syncAll(t, m, repo)
+			},
+			wantErr: "a.proto was changed again by a later sync",
+		},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager(t)
+		m.SetPrune(true)
+		u := newUpstream(t, map[string]string{"api/a.proto": "a1", "api/b.proto": "b1"})
+		repo := syncedRepo(t, u)
+		syncAll(t, m, repo)
+		u.commit(map[string]string{"api/a.proto": "a2", "api/c.proto": "c1"}, "api/b.proto")
+		syncAll(t, m, repo)
+		entry, err := FindSyncToUndo(repo.Name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tt.change(t, m, u, repo)
+		before := snapshot(t, repo.TargetDirectory)
+
+		_, err = m.UndoSync(context.Background(), repo, entry)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "--force") {
+			t.Errorf("%s: UndoSync() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+		if after := snapshot(t, repo.TargetDirectory); !sameFiles(after, before) {
+			t.Errorf("%s: refused undo changed the target to %v", tt.name, after)
+		}
+
+		// --force undoes it anyway
+		m.SetForce(true)
+		if _, err := m.UndoSync(context.Background(), repo, entry); err != nil {
+			t.Errorf("%s: UndoSync() with --force failed: %v", tt.name, err)
+		}
+		if got := readTarget(t, repo, "a.proto"); got != "a1" {
+			t.Errorf("%s: a.proto = %q after a forced undo, want a1", tt.name, got)
+		}
+	}
+}
+
+func TestUndoWithoutRecordedHashes(t *testing.T) {
+	m := newTestManager(t)
+	u := newUpstream(t, map[string]string{"api/a.proto": "a1"})
+	repo := syncedRepo(t, u)
+	syncAll(t, m, repo)
+	u.commit(map[string]string{"api/a.proto": "a2"})
+	syncAll(t, m, repo)
+
+	// History written before hashes were recorded falls back to the lockfile
+	store, err := LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range store.Histories {
+		for j := range store.Histories[i].FileChanges {
+			store.Histories[i].FileChanges[j].Hash = ""
+		}
+	}
+	if err := SaveHistory(store); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "edited"})
+	if _, err := undoLast(t, m, repo); err == nil || !strings.Contains(err.Error(), "edited since the sync") {
+		t.Errorf("undo of an edited file without recorded hashes = %v", err)
+	}
+
+	writeFiles(t, repo.TargetDirectory, map[string]string{"a.proto": "a2"})
+	if _, err := undoLast(t, m, repo); err != nil {
+		t.Errorf("undo of an unedited file without recorded hashes failed: %v", err)
+	}
+	if got := readTarget(t, repo, "a.proto"); got != "a1" {
+		t.Errorf("a.proto = %q after undo, want a1", got)
+	}
+	if _, err := os.Stat(filepath.Join(repo.TargetDirectory, LockFileName)); err != nil {
+		t.Errorf("lockfile of an undo back to a commit is gone: %v", err)
+	}
+}
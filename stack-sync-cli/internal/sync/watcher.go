@@ -1,10 +1,12 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path/filepath"
 	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -17,6 +19,8 @@ type Watcher struct {
 	watcher  *fsnotify.Watcher
 	debounce time.Duration
 	events   map[string]time.Time // Debounce map
+	ctx      context.Context      // cancels pending and running auto-syncs
+	syncs    gosync.WaitGroup     // running auto-syncs
 }
 
 // NewWatcher creates a new file watcher
@@ -34,8 +38,10 @@ func NewWatcher(manager *Manager) (*Watcher, error) {
 	}, nil
 }
 
-// Start starts watching configured repositories
-func (w *Watcher) Start() error {
+// Start starts watching configured repositories until ctx is cancelled
+func (w *Watcher) Start(ctx context.Context) error {
+	w.ctx = ctx
+
 	// Add repositories with watch mode enabled
 	for i := range w.manager.config.Repositories {
 		repo := &w.manager.config.Repositories[i]
@@ -73,15 +79,21 @@ func (w *Watcher) RemoveRepository(repo *models.Repository) error {
 	return w.watcher.Remove(repo.LocalPath)
 }
 
-// Stop stops the watcher
+// Stop stops the watcher and waits for running auto-syncs, which stop early
+// once the context passed to Start is cancelled
 func (w *Watcher) Stop() error {
-	return w.watcher.Close()
+	err := w.watcher.Close()
+	w.syncs.Wait()
+	return err
 }
 
 // watchLoop is the main event loop
 func (w *Watcher) watchLoop() {
 	for {
 		select {
+		case <-w.ctx.Done():
+			return
+
 		case event, ok := <-w.watcher.Events:
 			if !ok {
 				return
@@ -129,15 +141,22 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 	log.Printf("File changed in %s: %s (%s)\n", repo.Name, event.Name, event.Op)
 
 	// Trigger sync after debounce period
+	w.syncs.Add(1)
 	go w.debouncedSync(repo)
 }
 
 // debouncedSync waits for the debounce period before syncing
 func (w *Watcher) debouncedSync(repo *models.Repository) {
-	time.Sleep(w.debounce)
+	defer w.syncs.Done()
+
+	select {
+	case <-time.After(w.debounce):
+	case <-w.ctx.Done():
+		return
+	}
 
 	log.Printf("Auto-syncing %s...\n", repo.Name)
-	if err := w.manager.SyncRepository(repo); err != nil {
+	if _, err := w.manager.SyncRepository(w.ctx, repo); err != nil {
 		log.Printf("Failed to sync %s: %v\n", repo.Name, err)
 	} else {
 		log.Printf("Successfully synced %s\n", repo.Name)
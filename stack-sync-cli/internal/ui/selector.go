@@ -88,12 +88,16 @@ func ConfirmAction(message string) bool {
 	return result == "y" || result == "Y"
 }
 
-// PromptInput shows an input prompt
-func PromptInput(label string, defaultValue string) (string, error) {
+// PromptInput shows an input prompt. Masked prompts echo * instead of what is
+// typed, for passwords and tokens.
+func PromptInput(label string, defaultValue string, masked bool) (string, error) {
 	prompt := promptui.Prompt{
 		Label:   label,
 		Default: defaultValue,
 	}
+	if masked {
+		prompt.Mask = '*'
+	}
 
 	return prompt.Run()
 }
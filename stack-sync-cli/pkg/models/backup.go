@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Backup compression modes
+const (
+	BackupCompressionNone  = "none"
+	BackupCompressionGzip  = "gzip"   // 逐个数据块 gzip 压缩
+	BackupCompressionTarGz = "tar.gz" // 每个还原点打包为一个 tar.gz 归档
+	BackupCompressionZstd  = "zstd"   // 每个还原点打包为一个 tar.zst 归档
+)
+
+// BackupManifest is one restore point of a repository's target directory.
+// It captures only the files a sync was about to overwrite or delete; their
+// content lives in the repository's deduplicated blob store, or with archive
+// compression in one archive next to the manifest.
+type BackupManifest struct {
+	Repository      string       `json:"repository"`            // 仓库名称
+	TargetDirectory string       `json:"target_directory"`      // 备份的目标目录
+	CreatedAt       time.Time    `json:"created_at"`            // 备份时间
+	Compression     string       `json:"compression,omitempty"` // 数据块压缩方式或归档格式
+	Files           []BackupFile `json:"files"`                 // 被覆盖或删除前的文件
+	Created         []string     `json:"created,omitempty"`     // 同步新建的文件，恢复时删除
+}
+
+// BackupFile is the captured content of one file
+type BackupFile struct {
+	Path string `json:"path"` // 相对目标目录的路径
+	Hash string `json:"hash"` // 内容的 sha256，即数据块名称
+	Size int64  `json:"size"` // 原始大小
+	Mode uint32 `json:"mode"` // 文件权限
+}
@@ -0,0 +1,28 @@
+package models
+
+// LockFile records exactly which remote commit and file contents produced a target directory
+type LockFile struct {
+	Version      int         `json:"version"`      // 锁文件格式版本
+	Repositories []LockEntry `json:"repositories"` // 同步到该目录的仓库
+}
+
+// LockEntry is the locked state of one repository within a target directory
+type LockEntry struct {
+	Name            string            `json:"name"`                       // 仓库名称
+	URL             string            `json:"url"`                        // 仓库地址
+	Branch          string            `json:"branch,omitempty"`           // 分支名称
+	Ref             string            `json:"ref,omitempty"`              // 配置的固定版本
+	Commit          string            `json:"commit"`                     // 同步时解析到的提交
+	SourceDirectory string            `json:"source_directory,omitempty"` // 远程仓库中的源目录
+	Files           map[string]string `json:"files"`                      // 相对路径 -> sha256
+}
+
+// GetEntry returns the entry for a repository, or nil
+func (l *LockFile) GetEntry(name string) *LockEntry {
+	for i := range l.Repositories {
+		if l.Repositories[i].Name == name {
+			return &l.Repositories[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// OwnershipManifest lists the target files written by a repository's syncs.
+// Only these files may be overwritten or deleted by later syncs.
+type OwnershipManifest struct {
+	Repository      string    `json:"repository"`       // 仓库名称
+	TargetDirectory string    `json:"target_directory"` // 文件所在的目标目录
+	Files           []string  `json:"files"`            // 相对目标目录的路径
+	UpdatedAt       time.Time `json:"updated_at"`
+}
@@ -6,39 +6,102 @@ import "time"
 type SyncStatus string
 
 const (
-	StatusSyncing    SyncStatus = "syncing"
-	StatusUpToDate   SyncStatus = "up-to-date"
-	StatusConflict   SyncStatus = "conflict"
-	StatusNotCloned  SyncStatus = "not-cloned"
-	StatusModified   SyncStatus = "modified"
-	StatusError      SyncStatus = "error"
+	StatusSyncing   SyncStatus = "syncing"
+	StatusUpToDate  SyncStatus = "up-to-date"
+	StatusConflict  SyncStatus = "conflict"
+	StatusNotCloned SyncStatus = "not-cloned"
+	StatusModified  SyncStatus = "modified"
+	StatusError     SyncStatus = "error"
+)
+
+// Clone strategies supported for fetching a repository
+const (
+	CloneStrategyMirror       = "mirror"        // 使用本地镜像缓存（启用缓存时的默认值）
+	CloneStrategyFull         = "full"          // 完整克隆
+	CloneStrategyShallow      = "shallow"       // 浅克隆，仅拉取最近 N 个提交
+	CloneStrategySingleBranch = "single-branch" // 仅克隆指定分支
+	CloneStrategySparse       = "sparse"        // 浅克隆 + 仅在工作区检出 source_directory（传输量与浅克隆相同）
+)
+
+// Resolutions for files edited locally that also changed upstream since the last sync
+const (
+	OnConflictAsk        = "ask"         // 交互式询问（有终端时的默认值）
+	OnConflictKeepLocal  = "keep-local"  // 保留本地修改（非交互模式的默认值）
+	OnConflictTakeRemote = "take-remote" // 使用远程版本覆盖本地修改
+	OnConflictMerge      = "merge"       // 三方合并，冲突处写入冲突标记
 )
 
 // Repository represents a Git repository configuration (matches IntelliJ plugin)
 type Repository struct {
-	Name              string            `yaml:"name"`
-	URL               string            `yaml:"url"`
-	Branch            string            `yaml:"branch"`
-	SourceDirectory   string            `yaml:"source_directory"`    // 远程仓库中的源目录
-	TargetDirectory   string            `yaml:"target_directory"`    // 本地项目的目标目录
-	LocalPath         string            `yaml:"local_path"`          // 本地仓库路径 (同 TargetDirectory)
-	FilePatterns      []string          `yaml:"file_patterns"`
-	ExcludePatterns   []string          `yaml:"exclude_patterns"`
-	SyncPatterns      []string          `yaml:"sync_patterns"`       // 同步文件模式 (同 FilePatterns)
-	Exclude           []string          `yaml:"exclude"`             // 排除模式 (同 ExcludePatterns)
-	WatchMode         bool              `yaml:"watch_mode"`          // 是否启用文件监控
-	AutoSync          *AutoSyncConfig   `yaml:"auto_sync,omitempty"`
-	BackupConfig      *BackupConfig     `yaml:"backup_config,omitempty"`
-	PostSyncCommands  []PostSyncCommand `yaml:"post_sync_commands,omitempty"`
-	RepoType          string            `yaml:"repo_type"`           // SSH or HTTPS
-	Username          string            `yaml:"username,omitempty"`
-	Password          string            `yaml:"password,omitempty"`
+	Name                  string            `yaml:"name"`
+	URL                   string            `yaml:"url"`
+	Branch                string            `yaml:"branch"`
+	Ref                   string            `yaml:"ref,omitempty"`    // 固定版本: tag、commit SHA 或 semver 约束 (如 ^1.4)，优先于 branch
+	SourceDirectory       string            `yaml:"source_directory"` // 远程仓库中的源目录
+	TargetDirectory       string            `yaml:"target_directory"` // 本地项目的目标目录
+	LocalPath             string            `yaml:"local_path"`       // 本地仓库路径 (同 TargetDirectory)
+	FilePatterns          []string          `yaml:"file_patterns"`
+	ExcludePatterns       []string          `yaml:"exclude_patterns"`
+	Prune                 bool              `yaml:"prune,omitempty"`       // 删除上游已删除、且曾由本工具同步的文件
+	OnConflict            string            `yaml:"on_conflict,omitempty"` // ask, keep-local, take-remote, merge
+	SyncPatterns          []string          `yaml:"sync_patterns"`         // 同步文件模式 (同 FilePatterns)
+	Exclude               []string          `yaml:"exclude"`               // 排除模式 (同 ExcludePatterns)
+	WatchMode             bool              `yaml:"watch_mode"`            // 是否启用文件监控
+	AutoSync              *AutoSyncConfig   `yaml:"auto_sync,omitempty"`
+	BackupConfig          *BackupConfig     `yaml:"backup_config,omitempty"`
+	PostSyncCommands      []PostSyncCommand `yaml:"post_sync_commands,omitempty"`
+	RollbackOnHookFailure bool              `yaml:"rollback_on_hook_failure,omitempty"` // 同步后命令失败时回滚本次变更
+	CloneStrategy         string            `yaml:"clone_strategy,omitempty"`           // mirror, full, shallow, single-branch, sparse
+	CloneDepth            int               `yaml:"clone_depth,omitempty"`              // 浅克隆深度 (默认 1)
+	NetworkTimeout        time.Duration     `yaml:"network_timeout,omitempty"`          // 克隆/拉取的超时时间 (如 2m)，0 表示不限制
+	HookTimeout           time.Duration     `yaml:"hook_timeout,omitempty"`             // 每条同步后命令的超时时间 (如 10m)，0 表示不限制
+	DependsOn             []string          `yaml:"depends_on,omitempty"`               // 必须先同步的仓库名称
+	Groups                []string          `yaml:"groups,omitempty"`                   // 所属分组，用于 sync --group
+	Tags                  []string          `yaml:"tags,omitempty"`                     // 标签，sync --group 同样匹配
+	RepoType              string            `yaml:"repo_type"`                          // SSH or HTTPS
+	SSHKey                string            `yaml:"ssh_key,omitempty"`                  // SSH 私钥路径，默认依次尝试 ssh-agent 和 ~/.ssh/id_ed25519、id_ecdsa、id_rsa
+	SSHPassphraseEnv      string            `yaml:"ssh_passphrase_env,omitempty"`       // 保存私钥密码的环境变量名
+	UseAgent              *bool             `yaml:"use_agent,omitempty"`                // 是否使用 ssh-agent (默认 true)
+	KnownHosts            string            `yaml:"known_hosts,omitempty"`              // known_hosts 文件路径，默认 ~/.ssh/known_hosts
+	Username              string            `yaml:"username,omitempty"`
+	Password              string            `yaml:"password,omitempty"`           // 建议使用 ${ENV_VAR} 引用，避免明文保存令牌
+	CredentialSources     []string          `yaml:"credential_sources,omitempty"` // 凭据来源顺序: config, secrets, netrc, git (默认全部)
+	NetworkConfig         `yaml:",inline"`  // 代理和 TLS 设置，覆盖 settings 中的全局设置
 
 	// Runtime status (not saved to config)
-	Status       SyncStatus  `yaml:"-"`
-	LastSync     *time.Time  `yaml:"-"`
-	FilesTracked int         `yaml:"-"`
+	Status        SyncStatus `yaml:"-"`
+	LastSync      *time.Time `yaml:"-"`
+	FilesTracked  int        `yaml:"-"`
 	FilesModified int        `yaml:"-"`
+	ModifiedFiles []string   `yaml:"-"` // 上次同步后在本地修改或删除的文件
+	SyncedCommit  string     `yaml:"-"` // 上次同步的提交
+	RemoteCommit  string     `yaml:"-"` // 远程当前指向的提交，未知时为空
+	RemoteSource  string     `yaml:"-"` // RemoteCommit 的来源: remote 或 cache (--offline)
+}
+
+// InGroup reports whether the repository is in the group or has it as a tag
+func (r *Repository) InGroup(name string) bool {
+	for _, group := range r.Groups {
+		if group == name {
+			return true
+		}
+	}
+	for _, tag := range r.Tags {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DependsOnRepository reports whether the repository directly depends on name
+func (r *Repository) DependsOnRepository(name string) bool {
+	for _, dep := range r.DependsOn {
+		if dep == name {
+			return true
+		}
+	}
+	return false
 }
 
 // AutoSyncConfig represents auto-sync settings
@@ -49,8 +112,35 @@ type AutoSyncConfig struct {
 
 // BackupConfig represents backup settings
 type BackupConfig struct {
-	Enabled    bool `yaml:"enabled"`
-	MaxBackups int  `yaml:"max_backups"`
+	Enabled     bool   `yaml:"enabled"`
+	MaxBackups  int    `yaml:"max_backups"`
+	Compression string `yaml:"compression,omitempty"` // none、gzip（逐个数据块压缩）、tar.gz 或 zstd（每个还原点一个归档）
+}
+
+// NetworkConfig configures how remotes are reached: proxy and TLS settings,
+// set globally in settings and per repository
+type NetworkConfig struct {
+	Proxy           string `yaml:"proxy,omitempty"`             // 代理地址 (http://、https:// 或 socks5://)，为空时使用 HTTPS_PROXY/HTTP_PROXY；始终遵循 NO_PROXY
+	CABundle        string `yaml:"ca_bundle,omitempty"`         // 额外信任的 CA 证书 (PEM)
+	ClientCert      string `yaml:"client_cert,omitempty"`       // 客户端证书 (PEM)，用于双向 TLS
+	ClientKey       string `yaml:"client_key,omitempty"`        // 客户端证书私钥 (PEM)
+	InsecureSkipTLS bool   `yaml:"insecure_skip_tls,omitempty"` // 跳过 TLS 证书校验（不安全，仅用于排查问题）
+}
+
+// Merge returns the settings with the non-empty fields of override applied
+func (n NetworkConfig) Merge(override NetworkConfig) NetworkConfig {
+	if override.Proxy != "" {
+		n.Proxy = override.Proxy
+	}
+	if override.CABundle != "" {
+		n.CABundle = override.CABundle
+	}
+	if override.ClientCert != "" || override.ClientKey != "" {
+		n.ClientCert = override.ClientCert
+		n.ClientKey = override.ClientKey
+	}
+	n.InsecureSkipTLS = n.InsecureSkipTLS || override.InsecureSkipTLS
+	return n
 }
 
 // PostSyncCommand represents a command to run after sync
@@ -100,7 +190,15 @@ func (r *Repository) GetStatusText() string {
 	}
 }
 
+// GetRevision returns the pinned ref if set, otherwise the branch
+func (r *Repository) GetRevision() string {
+	if r.Ref != "" {
+		return r.Ref
+	}
+	return r.Branch
+}
+
 // GetDisplayName returns formatted name for display
 func (r *Repository) GetDisplayName() string {
-	return r.GetIcon() + " " + r.Name + " (" + r.URL + " @ " + r.Branch + ")"
+	return r.GetIcon() + " " + r.Name + " (" + r.URL + " @ " + r.GetRevision() + ")"
 }
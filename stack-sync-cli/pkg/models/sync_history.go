@@ -6,36 +6,46 @@ import "time"
 type FileChangeType string
 
 const (
-	ChangeTypeAdded   FileChangeType = "added"   // 新增文件
-	ChangeTypeModified FileChangeType = "modified" // 修改文件
-	ChangeTypeDeleted  FileChangeType = "deleted"  // 删除文件
+	ChangeTypeAdded     FileChangeType = "added"     // 新增文件
+	ChangeTypeModified  FileChangeType = "modified"  // 修改文件
+	ChangeTypeDeleted   FileChangeType = "deleted"   // 删除文件
+	ChangeTypeUnchanged FileChangeType = "unchanged" // 内容未变，未写入
 )
 
 // FileChange represents a single file change
 type FileChange struct {
-	Path      string        `json:"path"`       // 文件路径（相对路径）
-	ChangeType FileChangeType `json:"change_type"` // 变更类型
-	Size      int64         `json:"size"`      // 文件大小（字节）
+	Path       string         `json:"path"`           // 文件路径（相对路径）
+	ChangeType FileChangeType `json:"change_type"`    // 变更类型
+	Size       int64          `json:"size"`           // 文件大小（字节）
+	Hash       string         `json:"hash,omitempty"` // 写入内容的 sha256，用于撤销前检测本地修改
 }
 
 // SyncHistory represents a single sync operation history
 type SyncHistory struct {
-	ID          string       `json:"id"`           // 唯一ID
-	Repository  string       `json:"repository"`  // 仓库名称
-	Branch      string       `json:"branch"`      // 分支名称
-	Timestamp   time.Time    `json:"timestamp"`   // 同步时间
-	Success     bool         `json:"success"`     // 是否成功
-	Error       string       `json:"error,omitempty"` // 错误信息（如果有）
-	FileChanges []FileChange `json:"file_changes"`   // 文件变更列表
-	TotalFiles  int          `json:"total_files"`    // 总文件数
-	AddedCount  int          `json:"added_count"`    // 新增文件数
-	ModifiedCount int        `json:"modified_count"` // 修改文件数
-	DeletedCount  int        `json:"deleted_count"`  // 删除文件数
-	Duration    int64        `json:"duration"`       // 同步耗时（毫秒）
+	ID             string       `json:"id"`                        // 唯一ID
+	Repository     string       `json:"repository"`                // 仓库名称
+	Branch         string       `json:"branch"`                    // 分支名称
+	Ref            string       `json:"ref,omitempty"`             // 配置的固定版本 (tag/SHA/semver)
+	Commit         string       `json:"commit,omitempty"`          // 实际同步的远程提交
+	CloneStrategy  string       `json:"clone_strategy,omitempty"`  // 实际使用的克隆策略
+	Timestamp      time.Time    `json:"timestamp"`                 // 同步时间
+	Success        bool         `json:"success"`                   // 是否成功
+	Error          string       `json:"error,omitempty"`           // 错误信息（如果有）
+	RolledBack     bool         `json:"rolled_back,omitempty"`     // 失败后已回滚所有变更
+	Cancelled      bool         `json:"cancelled,omitempty"`       // 被中断 (Ctrl+C/SIGTERM) 或超时取消
+	Backup         string       `json:"backup,omitempty"`          // 同步前创建的备份名称
+	PreviousCommit string       `json:"previous_commit,omitempty"` // 同步前锁文件记录的提交
+	UndoOf         string       `json:"undo_of,omitempty"`         // 本次操作撤销的历史记录 ID
+	FileChanges    []FileChange `json:"file_changes"`              // 文件变更列表
+	TotalFiles     int          `json:"total_files"`               // 总文件数
+	AddedCount     int          `json:"added_count"`               // 新增文件数
+	ModifiedCount  int          `json:"modified_count"`            // 修改文件数
+	DeletedCount   int          `json:"deleted_count"`             // 删除文件数
+	UnchangedCount int          `json:"unchanged_count,omitempty"` // 内容未变的文件数
+	Duration       int64        `json:"duration"`                  // 同步耗时（毫秒）
 }
 
 // SyncHistoryStore represents the storage for sync history
 type SyncHistoryStore struct {
 	Histories []SyncHistory `json:"histories"`
 }
-
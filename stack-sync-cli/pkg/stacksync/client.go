@@ -0,0 +1,154 @@
+// Package stacksync lets Go programs sync repositories the way the stack-sync
+// CLI does. A Client never prompts, reads stdin or writes to stdout; progress
+// and hook output go to Options.Output if set.
+package stacksync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/config"
+	"github.com/stackfilesync/stack-sync-cli/internal/i18n"
+	"github.com/stackfilesync/stack-sync-cli/internal/sync"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// ErrCancelled is wrapped by errors of syncs cancelled through their context
+var ErrCancelled = sync.ErrCancelled
+
+// Options tune how a Client syncs
+type Options struct {
+	Output     io.Writer // progress, reports and hook output; discarded if nil
+	DryRun     bool      // plan syncs without touching targets, history or lockfiles
+	Prune      bool      // delete synced files removed upstream, even if a repository doesn't enable it
+	Force      bool      // take ownership of unowned files instead of reporting conflicts
+	OnConflict string    // keep-local, take-remote or merge for files edited locally and upstream; keep-local if empty
+}
+
+// Client syncs the repositories of one configuration. It is not safe for
+// concurrent use.
+type Client struct {
+	config  *Config
+	synced  *config.Config // copy of config the manager syncs
+	manager *sync.Manager
+}
+
+// New creates a client for cfg. Later changes to cfg don't affect the client.
+func New(cfg *Config, opts Options) (*Client, error) {
+	if cfg == nil {
+		return nil, errors.New("config is required")
+	}
+	synced, err := cfg.internal()
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.OnConflict {
+	case "", models.OnConflictKeepLocal, models.OnConflictTakeRemote, models.OnConflictMerge:
+	case models.OnConflictAsk:
+		return nil, errors.New("on_conflict ask needs a terminal, use keep-local, take-remote or merge")
+	default:
+		return nil, fmt.Errorf("unknown on_conflict value: %s", opts.OnConflict)
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+
+	manager := sync.NewManager(synced, i18n.New())
+	manager.SetOutput(output)
+	manager.SetNonInteractive(true)
+	manager.SetDryRun(opts.DryRun)
+	manager.SetPrune(opts.Prune)
+	manager.SetForce(opts.Force)
+	manager.SetOnConflict(opts.OnConflict)
+
+	return &Client{config: cfg, synced: synced, manager: manager}, nil
+}
+
+// NewFromFile creates a client for the configuration file at path
+func NewFromFile(path string, opts Options) (*Client, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg, opts)
+}
+
+// Config returns the client's configuration
+func (c *Client) Config() *Config {
+	return c.config
+}
+
+// Repository returns the configured repository with the given name
+func (c *Client) Repository(name string) (*models.Repository, error) {
+	return c.synced.GetRepository(name)
+}
+
+// Plan fetches a repository and plans a sync of it without touching the
+// target. The plan keeps a checkout of the source until it is applied or
+// closed. Cancelling ctx aborts the fetch.
+func (c *Client) Plan(ctx context.Context, name string) (*Plan, error) {
+	repo, err := c.Repository(name)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := c.manager.PlanSync(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	deletions, err := c.manager.PrunableEntries(plan)
+	if err != nil {
+		plan.Close()
+		return nil, err
+	}
+
+	entries := append(append([]sync.PlanEntry{}, plan.Entries...), deletions...)
+	changes := make([]models.FileChange, 0, len(entries))
+	for _, entry := range entries {
+		changes = append(changes, models.FileChange{Path: entry.Path, ChangeType: entry.ChangeType()})
+	}
+
+	return &Plan{
+		Repository: repo.Name,
+		Commit:     plan.Commit,
+		Changes:    changes,
+		plan:       plan,
+		entries:    entries,
+	}, nil
+}
+
+// Apply applies the changes selector chooses from plan, all of them if
+// selector is nil. The plan can't be applied again afterwards. Cancelling ctx
+// stops the sync before the target changes, or aborts post-sync commands; the
+// error then wraps ErrCancelled.
+func (c *Client) Apply(ctx context.Context, plan *Plan, selector Selector) (*Result, error) {
+	if plan == nil || plan.plan == nil {
+		return nil, errors.New("plan was already applied or closed")
+	}
+	if selector == nil {
+		selector = SelectAll
+	}
+
+	result, err := c.manager.ApplyPlan(ctx, plan.plan, planSelector{plan: plan, selector: selector})
+	plan.plan = nil
+	if err != nil {
+		return nil, err
+	}
+	return newResult(result), nil
+}
+
+// Sync plans and applies a sync of a repository in one step
+func (c *Client) Sync(ctx context.Context, name string, selector Selector) (*Result, error) {
+	plan, err := c.Plan(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer plan.Close()
+	return c.Apply(ctx, plan, selector)
+}
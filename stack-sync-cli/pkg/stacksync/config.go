@@ -0,0 +1,61 @@
+package stacksync
+
+import (
+	"fmt"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/config"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// Config is what a Client syncs: settings shared by every repository and the
+// repositories themselves, as read from config.yml
+type Config struct {
+	Settings     Settings
+	Repositories []models.Repository
+}
+
+// Settings apply to every repository of a Config
+type Settings struct {
+	BackupEnabled bool   // back up overwritten and deleted files before each sync
+	BackupDir     string // ~/.stack-sync/backups if empty
+	CacheEnabled  bool   // reuse a local mirror instead of cloning on every sync
+	CacheDir      string // ~/.stack-sync/cache if empty
+
+	models.NetworkConfig // proxy and TLS settings, repositories may override them
+}
+
+// LoadConfig reads the configuration file at path
+func LoadConfig(path string) (*Config, error) {
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		Settings: Settings{
+			BackupEnabled: cfg.Settings.BackupEnabled,
+			BackupDir:     cfg.Settings.BackupDir,
+			CacheEnabled:  cfg.Settings.CacheEnabled,
+			CacheDir:      cfg.Settings.CacheDir,
+			NetworkConfig: cfg.Settings.NetworkConfig,
+		},
+		Repositories: cfg.Repositories,
+	}, nil
+}
+
+// internal converts the configuration for the sync manager and validates it
+func (c *Config) internal() (*config.Config, error) {
+	cfg := &config.Config{
+		Settings: config.Settings{
+			BackupEnabled: c.Settings.BackupEnabled,
+			BackupDir:     c.Settings.BackupDir,
+			CacheEnabled:  c.Settings.CacheEnabled,
+			CacheDir:      c.Settings.CacheDir,
+			NetworkConfig: c.Settings.NetworkConfig,
+		},
+		Repositories: append([]models.Repository(nil), c.Repositories...),
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
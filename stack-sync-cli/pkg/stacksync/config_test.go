@@ -0,0 +1,67 @@
+package stacksync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(`settings:
+  backup_enabled: true
+  backup_dir: ~/backups
+  proxy: http://proxy:3128
+  language: zh-CN
+repositories:
+  - name: proto
+    url: https://example.com/proto.git
+    branch: main
+    target_directory: ./proto
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Settings{BackupEnabled: true, BackupDir: "~/backups", CacheEnabled: true, NetworkConfig: models.NetworkConfig{Proxy: "http://proxy:3128"}}
+	if cfg.Settings != want {
+		t.Errorf("settings = %+v, want %+v", cfg.Settings, want)
+	}
+	if len(cfg.Repositories) != 1 || cfg.Repositories[0].Name != "proto" {
+		t.Errorf("repositories = %+v", cfg.Repositories)
+	}
+}
+
+func TestNewCopiesConfig(t *testing.T) {
+	repo := models.Repository{Name: "proto", URL: "https://example.com/proto.git", Branch: "main", TargetDirectory: t.TempDir()}
+	cfg := &Config{Repositories: []models.Repository{repo}}
+
+	client, err := New(cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Repositories[0].Name = "renamed"
+	if _, err := client.Repository("proto"); err != nil {
+		t.Errorf("changing the config after New affected the client: %v", err)
+	}
+	if client.Config() != cfg {
+		t.Error("Config() doesn't return the config the client was created with")
+	}
+
+	duplicate := &Config{Repositories: []models.Repository{repo, repo}}
+	if _, err := New(duplicate, Options{}); err == nil || !strings.Contains(err.Error(), "invalid config") {
+		t.Errorf("New() with a repository configured twice = %v", err)
+	}
+	if _, err := New(nil, Options{}); err == nil {
+		t.Error("New() without a config succeeded")
+	}
+	if _, err := New(cfg, Options{OnConflict: models.OnConflictAsk}); err == nil {
+		t.Error("New() with on_conflict ask succeeded")
+	}
+}
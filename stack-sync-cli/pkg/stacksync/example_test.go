@@ -0,0 +1,113 @@
+package stacksync_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+	"github.com/stackfilesync/stack-sync-cli/pkg/stacksync"
+)
+
+// newRemote creates a bare repository below dir with files committed on main
+func newRemote(dir string, files map[string]string) (string, error) {
+	work := filepath.Join(dir, "work")
+	repo, err := gogit.PlainInitWithOptions(work, &gogit.PlainInitOptions{InitOptions: gogit.InitOptions{DefaultBranch: plumbing.Main}})
+	if err != nil {
+		return "", err
+	}
+	for path, content := range files {
+		full := filepath.Join(work, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	if err := w.AddWithOptions(&gogit.AddOptions{All: true}); err != nil {
+		return "", err
+	}
+	if _, err := w.Commit("initial", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "example", Email: "example@example.com", When: time.Now()},
+	}); err != nil {
+		return "", err
+	}
+
+	bare := filepath.Join(dir, "remote.git")
+	if _, err := gogit.PlainClone(bare, true, &gogit.CloneOptions{URL: work}); err != nil {
+		return "", err
+	}
+	return bare, nil
+}
+
+func Example() {
+	ctx := context.Background()
+
+	// History, backups and the mirror cache go to the home directory
+	dir, err := os.MkdirTemp("", "stacksync-example")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("HOME", dir)
+	os.Setenv("USERPROFILE", dir)
+
+	remote, err := newRemote(dir, map[string]string{
+		"api/user.proto":  "syntax = \"proto3\";\n",
+		"api/order.proto": "syntax = \"proto3\";\n",
+		"README.md":       "not synced\n",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	client, err := stacksync.New(&stacksync.Config{
+		Settings: stacksync.Settings{BackupEnabled: true},
+		Repositories: []models.Repository{{
+			Name:            "user-service",
+			URL:             remote,
+			Branch:          "main",
+			SourceDirectory: "api",
+			TargetDirectory: filepath.Join(dir, "proto"),
+			FilePatterns:    []string{"*.proto"},
+		}},
+	}, stacksync.Options{})
+	if err != nil {
+		panic(err)
+	}
+
+	plan, err := client.Plan(ctx, "user-service")
+	if err != nil {
+		panic(err)
+	}
+	for _, change := range plan.Changes {
+		fmt.Println("planned:", change.ChangeType, change.Path)
+	}
+
+	result, err := client.Apply(ctx, plan, stacksync.SelectPaths("user.proto"))
+	if err != nil {
+		panic(err)
+	}
+	for _, change := range result.Changes {
+		fmt.Println("synced:", change.ChangeType, change.Path)
+	}
+	_, err = os.Stat(filepath.Join(dir, "proto", "order.proto"))
+	fmt.Println("order.proto synced:", err == nil)
+
+	// Output:
+	// planned: added order.proto
+	// planned: added user.proto
+	// synced: added user.proto
+	// order.proto synced: false
+}
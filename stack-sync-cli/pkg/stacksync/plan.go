@@ -0,0 +1,126 @@
+package stacksync
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/stackfilesync/stack-sync-cli/internal/sync"
+	"github.com/stackfilesync/stack-sync-cli/pkg/models"
+)
+
+// Plan is what a sync of one repository could do
+type Plan struct {
+	Repository string
+	Commit     string              // commit the source was checked out at
+	Changes    []models.FileChange // added, modified and unchanged source files, then deletions pruning allows
+
+	plan    *sync.Plan
+	entries []sync.PlanEntry // same order as Changes
+}
+
+// Close removes the plan's checkout of the source without applying it
+func (p *Plan) Close() {
+	if p.plan != nil {
+		p.plan.Close()
+		p.plan = nil
+	}
+}
+
+// Selector chooses which planned changes a sync applies. Returning no changes
+// ends the sync without touching the target.
+type Selector interface {
+	Select(plan *Plan) ([]models.FileChange, error)
+}
+
+// SelectorFunc adapts a function to a Selector
+type SelectorFunc func(plan *Plan) ([]models.FileChange, error)
+
+// Select implements Selector
+func (f SelectorFunc) Select(plan *Plan) ([]models.FileChange, error) {
+	return f(plan)
+}
+
+// SelectAll applies every planned change
+var SelectAll Selector = SelectorFunc(func(plan *Plan) ([]models.FileChange, error) {
+	return plan.Changes, nil
+})
+
+// SelectPaths applies only the planned changes of the given paths, relative to
+// the target directory
+func SelectPaths(paths ...string) Selector {
+	return SelectorFunc(func(plan *Plan) ([]models.FileChange, error) {
+		want := make(map[string]bool, len(paths))
+		for _, path := range paths {
+			want[filepath.ToSlash(path)] = true
+		}
+
+		var changes []models.FileChange
+		for _, change := range plan.Changes {
+			if want[filepath.ToSlash(change.Path)] {
+				changes = append(changes, change)
+			}
+		}
+		return changes, nil
+	})
+}
+
+// planSelector runs a caller's selector inside the sync pipeline
+type planSelector struct {
+	plan     *Plan
+	selector Selector
+}
+
+// Select implements sync.Selector
+func (s planSelector) Select(_ *sync.Manager, _ *sync.Plan) ([]sync.PlanEntry, error) {
+	chosen, err := s.selector.Select(s.plan)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]sync.PlanEntry, len(s.plan.entries))
+	for _, entry := range s.plan.entries {
+		byPath[filepath.ToSlash(entry.Path)] = entry
+	}
+
+	entries := make([]sync.PlanEntry, 0, len(chosen))
+	for _, change := range chosen {
+		entry, ok := byPath[filepath.ToSlash(change.Path)]
+		if !ok {
+			return nil, fmt.Errorf("%s is not part of the plan for %s", change.Path, s.plan.Repository)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Result is what a sync did to the target directory
+type Result struct {
+	Repository string
+	Commit     string              // commit the files were synced from
+	Changes    []models.FileChange // files added, modified, deleted or left unchanged in the target
+	Conflicts  []string            // unowned target files that were left alone
+	LocalEdits []LocalEdit         // files edited locally since the last sync
+	DryRun     bool                // Changes were only planned, nothing was written
+}
+
+// LocalEdit is a target file edited locally since the last sync and how it was resolved
+type LocalEdit struct {
+	Path       string
+	Resolution string // keep-local, take-remote or merge
+	Conflicted bool   // merged with conflict markers that need manual resolution
+}
+
+// newResult converts a sync result
+func newResult(result *sync.SyncResult) *Result {
+	converted := &Result{
+		Repository: result.Repository,
+		Commit:     result.Commit,
+		Changes:    result.Changes,
+		Conflicts:  result.Conflicts,
+		DryRun:     result.DryRun,
+	}
+	for _, edit := range result.LocalEdits {
+		converted.LocalEdits = append(converted.LocalEdits, LocalEdit(edit))
+	}
+	return converted
+}